@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"FullStackApp01/common"
+)
+
+// VisitorHeader carries the id of an anonymous visitor, its increments are counted in the unique visitors
+const VisitorHeader = "X-Visitor-ID"
+
+// CounterACLRequest is the DTO replacing the access control list of a counter. A missing owner keeps the current one,
+// an empty one leaves the counter without owner
+type CounterACLRequest struct {
+	Owner   *string           `json:"owner"`
+	Entries []common.ACLEntry `json:"entries"`
+}
+
+// HandleCounterACL shows (GET) or replaces (PUT) the access control list of the counter named in the path,
+// or of the default counter. Both need the admin permission on the counter, held by its owner and the admins
+func (s *Server) HandleCounterACL(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.counterAccess(w, r, store, name, common.PermissionAdmin, func(_ *common.Claims) {
+			acl, err := store.GetCounterACL(name)
+			if writeCounterError(w, err, "Failed to get the counter access control list") {
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(acl)
+		})
+	case http.MethodPut:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.setCounterACL(w, r, store, name)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) setCounterACL(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionAdmin, func(claims *common.Claims) {
+		var req CounterACLRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Entries == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		acl, err := store.GetCounterACL(name)
+		if writeCounterError(w, err, "Failed to get the counter access control list") {
+			return
+		}
+		acl.Entries = req.Entries
+		if req.Owner != nil {
+			acl.Owner = *req.Owner
+		}
+
+		err = store.SetCounterACL(*acl)
+		if errors.Is(err, common.ErrUserNotFound) {
+			http.Error(w, "Owner not found", http.StatusBadRequest)
+			return
+		}
+		if writeCounterError(w, err, "Could not set the counter access control list") {
+			return
+		}
+
+		log.Debug("counter access control list set", "counter", name, "owner", acl.Owner, "user", callerName(claims))
+		_ = json.NewEncoder(w).Encode(acl)
+	})
+}
+
+// counterAccess runs next with the caller's claims, nil for an anonymous caller, if the counter access control list
+// grants the permission. Otherwise, it writes the error response
+func (s *Server) counterAccess(w http.ResponseWriter, r *http.Request, store Storage, name string, permission string, next func(claims *common.Claims)) {
+	claims, ok := s.counterCaller(w, r, store, name, permission)
+	if ok {
+		next(claims)
+	}
+}
+
+// counterCaller returns the caller's claims, nil for an anonymous caller, if the counter access control list grants
+// the permission. Otherwise, it writes the error response and returns false: 401 for an anonymous caller or an invalid
+// token and 403 for an authenticated one
+func (s *Server) counterCaller(w http.ResponseWriter, r *http.Request, store Storage, name string, permission string) (*common.Claims, bool) {
+	var claims *common.Claims
+	if len(r.Header.Get("Authorization")) > 0 {
+		var err error
+		claims, err = s.parseClaims(r)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return nil, false
+		}
+	}
+
+	acl, err := store.GetCounterACL(name)
+	if writeCounterError(w, err, "Failed to get the counter access control list") {
+		return nil, false
+	}
+	if !acl.Allows(claims, permission) {
+		if claims == nil {
+			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			return nil, false
+		}
+		http.Error(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// callerName returns the username of the claims, empty for an anonymous caller
+func callerName(claims *common.Claims) string {
+	if claims == nil {
+		return ""
+	}
+
+	return claims.Username
+}
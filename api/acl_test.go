@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterACL(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	_ = s.store.SaveUser("bob", "pass", "user")
+	bobToken := loginToken(t, s, "bob", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	rr := httptest.NewRecorder()
+	s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{Name: "visits"}))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	t.Run("should show the default access control list to the owner", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("GET", "/counters/visits/acl", "visits", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var acl common.CounterACL
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&acl))
+		assert.Equal(t, common.CounterACL{Counter: "visits", Owner: "alice", Entries: common.DefaultACLEntries()}, acl)
+	})
+
+	t.Run("should only let the owner and the admins edit it", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("GET", "/counters/visits/acl", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("PUT", "/counters/visits/acl", "visits", bobToken, CounterACLRequest{Entries: []common.ACLEntry{}}))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("GET", "/counters/visits/acl", "visits", "", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("GET", "/counters/visits/acl", "visits", adminToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should validate the access control list", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := CounterACLRequest{Entries: []common.ACLEntry{{Type: "group", Name: "staff", Permissions: []string{common.PermissionRead}}}}
+		s.HandleCounterACL(rr, namedCounterRequest("PUT", "/counters/visits/acl", "visits", aliceToken, req))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		owner := "nobody"
+		s.HandleCounterACL(rr, namedCounterRequest("PUT", "/counters/visits/acl", "visits", aliceToken, CounterACLRequest{Owner: &owner, Entries: []common.ACLEntry{}}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterACL(rr, namedCounterRequest("GET", "/counters/missing/acl", "missing", adminToken, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should check the entries in the counter handlers", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := CounterACLRequest{Entries: []common.ACLEntry{
+			{Type: common.PrincipalAnonymous, Permissions: []string{common.PermissionRead, common.PermissionIncrement}},
+			{Type: common.PrincipalUser, Name: "bob", Permissions: []string{common.PermissionReset}},
+		}}
+		s.HandleCounterACL(rr, namedCounterRequest("PUT", "/counters/visits/acl", "visits", aliceToken, req))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// the anonymous increments are granted to everyone, bob included
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/visits", "visits", "", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/visits", "visits", bobToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, uint64(2), resp.Value)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterReset(rr, namedCounterRequest("POST", "/counters/visits/reset", "visits", "", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = httptest.NewRecorder()
+		s.HandleCounterReset(rr, namedCounterRequest("POST", "/counters/visits/reset", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// reset does not grant the management of the counter
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("DELETE", "/counters/visits", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should hand the counter over to a new owner", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		owner := "bob"
+		s.HandleCounterACL(rr, namedCounterRequest("PUT", "/counters/visits/acl", "visits", aliceToken, CounterACLRequest{Owner: &owner, Entries: []common.ACLEntry{}}))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// nobody else can read the counter anymore
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("GET", "/counters/visits", "visits", "", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("GET", "/counters/visits", "visits", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("GET", "/counters/visits", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = httptest.NewRecorder()
+		s.HandleCounterStats(rr, namedCounterRequest("GET", "/counters/visits/stats", "visits", adminToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
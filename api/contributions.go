@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"FullStackApp01/common"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+// LeaderboardResponse is the DTO holding the top contributors of a counter
+type LeaderboardResponse struct {
+	Name         string                `json:"name"`
+	Period       string                `json:"period"`
+	Contributors []common.Contribution `json:"contributors"`
+}
+
+// HandleLeaderboard returns (GET) the top contributors of the counter named in the path, or of the default counter.
+// The optional query parameters are limit and period (day, week or all; all by default)
+func (s *Server) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+	_, ok = s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	period := params.Get("period")
+	if len(period) == 0 {
+		period = common.PeriodAll
+	}
+	limit := defaultLeaderboardLimit
+	if value := params.Get("limit"); len(value) > 0 {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLeaderboardLimit {
+			http.Error(w, "Invalid limit, expected a value between 1 and "+strconv.Itoa(maxLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	contributors, err := store.GetLeaderboard(name, period, limit)
+	if errors.Is(err, common.ErrInvalidPeriod) {
+		http.Error(w, "Invalid period, expected day, week or all", http.StatusBadRequest)
+		return
+	}
+	if writeCounterError(w, err, "Failed to get leaderboard") {
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(LeaderboardResponse{
+		Name:         name,
+		Period:       period,
+		Contributors: contributors,
+	})
+}
+
+// HandleMyContributions returns (GET) the caller's contributions to each counter for the current day, week and all time
+func (s *Server) HandleMyContributions(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	s.Authorized(w, r, []string{"user", "admin"}, func() {
+		username, _ := s.GetUserFromToken(r)
+		contributions, err := store.GetUserContributions(username)
+		if err != nil {
+			http.Error(w, "Failed to get contributions", http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(contributions)
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLeaderboard(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	_ = s.store.SaveUser("bob", "pass", "user")
+	bobToken := loginToken(t, s, "bob", "pass")
+
+	for token, delta := range map[string]int64{aliceToken: 2, bobToken: 5} {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", token, CounterDeltaRequest{Delta: int64Ptr(delta)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	t.Run("should return the top contributors", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleLeaderboard(rr, httptest.NewRequest("GET", "/counter/leaderboard?limit=1&period=week", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp LeaderboardResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, "week", resp.Period)
+		assert.Equal(t, []common.Contribution{{Rank: 1, Username: "bob", Increments: 5}}, resp.Contributors)
+	})
+
+	t.Run("should validate the parameters", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleLeaderboard(rr, httptest.NewRequest("GET", "/counter/leaderboard?period=month", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleLeaderboard(rr, httptest.NewRequest("GET", "/counter/leaderboard?limit=1000", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return the caller's contributions", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleMyContributions(rr, httptest.NewRequest("GET", "/me/contributions", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleMyContributions(rr, groupRequest("GET", "/me/contributions", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var contributions []common.UserContributions
+		_ = json.Unmarshal(rr.Body.Bytes(), &contributions)
+		assert.Equal(t, []common.UserContributions{{Counter: common.DefaultCounterName, Day: 2, Week: 2, All: 2}}, contributions)
+	})
+}
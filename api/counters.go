@@ -0,0 +1,498 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"FullStackApp01/common"
+)
+
+var counterNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// CreateCounterRequest is the DTO used to create a named counter
+type CreateCounterRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Min         *uint64 `json:"min,omitempty"`
+	Max         *uint64 `json:"max,omitempty"`
+	// Window makes it a sliding window counter
+	Window *common.SlidingWindow `json:"window,omitempty"`
+}
+
+// CounterDeltaRequest is the optional body of a counter update. A missing body or delta adds 1
+type CounterDeltaRequest struct {
+	Delta *int64 `json:"delta"`
+}
+
+// CounterBoundsRequest is the DTO used to set the inclusive bounds of a counter. A missing bound means unbounded
+type CounterBoundsRequest struct {
+	Min *uint64 `json:"min"`
+	Max *uint64 `json:"max"`
+}
+
+// SetCounterRequest is the DTO used to set the counter to an explicit value
+type SetCounterRequest struct {
+	Value *uint64 `json:"value"`
+}
+
+// HandleCounter serves the default counter: query (GET), increment (POST), set (PUT) and reset (DELETE), as
+// allowed by its access control list. The value is exposed as an ETag; the mutations honor If-Match and PUT requires it
+func (s *Server) HandleCounter(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getCounter(w, r, store, common.DefaultCounterName)
+	case http.MethodPost:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.incrementCounter(w, r, store, common.DefaultCounterName)
+		})
+	case http.MethodPut:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.setCounter(w, r, store, common.DefaultCounterName)
+		})
+	case http.MethodDelete:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.resetCounter(w, r, store, common.DefaultCounterName)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCounters lists (GET) or creates (POST) the named counters
+func (s *Server) HandleCounters(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		counters, err := store.ListCounters()
+		if err != nil {
+			http.Error(w, "Failed to list counters", http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(counters)
+	case http.MethodPost:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.createCounter(w, r, store)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleNamedCounter serves the counter named in the path: query (GET), increment (POST), set (PUT) and delete (DELETE),
+// as allowed by its access control list. The deletion needs the admin permission
+func (s *Server) HandleNamedCounter(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		s.getCounter(w, r, store, name)
+	case http.MethodPost:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.incrementCounter(w, r, store, name)
+		})
+	case http.MethodPut:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.setCounter(w, r, store, name)
+		})
+	case http.MethodDelete:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.deleteCounter(w, r, store, name)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCounterReset resets (POST) the counter named in the path
+func (s *Server) HandleCounterReset(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	s.idempotent(w, r, store, func(w http.ResponseWriter) {
+		s.resetCounter(w, r, store, r.PathValue("name"))
+	})
+}
+
+// HandleCounterBounds sets (PUT) the bounds of the counter named in the path. It needs the admin permission on the counter
+func (s *Server) HandleCounterBounds(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	s.idempotent(w, r, store, func(w http.ResponseWriter) {
+		s.setCounterBounds(w, r, store, name)
+	})
+}
+
+func (s *Server) createCounter(w http.ResponseWriter, r *http.Request, store Storage) {
+	s.Authorized(w, r, []string{"user", "admin"}, func() {
+		var req CreateCounterRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !counterNamePattern.MatchString(req.Name) {
+			http.Error(w, "Invalid counter name", http.StatusBadRequest)
+			return
+		}
+
+		username, _ := s.GetUserFromToken(r)
+		err = store.CreateCounter(common.CounterInfo{
+			Name:        req.Name,
+			Description: req.Description,
+			CreatedBy:   username,
+			Min:         req.Min,
+			Max:         req.Max,
+			Window:      req.Window,
+		})
+		if errors.Is(err, common.ErrCounterAlreadyExists) {
+			http.Error(w, "Counter already exists", http.StatusConflict)
+			return
+		}
+		if writeCounterError(w, err, "Could not create counter") {
+			return
+		}
+
+		info, err := store.GetCounterInfo(req.Name)
+		if writeCounterError(w, err, "Failed to get counter") {
+			return
+		}
+
+		log.Debug("counter created", "counter", req.Name, "user", username)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(info)
+	})
+}
+
+func (s *Server) setCounterBounds(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionAdmin, func(claims *common.Claims) {
+		var req CounterBoundsRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err = store.SetCounterBounds(name, req.Min, req.Max)
+		if writeCounterError(w, err, "Could not set the counter bounds") {
+			return
+		}
+
+		info, err := store.GetCounterInfo(name)
+		if writeCounterError(w, err, "Failed to get counter") {
+			return
+		}
+
+		log.Debug("counter bounds set", "counter", name, "user", callerName(claims))
+		_ = json.NewEncoder(w).Encode(info)
+	})
+}
+
+func (s *Server) getCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionRead, func(_ *common.Claims) {
+		val, err := store.GetCounter(name)
+		if writeCounterError(w, err, "Failed to get counter") {
+			return
+		}
+
+		unique, err := store.GetUniqueCount(name)
+		if writeCounterError(w, err, "Failed to get counter") {
+			return
+		}
+
+		w.Header().Set("ETag", counterETag(val))
+		err = json.NewEncoder(w).Encode(CounterResponse{Name: name, Value: val, Unique: &unique})
+		if err != nil {
+			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("counter query", "counter", name, "value", val)
+	})
+}
+
+// incrementCounter adds the delta to the counter. An anonymous increment is counted for the visitor of the
+// VisitorHeader in the unique visitors
+func (s *Server) incrementCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionIncrement, func(claims *common.Claims) {
+		delta, ok := readCounterDelta(w, r)
+		if !ok {
+			return
+		}
+		expected, ok := readIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		username := callerName(claims)
+		var change common.CounterChange
+		var err error
+		switch {
+		case expected != nil:
+			change, err = compareAndAdd(store, name, *expected, delta, username)
+		case claims == nil:
+			change, err = store.AddToCounterAsVisitor(name, delta, r.Header.Get(VisitorHeader))
+		default:
+			change, err = store.AddToCounter(name, delta, username)
+		}
+		if writeCounterError(w, err, "Failed to increment counter") {
+			return
+		}
+		s.publishCounterChange(s.requestTenant(r), name, common.CounterOperationAdd, username, change)
+
+		w.Header().Set("ETag", counterETag(change.New))
+		err = json.NewEncoder(w).Encode(CounterResponse{Name: name, Value: change.New, Previous: &change.Old})
+		if err != nil {
+			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("counter updated", "counter", name, "delta", delta, "old value", change.Old, "new value", change.New)
+	})
+}
+
+func (s *Server) deleteCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionAdmin, func(claims *common.Claims) {
+		err := store.DeleteCounter(name)
+		if writeCounterError(w, err, "Could not delete counter") {
+			return
+		}
+
+		log.Debug("counter deleted", "counter", name, "user", callerName(claims))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (s *Server) resetCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionReset, func(claims *common.Claims) {
+		expected, ok := readIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		username := callerName(claims)
+		var change common.CounterChange
+		var err error
+		if expected != nil {
+			change, err = store.CompareAndResetCounter(name, *expected, username)
+		} else {
+			change, err = store.ResetCounter(name, username)
+		}
+		if writeCounterError(w, err, "Failed to reset counter") {
+			return
+		}
+		s.publishCounterChange(s.requestTenant(r), name, common.CounterOperationReset, username, change)
+
+		w.Header().Set("ETag", counterETag(0))
+		err = json.NewEncoder(w).Encode(CounterResponse{Name: name, Value: 0})
+		if err != nil {
+			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("counter reset", "counter", name, "new value", 0)
+	})
+}
+
+// setCounter sets the counter to the value from the request body, only if it still matches the
+// mandatory If-Match header. It needs the reset permission, like the reset
+func (s *Server) setCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionReset, func(claims *common.Claims) {
+		var req SetCounterRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Value == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		expected, ok := readIfMatch(w, r)
+		if !ok {
+			return
+		}
+		if expected == nil {
+			http.Error(w, "If-Match header with the current counter ETag required", http.StatusPreconditionRequired)
+			return
+		}
+
+		username := callerName(claims)
+		change, err := store.CompareAndSwapCounter(name, *expected, *req.Value, username)
+		if writeCounterError(w, err, "Failed to set counter") {
+			return
+		}
+		s.publishCounterChange(s.requestTenant(r), name, common.CounterOperationSet, username, change)
+
+		w.Header().Set("ETag", counterETag(change.New))
+		err = json.NewEncoder(w).Encode(CounterResponse{Name: name, Value: change.New, Previous: &change.Old})
+		if err != nil {
+			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("counter set", "counter", name, "old value", change.Old, "new value", change.New)
+	})
+}
+
+// compareAndAdd adds the delta to the counter only if it still holds the expected value
+func compareAndAdd(store Storage, name string, expected uint64, delta int64, username string) (common.CounterChange, error) {
+	value, err := common.ApplyDelta(expected, delta)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return store.CompareAndSwapCounter(name, expected, value, username)
+}
+
+// counterETag returns the strong entity tag of the counter value
+func counterETag(value uint64) string {
+	return fmt.Sprintf(`"%d"`, value)
+}
+
+// readIfMatch returns the counter value expected by the If-Match header, nil if the header is missing or "*".
+// On error, it writes the response and returns false
+func readIfMatch(w http.ResponseWriter, r *http.Request) (*uint64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return nil, true
+	}
+
+	// the counter entity tags are strong, a weak one never matches
+	if strings.HasPrefix(header, "W/") || len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		http.Error(w, "Counter value does not match If-Match", http.StatusPreconditionFailed)
+		return nil, false
+	}
+
+	value, err := strconv.ParseUint(header[1:len(header)-1], 10, 64)
+	if err != nil {
+		http.Error(w, "Counter value does not match If-Match", http.StatusPreconditionFailed)
+		return nil, false
+	}
+
+	return &value, true
+}
+
+// readCounterDelta returns the delta from the optional request body, 1 if there is none.
+// On error, it writes the response and returns false
+func readCounterDelta(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	var req CounterDeltaRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if errors.Is(err, io.EOF) {
+		return 1, true
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	if req.Delta == nil {
+		return 1, true
+	}
+	if *req.Delta == 0 {
+		http.Error(w, "Delta must not be 0", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return *req.Delta, true
+}
+
+// writeCounterError writes the HTTP error matching err and returns true if there was an error
+func writeCounterError(w http.ResponseWriter, err error, message string) bool {
+	if err == nil {
+		return false
+	}
+
+	var quotaErr *common.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		writeQuotaHeaders(w, quotaErr)
+	}
+
+	status, text := counterErrorStatus(err, message)
+	http.Error(w, text, status)
+
+	return true
+}
+
+// counterErrorStatus maps a counter operation error to the HTTP status and message returned to the caller.
+// The message is used for the unexpected errors
+func counterErrorStatus(err error, message string) (int, string) {
+	switch {
+	case errors.Is(err, common.ErrCounterNotFound):
+		return http.StatusNotFound, "Counter not found"
+	case errors.Is(err, common.ErrDefaultCounter):
+		return http.StatusBadRequest, "Operation not allowed on the default counter"
+	case errors.Is(err, common.ErrInvalidBounds), errors.Is(err, common.ErrInvalidWindow), errors.Is(err, common.ErrInvalidACL):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, common.ErrCounterValueMismatch):
+		return http.StatusPreconditionFailed, "Counter value does not match If-Match"
+	case errors.Is(err, common.ErrCounterOverflow), errors.Is(err, common.ErrCounterUnderflow),
+		errors.Is(err, common.ErrCounterOutOfBounds):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, common.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, "Increment quota exceeded"
+	case errors.Is(err, common.ErrNothingToRestore):
+		return http.StatusNotFound, "No reset to restore"
+	default:
+		return http.StatusInternalServerError, message
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func namedCounterRequest(method string, target string, name string, token string, body interface{}) *http.Request {
+	req := groupRequest(method, target, token, body)
+	req.SetPathValue("name", name)
+
+	return req
+}
+
+func TestHandleCounters(t *testing.T) {
+	s := setupServer(t)
+	adminToken := loginToken(t, s, "admin", "admin123")
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	_ = s.store.SaveUser("bob", "pass", "user")
+	bobToken := loginToken(t, s, "bob", "pass")
+
+	t.Run("should reject invalid names", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{Name: "Bad Name"}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should create and list counters", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{Name: "visits", Description: "page visits"}))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var info common.CounterInfo
+		_ = json.Unmarshal(rr.Body.Bytes(), &info)
+		assert.Equal(t, "visits", info.Name)
+		assert.Equal(t, "alice", info.CreatedBy)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{Name: "visits"}))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounters(rr, httptest.NewRequest("GET", "/counters", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var counters []common.CounterInfo
+		_ = json.Unmarshal(rr.Body.Bytes(), &counters)
+		require.Len(t, counters, 2)
+		assert.Equal(t, common.DefaultCounterName, counters[0].Name)
+		assert.Equal(t, "visits", counters[1].Name)
+	})
+
+	t.Run("should increment, get and reset a named counter", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/visits", "visits", bobToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("GET", "/counters/visits", "visits", "", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		unique := uint64(1)
+		assert.Equal(t, CounterResponse{Name: "visits", Value: 1, Unique: &unique}, resp)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, httptest.NewRequest("GET", "/counter", nil))
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Zero(t, resp.Value)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterReset(rr, namedCounterRequest("POST", "/counters/visits/reset", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterReset(rr, namedCounterRequest("POST", "/counters/visits/reset", "visits", adminToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("missing counter should return 404", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("GET", "/counters/missing", "missing", "", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("only the creator or an admin can delete", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("DELETE", "/counters/visits", "visits", bobToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("DELETE", "/counters/visits", "visits", aliceToken, nil))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("DELETE", "/counters/default", common.DefaultCounterName, adminToken, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should apply signed deltas", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", bobToken, CounterDeltaRequest{Delta: int64Ptr(5)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, uint64(5), resp.Value)
+		require.NotNil(t, resp.Previous)
+		assert.Zero(t, *resp.Previous)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", bobToken, CounterDeltaRequest{Delta: int64Ptr(-2)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, uint64(3), resp.Value)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", bobToken, CounterDeltaRequest{Delta: int64Ptr(-4)}))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", bobToken, CounterDeltaRequest{Delta: int64Ptr(0)}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should enforce the counter bounds", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{Name: "seats", Max: uint64Ptr(2)}))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/seats", "seats", bobToken, CounterDeltaRequest{Delta: int64Ptr(3)}))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterBounds(rr, namedCounterRequest("PUT", "/counters/seats/bounds", "seats", bobToken, CounterBoundsRequest{Max: uint64Ptr(3)}))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterBounds(rr, namedCounterRequest("PUT", "/counters/seats/bounds", "seats", aliceToken, CounterBoundsRequest{Min: uint64Ptr(4), Max: uint64Ptr(3)}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterBounds(rr, namedCounterRequest("PUT", "/counters/seats/bounds", "seats", aliceToken, CounterBoundsRequest{Max: uint64Ptr(3)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var info common.CounterInfo
+		_ = json.Unmarshal(rr.Body.Bytes(), &info)
+		assert.Equal(t, uint64Ptr(3), info.Max)
+
+		rr = httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/seats", "seats", bobToken, CounterDeltaRequest{Delta: int64Ptr(3)}))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func uint64Ptr(value uint64) *uint64 {
+	return &value
+}
+
+func TestHandleCounter_ConditionalRequests(t *testing.T) {
+	s := setupServer(t)
+	adminToken := loginToken(t, s, "admin", "admin123")
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	conditional := func(method string, token string, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		req := groupRequest(method, "/counter", token, body)
+		if len(ifMatch) > 0 {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, req)
+
+		return rr
+	}
+
+	t.Run("should expose the value as an ETag", func(t *testing.T) {
+		_, _ = s.store.AddToCounter(common.DefaultCounterName, 3, "")
+
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, httptest.NewRequest("GET", "/counter", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("should increment only if the value matches", func(t *testing.T) {
+		rr := conditional("POST", aliceToken, `"2"`, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		rr = conditional("POST", aliceToken, `W/"3"`, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		rr = conditional("POST", aliceToken, `"3"`, CounterDeltaRequest{Delta: int64Ptr(2)})
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"5"`, rr.Header().Get("ETag"))
+
+		rr = conditional("POST", aliceToken, "*", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"6"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("should set the value under compare and swap", func(t *testing.T) {
+		rr := conditional("PUT", aliceToken, `"6"`, SetCounterRequest{Value: uint64Ptr(100)})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = conditional("PUT", adminToken, "", SetCounterRequest{Value: uint64Ptr(100)})
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+		rr = conditional("PUT", adminToken, `"5"`, SetCounterRequest{Value: uint64Ptr(100)})
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		rr = conditional("PUT", adminToken, `"6"`, SetCounterRequest{Value: uint64Ptr(100)})
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, uint64(100), resp.Value)
+		assert.Equal(t, uint64Ptr(6), resp.Previous)
+	})
+
+	t.Run("should reset only if the value matches", func(t *testing.T) {
+		rr := conditional("DELETE", adminToken, `"6"`, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		rr = conditional("DELETE", adminToken, `"100"`, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"0"`, rr.Header().Get("ETag"))
+	})
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"FullStackApp01/common"
+)
+
+var groupNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// GroupRequest is the DTO used to create or update a group
+type GroupRequest struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// GroupMemberRequest is the DTO used to add a member to a group
+type GroupMemberRequest struct {
+	Username string `json:"username"`
+}
+
+// effectiveRoles returns the union of the user's own role and the roles of all its groups
+func effectiveRoles(store Storage, user *common.User) ([]string, error) {
+	groups, err := store.GetUserGroups(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	set := map[string]struct{}{user.Role: {}}
+	for _, group := range groups {
+		for _, role := range group.Roles {
+			set[role] = struct{}{}
+		}
+	}
+
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+// HandleGroups lists (GET) or creates (POST) groups. Admin only
+func (s *Server) HandleGroups(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			groups, err := store.ListGroups()
+			if err != nil {
+				http.Error(w, "Failed to list groups", http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(groups)
+		})
+	case http.MethodPost:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var req GroupRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if !groupNamePattern.MatchString(req.Name) {
+				http.Error(w, "Invalid group name", http.StatusBadRequest)
+				return
+			}
+
+			err = store.CreateGroup(req.Name, req.Roles)
+			if errors.Is(err, common.ErrGroupAlreadyExists) {
+				http.Error(w, "Group already exists", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Could not create group", http.StatusInternalServerError)
+				return
+			}
+
+			log.Debug("group created", "group", req.Name, "roles", req.Roles)
+			writeGroup(w, store, req.Name, http.StatusCreated)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleGroup retrieves (GET), updates the roles of (PUT) or deletes (DELETE) the group named in the path. Admin only
+func (s *Server) HandleGroup(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			writeGroup(w, store, name, http.StatusOK)
+		})
+	case http.MethodPut:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var req GroupRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			err = store.UpdateGroupRoles(name, req.Roles)
+			if writeGroupError(w, err, "Could not update group") {
+				return
+			}
+
+			log.Debug("group updated", "group", name, "roles", req.Roles)
+			writeGroup(w, store, name, http.StatusOK)
+		})
+	case http.MethodDelete:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			err := store.DeleteGroup(name)
+			if writeGroupError(w, err, "Could not delete group") {
+				return
+			}
+
+			log.Debug("group deleted", "group", name)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleGroupMembers adds (POST) a member to the group or removes (DELETE) the member named in the path. Admin only.
+// The membership changes are reflected in the tokens issued at the next login
+func (s *Server) HandleGroupMembers(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodPost:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var req GroupMemberRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			err = store.AddGroupMember(name, req.Username)
+			if writeGroupError(w, err, "Could not add group member") {
+				return
+			}
+
+			log.Debug("group member added", "group", name, "user", req.Username)
+			writeGroup(w, store, name, http.StatusOK)
+		})
+	case http.MethodDelete:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			username := r.PathValue("username")
+			if len(username) == 0 {
+				http.Error(w, "Username required", http.StatusBadRequest)
+				return
+			}
+
+			err := store.RemoveGroupMember(name, username)
+			if writeGroupError(w, err, "Could not remove group member") {
+				return
+			}
+
+			log.Debug("group member removed", "group", name, "user", username)
+			writeGroup(w, store, name, http.StatusOK)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeGroup(w http.ResponseWriter, store Storage, name string, status int) {
+	group, err := store.GetGroup(name)
+	if writeGroupError(w, err, "Failed to get group") {
+		return
+	}
+
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(group)
+	if err != nil {
+		log.Warn("failed to encode group", "group", name, "error", err)
+	}
+}
+
+// writeGroupError writes the HTTP error matching err and returns true if there was an error
+func writeGroupError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, common.ErrGroupNotFound):
+		http.Error(w, "Group not found", http.StatusNotFound)
+	case errors.Is(err, common.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+
+	return true
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func groupRequest(method string, target string, token string, body interface{}) *http.Request {
+	var buff bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buff).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, target, &buff)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+func TestHandleGroups(t *testing.T) {
+	s := setupServer(t)
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	_ = s.store.SaveUser("member", "pass", "user")
+	userToken := loginToken(t, s, "member", "pass")
+
+	t.Run("should be forbidden for normal users", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleGroups(rr, groupRequest("GET", "/groups", userToken, nil))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should reject invalid group names", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleGroups(rr, groupRequest("POST", "/groups", adminToken, GroupRequest{Name: "bad name"}))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should create and list groups", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleGroups(rr, groupRequest("POST", "/groups", adminToken, GroupRequest{Name: "operators", Roles: []string{"admin"}}))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleGroups(rr, groupRequest("POST", "/groups", adminToken, GroupRequest{Name: "operators"}))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleGroups(rr, groupRequest("GET", "/groups", adminToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var groups []common.Group
+		err := json.Unmarshal(rr.Body.Bytes(), &groups)
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		assert.Equal(t, "operators", groups[0].Name)
+		assert.Equal(t, []string{"admin"}, groups[0].Roles)
+	})
+}
+
+func TestHandleGroup(t *testing.T) {
+	s := setupServer(t)
+	adminToken := loginToken(t, s, "admin", "admin123")
+	_ = s.store.CreateGroup("operators", []string{"user"})
+
+	t.Run("unknown group should return 404", func(t *testing.T) {
+		req := groupRequest("GET", "/groups/missing", adminToken, nil)
+		req.SetPathValue("name", "missing")
+		rr := httptest.NewRecorder()
+		s.HandleGroup(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should update the roles", func(t *testing.T) {
+		req := groupRequest("PUT", "/groups/operators", adminToken, GroupRequest{Roles: []string{"admin"}})
+		req.SetPathValue("name", "operators")
+		rr := httptest.NewRecorder()
+		s.HandleGroup(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		group, err := s.store.GetGroup("operators")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"admin"}, group.Roles)
+	})
+
+	t.Run("should delete", func(t *testing.T) {
+		req := groupRequest("DELETE", "/groups/operators", adminToken, nil)
+		req.SetPathValue("name", "operators")
+		rr := httptest.NewRecorder()
+		s.HandleGroup(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		_, err := s.store.GetGroup("operators")
+		assert.ErrorIs(t, err, common.ErrGroupNotFound)
+	})
+}
+
+func TestGroups_RoleInheritance(t *testing.T) {
+	s := setupServer(t)
+	adminToken := loginToken(t, s, "admin", "admin123")
+	_ = s.store.SaveUser("operator", "pass", "user")
+	_ = s.store.CreateGroup("operators", []string{"admin", "auditor"})
+
+	resetCounter := func(token string) int {
+		req := httptest.NewRequest("DELETE", "/counter", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, resetCounter(loginToken(t, s, "operator", "pass")))
+
+	t.Run("adding an unknown user should return 404", func(t *testing.T) {
+		req := groupRequest("POST", "/groups/operators/members", adminToken, GroupMemberRequest{Username: "ghost"})
+		req.SetPathValue("name", "operators")
+		rr := httptest.NewRecorder()
+		s.HandleGroupMembers(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("members should inherit the group roles", func(t *testing.T) {
+		req := groupRequest("POST", "/groups/operators/members", adminToken, GroupMemberRequest{Username: "Operator"})
+		req.SetPathValue("name", "operators")
+		rr := httptest.NewRecorder()
+		s.HandleGroupMembers(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		token := loginToken(t, s, "operator", "pass")
+		claims := &common.Claims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+			return testKey, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "user", claims.Role)
+		assert.Equal(t, []string{"admin", "auditor", "user"}, claims.Roles)
+
+		assert.Equal(t, http.StatusOK, resetCounter(token))
+	})
+
+	t.Run("removed members should lose the group roles", func(t *testing.T) {
+		req := groupRequest("DELETE", "/groups/operators/members/operator", adminToken, nil)
+		req.SetPathValue("name", "operators")
+		req.SetPathValue("username", "operator")
+		rr := httptest.NewRecorder()
+		s.HandleGroupMembers(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Equal(t, http.StatusForbidden, resetCounter(loginToken(t, s, "operator", "pass")))
+	})
+}
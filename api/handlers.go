@@ -2,8 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,11 +13,12 @@ import (
 	logger "github.com/multiversx/mx-chain-logger-go"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	maxPassLength = 72
+	// hasherRetryAfterSeconds is the Retry-After sent when the password hashing pool is saturated
+	hasherRetryAfterSeconds = 1
 )
 
 var (
@@ -25,33 +28,134 @@ var (
 // Storage defines the interface for persistence operations
 type Storage interface {
 	Close() error
-	GetCounter() (uint64, error)
-	IncrementCounter() (uint64, error)
+	GetCounter(name string) (uint64, error)
+	AddToCounter(name string, delta int64, username string) (common.CounterChange, error)
+	AddToCounterAsVisitor(name string, delta int64, visitorID string) (common.CounterChange, error)
+	CompareAndSwapCounter(name string, expected uint64, value uint64, username string) (common.CounterChange, error)
 	SaveUser(username, password, role string) error
+	RegisterUser(username, password, role string) error
 	GetUser(username string) (*common.User, error)
 	UpdatePassword(username, newPassword string) error
-	ResetCounter() error
+	ResetCounter(name string, username string) (common.CounterChange, error)
+	CompareAndResetCounter(name string, expected uint64, username string) (common.CounterChange, error)
+	GetResetUndo(name string, window time.Duration) (*common.ResetUndo, error)
+	RestoreCounter(name string, username string, window time.Duration) (common.CounterChange, error)
+	CreateCounter(counter common.CounterInfo) error
+	SetCounterBounds(name string, minValue *uint64, maxValue *uint64) error
+	GetCounterInfo(name string) (*common.CounterInfo, error)
+	GetCounterACL(name string) (*common.CounterACL, error)
+	SetCounterACL(acl common.CounterACL) error
+	ListCounters() ([]common.CounterInfo, error)
+	DeleteCounter(name string) error
+	GetCounterHistory(name string, query common.CounterHistoryQuery) ([]common.CounterEvent, error)
+	GetCounterStats(name string, granularity string, from time.Time, to time.Time) ([]common.CounterStat, error)
+	GetUniqueCount(name string) (uint64, error)
+	GetCounterRate(name string, window time.Duration, now time.Time) (*common.CounterRate, error)
+	GetUniqueVisitors(name string, day time.Time) (*common.UniqueVisitors, error)
+	GetLeaderboard(name string, period string, limit int) ([]common.Contribution, error)
+	GetUserContributions(username string) ([]common.UserContributions, error)
+	GetCounterPeriods(name string, query common.CounterHistoryQuery) ([]common.CounterPeriod, error)
+	CreateResetSchedule(schedule common.ResetSchedule) (*common.ResetSchedule, error)
+	ListResetSchedules() ([]common.ResetSchedule, error)
+	DeleteResetSchedule(id string) error
+	RunResetSchedule(id string, now time.Time) (*common.CounterPeriod, error)
+	CreateWebhook(hook common.Webhook) (*common.Webhook, error)
+	GetWebhook(id string) (*common.Webhook, error)
+	ListWebhooks() ([]common.Webhook, error)
+	DeleteWebhook(id string) error
+	GetWebhookDeliveries(id string, after string, limit int) ([]common.WebhookDelivery, error)
+	DueWebhookDeliveries(now time.Time, limit int) ([]common.WebhookDelivery, error)
+	CompleteWebhookAttempt(hookID string, deliveryID string, attempt common.WebhookAttempt, retryAt time.Time) error
+	SetRoleQuota(role string, quota *common.Quota) error
+	ListRoleQuotas() (map[string]common.Quota, error)
+	SetUserQuota(username string, quota *common.Quota) error
+	GetQuotaStatus(username string) (*common.QuotaStatus, error)
+	CreateGroup(name string, roles []string) error
+	GetGroup(name string) (*common.Group, error)
+	ListGroups() ([]common.Group, error)
+	UpdateGroupRoles(name string, roles []string) error
+	DeleteGroup(name string) error
+	AddGroupMember(name string, username string) error
+	RemoveGroupMember(name string, username string) error
+	GetUserGroups(username string) ([]common.Group, error)
+	CreateTenant(tenantID string, name string, adminUsername string, adminPassword string) error
+	GetTenant(tenantID string) (*common.Tenant, error)
+	ListTenants() ([]common.Tenant, error)
+	BootstrapAdmin(username string, password string, resetPassword bool) (bool, error)
+	HasAdmin() (bool, error)
+	BeginIdempotentRequest(username string, key string, fingerprint string, lockTTL time.Duration) (*common.IdempotencyRecord, error)
+	CompleteIdempotentRequest(username string, key string, record common.IdempotencyRecord) error
+	ReleaseIdempotentRequest(username string, key string) error
+	UseChallenge(id string, expiresAt time.Time) error
+}
+
+// PasswordHasher defines the bounded bcrypt operations. They fail with common.ErrHasherBusy when saturated
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Compare(hash []byte, password string) error
 }
 
 // Server holds dependencies for API handlers
 type Server struct {
-	store   Storage
-	jwtKey  []byte
-	version string
+	store         Storage
+	tenants       TenantStorageProvider
+	jwtKey        []byte
+	version       string
+	usernameRules common.UsernameRules
+	setup         setupGuard
+	// idempotencyTTL is how long the outcome of a request sent with an Idempotency-Key is kept
+	idempotencyTTL    time.Duration
+	hub               *counterHub
+	heartbeatInterval time.Duration
+	webhookClient     *http.Client
+	hasher            PasswordHasher
+	// resetUndoWindow is how long the value cleared by a reset can be restored
+	resetUndoWindow time.Duration
+	// pow is nil when the registration and the login need no proof of work
+	pow *common.ProofOfWork
 }
 
-// NewServer creates a new API server
+// NewServer creates a new API server. The provided store is used for all tenants until
+// a TenantStorageProvider is set
 func NewServer(store Storage, version string, jwtKey []byte) *Server {
+	// the default configuration is always valid
+	hasher, _ := common.NewPasswordHasher(common.DefaultPasswordHasherConfig())
+
 	return &Server{
-		store:   store,
-		jwtKey:  jwtKey,
-		version: version,
+		store: store,
+		tenants: func(_ string) Storage {
+			return store
+		},
+		jwtKey:            jwtKey,
+		version:           version,
+		usernameRules:     common.DefaultUsernameRules(),
+		idempotencyTTL:    DefaultIdempotencyTTL,
+		hub:               newCounterHub(),
+		heartbeatInterval: DefaultHeartbeatInterval,
+		webhookClient:     &http.Client{Timeout: webhookTimeout},
+		hasher:            hasher,
+		resetUndoWindow:   DefaultResetUndoWindow,
 	}
 }
 
+// SetPasswordHasher replaces the pool verifying the passwords. It should be the one the storage hashes them with
+func (s *Server) SetPasswordHasher(hasher PasswordHasher) {
+	s.hasher = hasher
+}
+
+// SetUsernameRules replaces the rules used to validate the usernames on registration
+func (s *Server) SetUsernameRules(rules common.UsernameRules) {
+	s.usernameRules = rules
+}
+
 // CounterResponse is the DTO for counter responses
 type CounterResponse struct {
+	Name  string `json:"name,omitempty"`
 	Value uint64 `json:"value"`
+	// Previous is the value before a mutation
+	Previous *uint64 `json:"previous,omitempty"`
+	// Unique is the estimated number of distinct users and visitors that incremented the counter, set by the queries
+	Unique *uint64 `json:"unique,omitempty"`
 }
 
 // VersionResponse is the DTO for version responses
@@ -67,34 +171,27 @@ type ChangePasswordRequest struct {
 func (s *Server) EnableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS, PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, "+TenantHeader+", "+IdempotencyHeader+", "+VisitorHeader+
+		", "+PoWChallengeHeader+", "+PoWNonceHeader)
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 	w.Header().Set("Content-Type", "application/json")
 }
 
 func (s *Server) Authorized(w http.ResponseWriter, r *http.Request, roles []string, next func()) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
+	if r.Header.Get("Authorization") == "" {
 		http.Error(w, "Authorization header required", http.StatusUnauthorized)
 		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	claims := &common.Claims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return s.jwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
+	claims, err := s.parseClaims(r)
+	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	for _, role := range roles {
-		if claims.Role == role {
-			next()
-			return
-		}
+	if claims.HasAnyRole(roles) {
+		next()
+		return
 	}
 
 	http.Error(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
@@ -102,19 +199,36 @@ func (s *Server) Authorized(w http.ResponseWriter, r *http.Request, roles []stri
 
 // GetUserFromToken extracts the username from the Authorization header
 func (s *Server) GetUserFromToken(r *http.Request) (string, error) {
+	claims, err := s.parseClaims(r)
+	if err != nil {
+		return "", err
+	}
+	return claims.Username, nil
+}
+
+// parseClaims validates the bearer token from the Authorization header and returns its claims
+func (s *Server) parseClaims(r *http.Request) (*common.Claims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", http.ErrNoCookie
+		return nil, http.ErrNoCookie
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	return s.parseToken(strings.TrimPrefix(authHeader, "Bearer "))
+}
+
+// parseToken validates the token and returns its claims
+func (s *Server) parseToken(tokenString string) (*common.Claims, error) {
 	claims := &common.Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return s.jwtKey, nil
 	})
-	if err != nil || !token.Valid {
-		return "", err
+	if err != nil {
+		return nil, err
 	}
-	return claims.Username, nil
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
 }
 
 func (s *Server) HandleRegister(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +241,9 @@ func (s *Server) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.proofOfWork(w, r) {
+		return
+	}
 
 	var creds common.Credentials
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
@@ -134,22 +251,43 @@ func (s *Server) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err := s.usernameRules.Validate(creds.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if len(creds.Password) > maxPassLength {
 		http.Error(w, fmt.Sprintf("Password too long (max %d characters)", maxPassLength), http.StatusBadRequest)
 		return
 	}
 
+	if !s.canRegisterInto(r, creds.Tenant) {
+		http.Error(w, "Registration is only open in the default tenant", http.StatusForbidden)
+		return
+	}
+
+	store, ok := s.tenantStoreOrError(w, creds.Tenant)
+	if !ok {
+		return
+	}
+
 	// Default role is user
-	err := s.store.SaveUser(creds.Username, creds.Password, "user")
+	err = store.RegisterUser(creds.Username, creds.Password, "user")
+	if writeHasherBusy(w, err) {
+		return
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "user already exists") {
+			s.recordPoWFailure(r)
 			http.Error(w, "User already exists", http.StatusConflict)
 			return
 		}
 		http.Error(w, "Could not create user", http.StatusInternalServerError)
 		return
 	}
-	log.Debug("User created successfully", "user", creds.Username)
+	log.Debug("User created successfully", "user", creds.Username, "tenant", creds.Tenant)
+
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -163,6 +301,9 @@ func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.proofOfWork(w, r) {
+		return
+	}
 
 	var creds common.Credentials
 	err := json.NewDecoder(r.Body).Decode(&creds)
@@ -171,22 +312,40 @@ func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.store.GetUser(creds.Username)
+	store, ok := s.tenantStoreOrError(w, creds.Tenant)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(creds.Username)
 	if err != nil {
+		s.recordPoWFailure(r)
 		http.Error(w, "User not found", http.StatusUnauthorized)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword(user.Hash, []byte(creds.Password))
+	err = s.hasher.Compare(user.Hash, creds.Password)
+	if writeHasherBusy(w, err) {
+		return
+	}
 	if err != nil {
+		s.recordPoWFailure(r)
 		http.Error(w, "Invalid password", http.StatusUnauthorized)
 		return
 	}
 
+	roles, err := effectiveRoles(store, user)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &common.Claims{
 		Username: user.Username,
 		Role:     user.Role,
+		Roles:    roles,
+		Tenant:   tenantOrDefault(creds.Tenant),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
@@ -205,7 +364,7 @@ func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug("User logged in successfully", "user", creds.Username)
+	log.Debug("User logged in successfully", "user", creds.Username, "tenant", creds.Tenant)
 }
 
 func (s *Server) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
@@ -238,19 +397,30 @@ func (s *Server) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
 	// Verify old password
-	user, err := s.store.GetUser(username)
+	user, err := store.GetUser(username)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	err = bcrypt.CompareHashAndPassword(user.Hash, []byte(req.OldPassword))
+	err = s.hasher.Compare(user.Hash, req.OldPassword)
+	if writeHasherBusy(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "Invalid old password", http.StatusUnauthorized)
 		return
 	}
 
-	err = s.store.UpdatePassword(username, req.NewPassword)
+	err = store.UpdatePassword(username, req.NewPassword)
+	if writeHasherBusy(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "Could not update password", http.StatusInternalServerError)
 		return
@@ -261,73 +431,15 @@ func (s *Server) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) HandleCounter(w http.ResponseWriter, r *http.Request) {
-	s.EnableCORS(w)
-
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method == http.MethodGet {
-		val, err := s.store.GetCounter()
-		if err != nil {
-			http.Error(w, "Failed to get counter", http.StatusInternalServerError)
-			return
-		}
-
-		err = json.NewEncoder(w).Encode(CounterResponse{Value: val})
-		if err != nil {
-			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
-			return
-		}
-
-		log.Debug("counter query", "value", val)
-
-		return
-	}
-
-	if r.Method == http.MethodPost {
-		// Require at least "user" role (or admin)
-		s.Authorized(w, r, []string{"user", "admin"}, func() {
-			val, err := s.store.IncrementCounter()
-			if err != nil {
-				http.Error(w, "Failed to increment counter", http.StatusInternalServerError)
-				return
-			}
-
-			err = json.NewEncoder(w).Encode(CounterResponse{Value: val})
-			if err != nil {
-				http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
-				return
-			}
-
-			log.Debug("counter incremented", "new value", val)
-		})
-		return
-	}
-
-	if r.Method == http.MethodDelete {
-		// Require "admin" role
-		s.Authorized(w, r, []string{"admin"}, func() {
-			err := s.store.ResetCounter()
-			if err != nil {
-				http.Error(w, "Failed to reset counter", http.StatusInternalServerError)
-				return
-			}
-
-			err = json.NewEncoder(w).Encode(CounterResponse{Value: 0})
-			if err != nil {
-				http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
-				return
-			}
-
-			log.Debug("counter reset", "new value", 0)
-		})
-		return
+// writeHasherBusy answers 503 with a Retry-After header, and returns true, if the password hashing pool is saturated
+func writeHasherBusy(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, common.ErrHasherBusy) {
+		return false
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	w.Header().Set("Retry-After", strconv.Itoa(hasherRetryAfterSeconds))
+	http.Error(w, "Server busy, retry later", http.StatusServiceUnavailable)
+	return true
 }
 
 func (s *Server) HandleVersion(w http.ResponseWriter, _ *http.Request) {
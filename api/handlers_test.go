@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"FullStackApp01/common"
 	"FullStackApp01/mock"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const testVersion = "v1.2.3"
@@ -20,13 +22,50 @@ var testKey = []byte("test_secret")
 
 func setupServer(t *testing.T) *Server {
 	t.Helper()
+	hasher := testHasher(t)
 	store := mock.NewMockStorage()
+	store.SetPasswordHasher(hasher)
 
 	// Ensure admin exists
 	err := store.SaveUser("admin", "admin123", "admin")
 	require.NoError(t, err)
 
-	return NewServer(store, testVersion, testKey)
+	s := NewServer(store, testVersion, testKey)
+	s.SetPasswordHasher(hasher)
+
+	return s
+}
+
+// testHasher hashes with the minimum cost, the default one makes the tests slow, even more so with the race
+// detector. The timeout is generous for the same reason
+func testHasher(t *testing.T) *common.PasswordHasher {
+	t.Helper()
+
+	config := common.DefaultPasswordHasherConfig()
+	config.Cost = bcrypt.MinCost
+	config.Timeout = time.Minute
+	hasher, err := common.NewPasswordHasher(config)
+	require.NoError(t, err)
+
+	return hasher
+}
+
+// loginToken logs in the provided user and returns the issued token
+func loginToken(t *testing.T, s *Server, username string, password string) string {
+	t.Helper()
+
+	creds := common.Credentials{Username: username, Password: password}
+	body, _ := json.Marshal(creds)
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	s.HandleLogin(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp map[string]string
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	require.NoError(t, err)
+
+	return resp["token"]
 }
 
 func TestHandleRegister(t *testing.T) {
@@ -47,6 +86,41 @@ func TestHandleRegister(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "user", user.Role)
 	})
+
+	t.Run("should reject invalid usernames", func(t *testing.T) {
+		for _, username := range []string{"", "  ", "a b c", "Administrator"} {
+			creds := common.Credentials{Username: username, Password: "password"}
+			body, _ := json.Marshal(creds)
+			req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			s.HandleRegister(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, "username %q", username)
+		}
+	})
+
+	t.Run("should reject a username differing only by case", func(t *testing.T) {
+		creds := common.Credentials{Username: "NewUser", Password: "password"}
+		body, _ := json.Marshal(creds)
+		req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		s.HandleRegister(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+// busyHasher is a saturated password hashing pool
+type busyHasher struct{}
+
+func (hasher *busyHasher) Hash(_ string) ([]byte, error) {
+	return nil, common.ErrHasherBusy
+}
+
+func (hasher *busyHasher) Compare(_ []byte, _ string) error {
+	return common.ErrHasherBusy
 }
 
 func TestHandleLogin(t *testing.T) {
@@ -79,6 +153,21 @@ func TestHandleLogin(t *testing.T) {
 
 		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
+
+	t.Run("should answer 503 when the password hashing is saturated", func(t *testing.T) {
+		busy := setupServer(t)
+		busy.SetPasswordHasher(&busyHasher{})
+
+		creds := common.Credentials{Username: "admin", Password: "admin123"}
+		body, _ := json.Marshal(creds)
+		req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		busy.HandleLogin(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	})
 }
 
 func TestHandleCounter(t *testing.T) {
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// CounterHistoryResponse is the DTO holding a page of counter events. NextCursor is set when more events are available
+type CounterHistoryResponse struct {
+	Events     []common.CounterEvent `json:"events"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// HandleCounterHistory returns (GET) the events of the counter named in the path, or of the default counter.
+// The optional query parameters are from and to (RFC 3339, to is exclusive), limit and the cursor of the next page
+func (s *Server) HandleCounterHistory(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+
+	// the events reveal who changed the counter, so the anonymous read permission is not enough
+	s.counterAccess(w, r, store, name, common.PermissionRead, func(claims *common.Claims) {
+		if claims == nil {
+			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			return
+		}
+
+		query, ok := readHistoryQuery(w, r)
+		if !ok {
+			return
+		}
+
+		// one more event tells if there is a next page
+		limit := query.Limit
+		query.Limit++
+		events, err := store.GetCounterHistory(name, query)
+		if writeCounterError(w, err, "Failed to get counter history") {
+			return
+		}
+
+		resp := CounterHistoryResponse{Events: events}
+		if len(events) > limit {
+			resp.Events = events[:limit]
+			resp.NextCursor = strconv.FormatUint(events[limit-1].Seq, 10)
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// readHistoryQuery parses the query parameters of a history request. On error, it writes the response and returns false
+func readHistoryQuery(w http.ResponseWriter, r *http.Request) (common.CounterHistoryQuery, bool) {
+	params := r.URL.Query()
+	query := common.CounterHistoryQuery{Limit: defaultHistoryLimit}
+
+	var err error
+	if value := params.Get("from"); len(value) > 0 {
+		query.From, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from, expected an RFC 3339 time", http.StatusBadRequest)
+			return query, false
+		}
+	}
+	if value := params.Get("to"); len(value) > 0 {
+		query.To, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to, expected an RFC 3339 time", http.StatusBadRequest)
+			return query, false
+		}
+	}
+	if value := params.Get("cursor"); len(value) > 0 {
+		query.After, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return query, false
+		}
+	}
+	if value := params.Get("limit"); len(value) > 0 {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit < 1 || query.Limit > maxHistoryLimit {
+			http.Error(w, "Invalid limit, expected a value between 1 and "+strconv.Itoa(maxHistoryLimit), http.StatusBadRequest)
+			return query, false
+		}
+	}
+
+	return query, true
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterHistory(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	history := func(target string, token string) (int, CounterHistoryResponse) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterHistory(rr, groupRequest("GET", target, token, nil))
+
+		var resp CounterHistoryResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("should require a token", func(t *testing.T) {
+		code, _ := history("/counter/history", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("should paginate with a cursor", func(t *testing.T) {
+		code, resp := history("/counter/history?limit=2", aliceToken)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, resp.Events, 2)
+		assert.Equal(t, "alice", resp.Events[0].Username)
+		assert.Equal(t, common.CounterOperationAdd, resp.Events[0].Operation)
+		assert.Equal(t, "2", resp.NextCursor)
+
+		code, resp = history("/counter/history?limit=2&cursor="+resp.NextCursor, aliceToken)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, resp.Events, 1)
+		assert.Equal(t, uint64(3), resp.Events[0].New)
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("should validate the parameters", func(t *testing.T) {
+		code, _ := history("/counter/history?from=yesterday", aliceToken)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = history("/counter/history?limit=0", aliceToken)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = history("/counter/history?cursor=abc", aliceToken)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("should filter by time", func(t *testing.T) {
+		code, resp := history("/counter/history?from=2100-01-01T00:00:00Z", aliceToken)
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, resp.Events)
+	})
+
+	t.Run("missing counter should return 404", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterHistory(rr, namedCounterRequest("GET", "/counters/missing/history", "missing", aliceToken, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+const (
+	// IdempotencyHeader carries the client generated key that makes a mutating request safe to retry
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader is set on the responses replayed from a previous request with the same key
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyTTL is how long the outcome of a request is kept for replays
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 255
+	// idempotencyLockTTL bounds how long a key stays reserved by a request that never completed
+	idempotencyLockTTL = time.Minute
+)
+
+// replayedHeaders are the response headers stored with the outcome of a request and sent again to its retries
+var replayedHeaders = []string{
+	"Content-Type",
+	"ETag",
+	"Retry-After",
+	RateLimitLimitHeader,
+	RateLimitRemainingHeader,
+	RateLimitResetHeader,
+}
+
+// SetIdempotencyTTL sets how long the outcome of a request sent with an Idempotency-Key is kept
+func (s *Server) SetIdempotencyTTL(ttl time.Duration) {
+	s.idempotencyTTL = ttl
+}
+
+// idempotent runs next only once per user and Idempotency-Key. The outcome is stored and replayed to the
+// retries carrying the same key, while a duplicate arriving before the first request completes gets a 409.
+// Requests without the header or without a valid token are passed through
+func (s *Server) idempotent(w http.ResponseWriter, r *http.Request, store Storage, next func(w http.ResponseWriter)) {
+	key := r.Header.Get(IdempotencyHeader)
+	if len(key) == 0 {
+		next(w)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, fmt.Sprintf("%s too long (max %d characters)", IdempotencyHeader, maxIdempotencyKeyLength), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.parseClaims(r)
+	if err != nil {
+		// the handler rejects the request
+		next(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	fingerprint := requestFingerprint(r, body)
+	existing, err := store.BeginIdempotentRequest(claims.Username, key, fingerprint, idempotencyLockTTL)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		replayIdempotentRequest(w, existing, fingerprint)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next(recorder)
+
+	if recorder.status >= http.StatusInternalServerError {
+		// failures are not replayed, the client can retry with the same key
+		err = store.ReleaseIdempotentRequest(claims.Username, key)
+		log.LogIfError(err)
+		return
+	}
+
+	err = store.CompleteIdempotentRequest(claims.Username, key, common.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      recorder.status,
+		Headers:     recordedHeaders(w.Header()),
+		Body:        recorder.body.Bytes(),
+		ExpiresAt:   time.Now().Add(s.idempotencyTTL).UTC(),
+	})
+	if err != nil {
+		log.Warn("could not store the idempotent request outcome", "user", claims.Username, "error", err)
+	}
+}
+
+func replayIdempotentRequest(w http.ResponseWriter, record *common.IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		http.Error(w, fmt.Sprintf("%s already used for a different request", IdempotencyHeader), http.StatusUnprocessableEntity)
+		return
+	}
+	if !record.Completed {
+		http.Error(w, fmt.Sprintf("A request with the same %s is in progress", IdempotencyHeader), http.StatusConflict)
+		return
+	}
+
+	for name, value := range record.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(IdempotencyReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// recordedHeaders returns the replayed headers set on the response
+func recordedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		value := header.Get(name)
+		if len(value) > 0 {
+			headers[name] = value
+		}
+	}
+
+	return headers
+}
+
+// requestFingerprint identifies the request a key was used for: the method, the path and the body
+func requestFingerprint(r *http.Request, body []byte) string {
+	hasher := sha256.New()
+	_, _ = fmt.Fprintf(hasher, "%s %s\n", r.Method, r.URL.Path)
+	_, _ = hasher.Write(body)
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// responseRecorder writes through to the wrapped writer while keeping a copy of the status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+// WriteHeader records the status and forwards it
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body and forwards it
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(data)
+
+	return rec.ResponseWriter.Write(data)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentCounterRequests(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	increment := func(key string, body interface{}) *httptest.ResponseRecorder {
+		req := groupRequest("POST", "/counter", aliceToken, body)
+		req.Header.Set(IdempotencyHeader, key)
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, req)
+
+		return rr
+	}
+
+	t.Run("retries should replay the first result", func(t *testing.T) {
+		rr := increment("retry-1", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		first := rr.Body.String()
+
+		etag := rr.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		rr = increment("retry-1", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, first, rr.Body.String())
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+		assert.Equal(t, "true", rr.Header().Get(IdempotencyReplayedHeader))
+
+		val, _ := s.store.GetCounter("default")
+		assert.Equal(t, uint64(1), val)
+	})
+
+	t.Run("client errors should be replayed as well", func(t *testing.T) {
+		rr := increment("underflow", CounterDeltaRequest{Delta: int64Ptr(-100)})
+		require.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = increment("underflow", CounterDeltaRequest{Delta: int64Ptr(-100)})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "true", rr.Header().Get(IdempotencyReplayedHeader))
+	})
+
+	t.Run("reusing a key for another request should fail", func(t *testing.T) {
+		rr := increment("reused", CounterDeltaRequest{Delta: int64Ptr(2)})
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = increment("reused", CounterDeltaRequest{Delta: int64Ptr(3)})
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("a duplicate of a request in progress should get a conflict", func(t *testing.T) {
+		req := groupRequest("POST", "/counter", aliceToken, nil)
+		_, err := s.store.BeginIdempotentRequest("alice", "in-progress", requestFingerprint(req, nil), time.Minute)
+		require.NoError(t, err)
+
+		rr := increment("in-progress", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should reject too long keys", func(t *testing.T) {
+		rr := increment(string(make([]byte, maxIdempotencyKeyLength+1)), nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		before, _ := s.store.GetCounter("default")
+		_ = increment("", nil)
+		_ = increment("", nil)
+
+		val, _ := s.store.GetCounter("default")
+		assert.Equal(t, before+2, val)
+	})
+}
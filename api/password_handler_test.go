@@ -17,14 +17,19 @@ import (
 func TestHandleChangePassword(t *testing.T) {
 	setupWithUser := func(t *testing.T) (*Server, string) {
 		t.Helper()
+		hasher := testHasher(t)
 		store := mock.NewMockStorage()
+		store.SetPasswordHasher(hasher)
 
 		username := "changer"
 		password := "oldpass"
 		err := store.SaveUser(username, password, "user")
 		require.NoError(t, err)
 
-		return NewServer(store, testVersion, testKey), username
+		s := NewServer(store, testVersion, testKey)
+		s.SetPasswordHasher(hasher)
+
+		return s, username
 	}
 
 	t.Run("should change password successfully", func(t *testing.T) {
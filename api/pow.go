@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+const (
+	// PoWChallengeHeader carries the challenge returned by HandleChallenge
+	PoWChallengeHeader = "X-PoW-Challenge"
+	// PoWNonceHeader carries the nonce solving the challenge
+	PoWNonceHeader = "X-PoW-Nonce"
+)
+
+// SetProofOfWork requires a solved challenge on registration and login. A nil issuer disables the requirement
+func (s *Server) SetProofOfWork(pow *common.ProofOfWork) {
+	s.pow = pow
+}
+
+// HandleChallenge issues (GET) a proof of work challenge. Its difficulty rises with the failed registrations and
+// logins of the client lately. The solution is sent with the X-PoW-Challenge and X-PoW-Nonce headers and can be used once
+func (s *Server) HandleChallenge(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.pow == nil {
+		http.Error(w, "Proof of work is not enabled", http.StatusNotFound)
+		return
+	}
+
+	challenge, err := s.pow.Issue(clientAddress(r), time.Now())
+	if err != nil {
+		http.Error(w, "Could not issue a challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(challenge)
+}
+
+// proofOfWork checks the request carries an unused solved challenge, if the proof of work is enabled, and marks
+// it as used. Otherwise, it writes the error response and returns false: 428 without a solution, 400 for an invalid
+// one and 409 for a reused one
+func (s *Server) proofOfWork(w http.ResponseWriter, r *http.Request) bool {
+	if s.pow == nil {
+		return true
+	}
+
+	challenge := r.Header.Get(PoWChallengeHeader)
+	nonce := r.Header.Get(PoWNonceHeader)
+	if len(challenge) == 0 || len(nonce) == 0 {
+		http.Error(w, "Proof of work required", http.StatusPreconditionRequired)
+		return false
+	}
+
+	solution, err := s.pow.Verify(challenge, nonce, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	// the challenges are not tied to a tenant, the default tenant storage keeps them all
+	err = s.store.UseChallenge(solution.ID, solution.ExpiresAt)
+	if errors.Is(err, common.ErrChallengeUsed) {
+		http.Error(w, "Proof of work already used", http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// recordPoWFailure raises the difficulty of the next challenges of the client after a failed registration or
+// login, if the proof of work is enabled
+func (s *Server) recordPoWFailure(r *http.Request) {
+	if s.pow != nil {
+		s.pow.RecordFailure(clientAddress(r), time.Now())
+	}
+}
+
+// clientAddress returns the IP address the request comes from. The clients behind the same proxy share it
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleChallenge(t *testing.T) {
+	s := setupServer(t)
+
+	t.Run("should be disabled by default", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleChallenge(rr, httptest.NewRequest("GET", "/challenge", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	pow, err := common.NewProofOfWork(common.ProofOfWorkConfig{MinDifficulty: 8, MaxDifficulty: 8, TTL: time.Minute}, testKey)
+	require.NoError(t, err)
+	s.SetProofOfWork(pow)
+
+	solvedRequest := func(target string, creds common.Credentials, challenge *common.PoWChallenge, nonce string) *http.Request {
+		body, _ := json.Marshal(creds)
+		req := httptest.NewRequest("POST", target, bytes.NewBuffer(body))
+		if challenge != nil {
+			req.Header.Set(PoWChallengeHeader, challenge.Challenge)
+			req.Header.Set(PoWNonceHeader, nonce)
+		}
+		return req
+	}
+	issue := func(t *testing.T) *common.PoWChallenge {
+		rr := httptest.NewRecorder()
+		s.HandleChallenge(rr, httptest.NewRequest("GET", "/challenge", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var challenge common.PoWChallenge
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&challenge))
+		assert.Equal(t, 8, challenge.Difficulty)
+		return &challenge
+	}
+	creds := common.Credentials{Username: "alice", Password: "pass"}
+
+	t.Run("should require a solved challenge to register and login", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleRegister(rr, solvedRequest("/register", creds, nil, ""))
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleLogin(rr, solvedRequest("/login", common.Credentials{Username: "admin", Password: "admin123"}, nil, ""))
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+		challenge := issue(t)
+		unsolved := "0"
+		for common.PoWLeadingZeroBits(challenge.Challenge, unsolved) >= challenge.Difficulty {
+			unsolved += "0"
+		}
+		rr = httptest.NewRecorder()
+		s.HandleRegister(rr, solvedRequest("/register", creds, challenge, unsolved))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleRegister(rr, solvedRequest("/register", creds, challenge, common.SolvePoW(challenge)))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		challenge = issue(t)
+		rr = httptest.NewRecorder()
+		s.HandleLogin(rr, solvedRequest("/login", creds, challenge, common.SolvePoW(challenge)))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject a reused solution", func(t *testing.T) {
+		challenge := issue(t)
+		nonce := common.SolvePoW(challenge)
+
+		rr := httptest.NewRecorder()
+		s.HandleLogin(rr, solvedRequest("/login", creds, challenge, nonce))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleLogin(rr, solvedRequest("/login", creds, challenge, nonce))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should raise the difficulty after the failed logins of the client", func(t *testing.T) {
+		config := common.ProofOfWorkConfig{MinDifficulty: 8, MaxDifficulty: 9, TTL: time.Minute, FailureStep: 1, FailureWindow: time.Minute}
+		failing, err := common.NewProofOfWork(config, testKey)
+		require.NoError(t, err)
+		s.SetProofOfWork(failing)
+		defer s.SetProofOfWork(pow)
+
+		difficulty := func(remoteAddr string) int {
+			req := httptest.NewRequest("GET", "/challenge", nil)
+			req.RemoteAddr = remoteAddr
+			rr := httptest.NewRecorder()
+			s.HandleChallenge(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var challenge common.PoWChallenge
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&challenge))
+			return challenge.Difficulty
+		}
+		assert.Equal(t, 8, difficulty("192.0.2.1:1000"))
+
+		challenge, _ := failing.Issue("192.0.2.1", time.Now())
+		req := solvedRequest("/login", common.Credentials{Username: "alice", Password: "wrong"}, challenge, common.SolvePoW(challenge))
+		req.RemoteAddr = "192.0.2.1:1000"
+		rr := httptest.NewRecorder()
+		s.HandleLogin(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		assert.Equal(t, 9, difficulty("192.0.2.1:2000"))
+		assert.Equal(t, 8, difficulty("192.0.2.2:1000"))
+	})
+}
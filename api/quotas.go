@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// Headers describing the increment quota of the caller, sent when an increment is rejected
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// HandleRoleQuotas lists (GET) the increment quotas by role. With a role in the path, it sets (PUT) or
+// removes (DELETE) the quota of the role. Admin only
+func (s *Server) HandleRoleQuotas(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.PathValue("role")
+	switch {
+	case r.Method == http.MethodGet && len(role) == 0:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			quotas, err := store.ListRoleQuotas()
+			if err != nil {
+				http.Error(w, "Failed to list quotas", http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(quotas)
+		})
+	case r.Method == http.MethodPut && len(role) > 0:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var quota common.Quota
+			err := json.NewDecoder(r.Body).Decode(&quota)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			err = store.SetRoleQuota(role, &quota)
+			if writeQuotaError(w, err, "Could not set quota") {
+				return
+			}
+
+			log.Debug("role quota set", "role", role, "limit", quota.Limit, "period", quota.Period)
+			_ = json.NewEncoder(w).Encode(quota)
+		})
+	case r.Method == http.MethodDelete && len(role) > 0:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			err := store.SetRoleQuota(role, nil)
+			if writeQuotaError(w, err, "Could not remove quota") {
+				return
+			}
+
+			log.Debug("role quota removed", "role", role)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleUserQuota returns (GET) the quota status of the user from the path, or overrides (PUT) its quota whatever
+// its roles. DELETE removes the override. Admin only
+func (s *Server) HandleUserQuota(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	username := r.PathValue("username")
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			status, err := store.GetQuotaStatus(username)
+			if writeQuotaError(w, err, "Failed to get quota") {
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(status)
+		})
+	case http.MethodPut:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var quota common.Quota
+			err := json.NewDecoder(r.Body).Decode(&quota)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			err = store.SetUserQuota(username, &quota)
+			if writeQuotaError(w, err, "Could not set quota") {
+				return
+			}
+			status, err := store.GetQuotaStatus(username)
+			if writeQuotaError(w, err, "Failed to get quota") {
+				return
+			}
+
+			log.Debug("user quota set", "username", username, "limit", quota.Limit, "period", quota.Period)
+			_ = json.NewEncoder(w).Encode(status)
+		})
+	case http.MethodDelete:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			err := store.SetUserQuota(username, nil)
+			if writeQuotaError(w, err, "Could not remove quota") {
+				return
+			}
+
+			log.Debug("user quota removed", "username", username)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleMyQuota returns (GET) the quota status of the caller
+func (s *Server) HandleMyQuota(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	s.Authorized(w, r, []string{"user", "admin"}, func() {
+		username, _ := s.GetUserFromToken(r)
+		status, err := store.GetQuotaStatus(username)
+		if writeQuotaError(w, err, "Failed to get quota") {
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
+
+// writeQuotaHeaders describes the exceeded quota: the limit, what remains and when the window resets,
+// in unix seconds, and how many seconds to wait before retrying
+func writeQuotaHeaders(w http.ResponseWriter, quotaErr *common.QuotaExceededError) {
+	retryAfter := int64(time.Until(quotaErr.ResetAt).Seconds()) + 1
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set(RateLimitLimitHeader, strconv.FormatUint(quotaErr.Limit, 10))
+	w.Header().Set(RateLimitRemainingHeader, strconv.FormatUint(quotaErr.Remaining, 10))
+	w.Header().Set(RateLimitResetHeader, strconv.FormatInt(quotaErr.ResetAt.Unix(), 10))
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+}
+
+// writeQuotaError writes the HTTP error matching err and returns true if there was an error
+func writeQuotaError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, common.ErrInvalidQuota):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, common.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleQuotas(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	_ = s.store.SaveUser("bob", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	bobToken := loginToken(t, s, "bob", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	t.Run("should require the admin role", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleRoleQuotas(rr, groupRequest("GET", "/quotas/roles", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		req := groupRequest("PUT", "/quotas/users/alice", aliceToken, common.Quota{Limit: 1000, Period: common.GranularityDay})
+		req.SetPathValue("username", "alice")
+		s.HandleUserQuota(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should validate the quota", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := groupRequest("PUT", "/quotas/roles/user", adminToken, common.Quota{Limit: 5, Period: "fortnight"})
+		req.SetPathValue("role", "user")
+		s.HandleRoleQuotas(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		req = groupRequest("GET", "/quotas/users/missing", adminToken, nil)
+		req.SetPathValue("username", "missing")
+		s.HandleUserQuota(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should reject the increments over the quota with 429", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := groupRequest("PUT", "/quotas/roles/user", adminToken, common.Quota{Limit: 5, Period: common.GranularityDay})
+		req.SetPathValue("role", "user")
+		s.HandleRoleQuotas(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(4)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(2)}))
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "5", rr.Header().Get(RateLimitLimitHeader))
+		assert.Equal(t, "1", rr.Header().Get(RateLimitRemainingHeader))
+		start, _ := common.BucketStart(time.Now(), common.GranularityDay)
+		assert.Equal(t, strconv.FormatInt(start.Add(24*time.Hour).Unix(), 10), rr.Header().Get(RateLimitResetHeader))
+		retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.True(t, retryAfter > 0 && retryAfter <= 24*60*60+1)
+
+		// the quota is per user
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", bobToken, CounterDeltaRequest{Delta: int64Ptr(2)}))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleMyQuota(rr, groupRequest("GET", "/me/quota", aliceToken, nil))
+		var status common.QuotaStatus
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Equal(t, "role:user", status.Source)
+		assert.Equal(t, uint64(4), status.Used)
+		assert.Equal(t, uint64(1), status.Remaining)
+	})
+
+	t.Run("should let the admin override the quota of a user", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := groupRequest("PUT", "/quotas/users/alice", adminToken, common.Quota{Limit: 100, Period: common.GranularityHour})
+		req.SetPathValue("username", "alice")
+		s.HandleUserQuota(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var status common.QuotaStatus
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Equal(t, "user", status.Source)
+		require.NotNil(t, status.Override)
+		assert.Equal(t, uint64(100), status.Override.Limit)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(10)}))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		req = groupRequest("DELETE", "/quotas/users/alice", adminToken, nil)
+		req.SetPathValue("username", "alice")
+		s.HandleUserQuota(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleRoleQuotas(rr, groupRequest("GET", "/quotas/roles", adminToken, nil))
+		var quotas map[string]common.Quota
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &quotas))
+		assert.Equal(t, map[string]common.Quota{"user": {Limit: 5, Period: common.GranularityDay}}, quotas)
+	})
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// ResetScheduleRequest is the DTO used to create a reset schedule. The counter defaults to the default counter
+// and the time zone to UTC
+type ResetScheduleRequest struct {
+	Counter  string `json:"counter"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+}
+
+// CounterPeriodsResponse is the DTO holding a page of archived counter periods. NextCursor is set when more periods are available
+type CounterPeriodsResponse struct {
+	Periods    []common.CounterPeriod `json:"periods"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// HandleResetSchedules lists (GET) or creates (POST) the counter reset schedules. Admin only
+func (s *Server) HandleResetSchedules(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			schedules, err := store.ListResetSchedules()
+			if err != nil {
+				http.Error(w, "Failed to list schedules", http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(schedules)
+		})
+	case http.MethodPost:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var req ResetScheduleRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil || len(req.Cron) == 0 {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if len(req.Counter) == 0 {
+				req.Counter = common.DefaultCounterName
+			}
+			if len(req.Timezone) == 0 {
+				req.Timezone = "UTC"
+			}
+
+			username, _ := s.GetUserFromToken(r)
+			schedule, err := store.CreateResetSchedule(common.ResetSchedule{
+				Counter:   req.Counter,
+				Cron:      req.Cron,
+				Timezone:  req.Timezone,
+				CreatedBy: username,
+			})
+			if errors.Is(err, common.ErrInvalidSchedule) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if writeCounterError(w, err, "Could not create schedule") {
+				return
+			}
+
+			log.Debug("reset schedule created", "schedule", schedule.ID, "counter", schedule.Counter, "cron", schedule.Cron,
+				"timezone", schedule.Timezone, "next run", schedule.NextRun)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(schedule)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleResetSchedule deletes (DELETE) the reset schedule with the ID from the path. Admin only
+func (s *Server) HandleResetSchedule(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	s.Authorized(w, r, []string{"admin"}, func() {
+		id := r.PathValue("id")
+		err := store.DeleteResetSchedule(id)
+		if errors.Is(err, common.ErrScheduleNotFound) {
+			http.Error(w, "Schedule not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Could not delete schedule", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("reset schedule deleted", "schedule", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleCounterPeriods returns (GET) the archived periods of the counter named in the path, or of the default counter,
+// oldest first. The optional query parameters are from and to (RFC 3339, applied to the period end), limit and the
+// cursor of the next page
+func (s *Server) HandleCounterPeriods(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+	_, ok = s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+
+	query, ok := readHistoryQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// one more period tells if there is a next page
+	limit := query.Limit
+	query.Limit++
+	periods, err := store.GetCounterPeriods(name, query)
+	if writeCounterError(w, err, "Failed to get counter periods") {
+		return
+	}
+
+	resp := CounterPeriodsResponse{Periods: periods}
+	if len(periods) > limit {
+		resp.Periods = periods[:limit]
+		resp.NextCursor = strconv.FormatUint(periods[limit-1].Seq, 10)
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RunScheduledResets runs the reset schedules of all the tenants that are due at now.
+// It is meant to be called periodically, a schedule fires at most once per due time
+func (s *Server) RunScheduledResets(now time.Time) {
+	tenants, err := s.store.ListTenants()
+	if err != nil {
+		log.Warn("could not list the tenants for the scheduled resets", "error", err)
+		return
+	}
+
+	for _, tenant := range tenants {
+		store := s.tenants(tenant.ID)
+		schedules, errList := store.ListResetSchedules()
+		if errList != nil {
+			log.Warn("could not list the reset schedules", "tenant", tenant.ID, "error", errList)
+			continue
+		}
+
+		for _, schedule := range schedules {
+			if now.Before(schedule.NextRun) {
+				continue
+			}
+
+			period, errRun := store.RunResetSchedule(schedule.ID, now)
+			if errRun != nil {
+				log.Warn("scheduled reset skipped", "tenant", tenant.ID, "schedule", schedule.ID, "counter", schedule.Counter, "error", errRun)
+				continue
+			}
+			if period == nil {
+				// already run, concurrently
+				continue
+			}
+
+			s.publishCounterChange(tenant.ID, schedule.Counter, common.CounterOperationReset, "", common.CounterChange{Old: period.Value, New: 0, Seq: period.Seq})
+			log.Info("scheduled reset", "tenant", tenant.ID, "schedule", schedule.ID, "counter", schedule.Counter, "closing value", period.Value)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleResetSchedules(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	t.Run("should require the admin role", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("GET", "/schedules", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should validate the schedule", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("POST", "/schedules", adminToken, ResetScheduleRequest{Cron: "mondays"}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("POST", "/schedules", adminToken, ResetScheduleRequest{Cron: "@weekly", Timezone: "Nowhere"}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("POST", "/schedules", adminToken, ResetScheduleRequest{Counter: "missing", Cron: "@weekly"}))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should create, list and delete schedules", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("POST", "/schedules", adminToken, ResetScheduleRequest{Cron: "0 0 * * MON", Timezone: "Europe/Bucharest"}))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var schedule common.ResetSchedule
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedule))
+		assert.Equal(t, common.DefaultCounterName, schedule.Counter)
+		assert.Equal(t, "admin", schedule.CreatedBy)
+		assert.True(t, schedule.NextRun.After(time.Now()))
+
+		rr = httptest.NewRecorder()
+		s.HandleResetSchedules(rr, groupRequest("GET", "/schedules", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var schedules []common.ResetSchedule
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedules))
+		assert.Len(t, schedules, 1)
+
+		req := groupRequest("DELETE", "/schedules/"+schedule.ID, adminToken, nil)
+		req.SetPathValue("id", schedule.ID)
+		rr = httptest.NewRecorder()
+		s.HandleResetSchedule(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleResetSchedule(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestServer_RunScheduledResets(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	rr := httptest.NewRecorder()
+	s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(9)}))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	schedule, err := s.store.CreateResetSchedule(common.ResetSchedule{Counter: common.DefaultCounterName, Cron: "@daily", Timezone: "UTC"})
+	require.NoError(t, err)
+
+	periods := func(target string) (int, CounterPeriodsResponse) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterPeriods(rr, httptest.NewRequest("GET", target, nil))
+
+		var resp CounterPeriodsResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("should not reset before the due time", func(t *testing.T) {
+		s.RunScheduledResets(time.Now())
+
+		_, resp := periods("/counter/periods")
+		assert.Empty(t, resp.Periods)
+	})
+
+	t.Run("should reset once and archive the period", func(t *testing.T) {
+		subscriber := s.hub.subscribe(common.DefaultTenantID, common.DefaultCounterName)
+		defer s.hub.unsubscribe(subscriber)
+
+		s.RunScheduledResets(schedule.NextRun)
+		s.RunScheduledResets(schedule.NextRun)
+
+		value, _ := s.store.GetCounter(common.DefaultCounterName)
+		assert.Zero(t, value)
+		require.Len(t, subscriber.changes, 1)
+		event := <-subscriber.changes
+		assert.Equal(t, common.CounterOperationReset, event.Operation)
+		assert.Equal(t, uint64(9), event.Old)
+
+		code, resp := periods("/counter/periods")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, resp.Periods, 1)
+		assert.Equal(t, uint64(9), resp.Periods[0].Value)
+		assert.Equal(t, schedule.ID, resp.Periods[0].ScheduleID)
+	})
+
+	t.Run("should list the manual resets as periods too", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("DELETE", "/counter", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		code, resp := periods("/counter/periods?limit=1")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, resp.Periods, 1)
+		require.NotEmpty(t, resp.NextCursor)
+
+		_, resp = periods("/counter/periods?cursor=" + resp.NextCursor)
+		require.Len(t, resp.Periods, 1)
+		assert.Empty(t, resp.Periods[0].ScheduleID)
+		assert.NotNil(t, resp.Periods[0].Start)
+
+		code, _ = periods("/counter/periods?limit=abc")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// SetupRequest is the DTO used to create the initial admin through the first-run setup
+type SetupRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// SetupStatusResponse is the DTO telling if the first-run setup is pending
+type SetupStatusResponse struct {
+	Required bool `json:"required"`
+}
+
+// setupGuard holds the one-time token of the first-run setup
+type setupGuard struct {
+	mu    sync.Mutex
+	token string
+}
+
+// EnableSetup enables the first-run setup endpoint, guarded by the provided one-time token
+func (s *Server) EnableSetup(token string) {
+	s.setup.mu.Lock()
+	s.setup.token = token
+	s.setup.mu.Unlock()
+}
+
+// HandleSetup reports (GET) if the first-run setup is pending or creates (POST) the initial admin of
+// the default tenant. The setup token is consumed on success
+func (s *Server) HandleSetup(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.setup.mu.Lock()
+	defer s.setup.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(SetupStatusResponse{Required: len(s.setup.token) > 0})
+	case http.MethodPost:
+		if len(s.setup.token) == 0 {
+			http.Error(w, "Setup is not available", http.StatusNotFound)
+			return
+		}
+
+		var req SetupRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.setup.token)) != 1 {
+			http.Error(w, "Invalid setup token", http.StatusUnauthorized)
+			return
+		}
+
+		rules := s.usernameRules
+		rules.Reserved = nil
+		err = rules.Validate(req.Username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) == 0 || len(req.Password) > maxPassLength {
+			http.Error(w, fmt.Sprintf("Password should have between 1 and %d characters", maxPassLength), http.StatusBadRequest)
+			return
+		}
+
+		hasAdmin, err := s.store.HasAdmin()
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if hasAdmin {
+			s.setup.token = ""
+			http.Error(w, "An admin already exists", http.StatusConflict)
+			return
+		}
+
+		_, err = s.store.BootstrapAdmin(req.Username, req.Password, false)
+		if writeHasherBusy(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Could not create admin", http.StatusInternalServerError)
+			return
+		}
+
+		s.setup.token = ""
+		log.Info("first-run setup completed", "admin", req.Username)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/mock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSetup(t *testing.T) {
+	setupStatus := func(s *Server) bool {
+		rr := httptest.NewRecorder()
+		s.HandleSetup(rr, httptest.NewRequest("GET", "/setup", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp SetupStatusResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp.Required
+	}
+
+	t.Run("should not be available unless enabled", func(t *testing.T) {
+		s := NewServer(mock.NewMockStorage(), testVersion, testKey)
+		assert.False(t, setupStatus(s))
+
+		rr := httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Username: "root1", Password: "pass"}))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should create the admin once", func(t *testing.T) {
+		s := NewServer(mock.NewMockStorage(), testVersion, testKey)
+		s.EnableSetup("secret-token")
+		assert.True(t, setupStatus(s))
+
+		rr := httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Token: "wrong", Username: "root1", Password: "pass"}))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Token: "secret-token", Username: "a b", Password: "pass"}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Token: "secret-token", Username: "root1", Password: "pass"}))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.False(t, setupStatus(s))
+		assert.NotEmpty(t, loginToken(t, s, "root1", "pass"))
+
+		rr = httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Token: "secret-token", Username: "root2", Password: "pass"}))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should refuse if an admin already exists", func(t *testing.T) {
+		s := setupServer(t)
+		s.EnableSetup("secret-token")
+
+		rr := httptest.NewRecorder()
+		s.HandleSetup(rr, groupRequest("POST", "/setup", "", SetupRequest{Token: "secret-token", Username: "root1", Password: "pass"}))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.False(t, setupStatus(s))
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+const (
+	defaultStatsBuckets = 24
+	maxStatsBuckets     = 1440
+)
+
+// CounterStatsResponse is the DTO holding the zero-filled series of the counter increments
+type CounterStatsResponse struct {
+	Name        string               `json:"name"`
+	Granularity string               `json:"granularity"`
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Points      []common.CounterStat `json:"points"`
+}
+
+// HandleCounterStats returns (GET) the increments of the counter named in the path, or of the default counter,
+// bucketed by granularity (minute, hour or day; hour by default). The optional from and to query parameters
+// (RFC 3339, to is exclusive) default to the last 24 buckets
+func (s *Server) HandleCounterStats(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+	_, ok = s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	granularity := params.Get("granularity")
+	if len(granularity) == 0 {
+		granularity = common.GranularityHour
+	}
+	size, err := common.BucketSize(granularity)
+	if err != nil {
+		http.Error(w, "Invalid granularity, expected minute, hour or day", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := params.Get("to"); len(value) > 0 {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-defaultStatsBuckets * size)
+	if value := params.Get("from"); len(value) > 0 {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/size > maxStatsBuckets {
+		http.Error(w, "Too many points, at most "+strconv.Itoa(maxStatsBuckets)+" are returned", http.StatusBadRequest)
+		return
+	}
+
+	points, err := store.GetCounterStats(name, granularity, from, to)
+	if errors.Is(err, common.ErrInvalidGranularity) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if writeCounterError(w, err, "Failed to get counter statistics") {
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(CounterStatsResponse{
+		Name:        name,
+		Granularity: granularity,
+		From:        from.UTC(),
+		To:          to.UTC(),
+		Points:      points,
+	})
+}
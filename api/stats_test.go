@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterStats(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	rr := httptest.NewRecorder()
+	s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(4)}))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	stats := func(target string) (int, CounterStatsResponse) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterStats(rr, httptest.NewRequest("GET", target, nil))
+
+		var resp CounterStatsResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("should default to the last 24 hours", func(t *testing.T) {
+		code, resp := stats("/counter/stats")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "hour", resp.Granularity)
+		assert.Len(t, resp.Points, 25)
+		assert.Equal(t, uint64(4), resp.Points[len(resp.Points)-1].Increments)
+	})
+
+	t.Run("should return a zero-filled range", func(t *testing.T) {
+		code, resp := stats("/counter/stats?granularity=minute&from=2024-05-01T10:00:00Z&to=2024-05-01T11:00:00Z")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, resp.Points, 60)
+		for _, point := range resp.Points {
+			assert.Zero(t, point.Increments)
+		}
+	})
+
+	t.Run("should validate the parameters", func(t *testing.T) {
+		code, _ := stats("/counter/stats?granularity=week")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = stats("/counter/stats?from=2024-05-02T00:00:00Z&to=2024-05-01T00:00:00Z")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = stats("/counter/stats?granularity=minute&from=2024-01-01T00:00:00Z&to=2024-05-01T00:00:00Z")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often an idle stream receives a heartbeat comment
+	DefaultHeartbeatInterval = 15 * time.Second
+
+	// subscriberBufferSize bounds the changes queued for a slow stream before it is dropped
+	subscriberBufferSize = 64
+	// resumePageSize is how many history events are read at once while replaying the changes missed by a
+	// stream resumed with Last-Event-ID
+	resumePageSize = 1000
+)
+
+// CounterStreamEvent is the DTO pushed to the counter streams on every counter change
+type CounterStreamEvent struct {
+	Name      string `json:"name"`
+	Operation string `json:"operation,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Value     uint64 `json:"value"`
+	Previous  uint64 `json:"previous"`
+}
+
+// counterSubscriber receives the changes of one counter of one tenant
+type counterSubscriber struct {
+	tenant  string
+	counter string
+	changes chan common.CounterEvent
+}
+
+// counterHub fans out the counter changes to the subscribers. Close ends all the subscriptions
+type counterHub struct {
+	mu          sync.Mutex
+	subscribers map[*counterSubscriber]struct{}
+	closed      bool
+	// done is closed together with the hub
+	done chan struct{}
+}
+
+func newCounterHub() *counterHub {
+	return &counterHub{
+		subscribers: make(map[*counterSubscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// subscribe registers a subscriber for the counter. It returns nil if the hub is closed
+func (hub *counterHub) subscribe(tenant string, counter string) *counterSubscriber {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if hub.closed {
+		return nil
+	}
+
+	subscriber := &counterSubscriber{
+		tenant:  tenant,
+		counter: counter,
+		changes: make(chan common.CounterEvent, subscriberBufferSize),
+	}
+	hub.subscribers[subscriber] = struct{}{}
+
+	return subscriber
+}
+
+// unsubscribe removes the subscriber and closes its channel, if not already done
+func (hub *counterHub) unsubscribe(subscriber *counterSubscriber) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	_, found := hub.subscribers[subscriber]
+	if found {
+		delete(hub.subscribers, subscriber)
+		close(subscriber.changes)
+	}
+}
+
+// publish sends the event to the subscribers of the counter. It never blocks: a subscriber whose buffer
+// is full is dropped, its channel is closed and the client is expected to resume with Last-Event-ID
+func (hub *counterHub) publish(tenant string, counter string, event common.CounterEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for subscriber := range hub.subscribers {
+		if subscriber.tenant != tenant || subscriber.counter != counter {
+			continue
+		}
+
+		select {
+		case subscriber.changes <- event:
+		default:
+			log.Debug("dropping a slow counter subscriber", "tenant", tenant, "counter", counter)
+			delete(hub.subscribers, subscriber)
+			close(subscriber.changes)
+		}
+	}
+}
+
+// Close ends all the subscriptions and rejects the new ones
+func (hub *counterHub) Close() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if hub.closed {
+		return
+	}
+
+	hub.closed = true
+	close(hub.done)
+	for subscriber := range hub.subscribers {
+		delete(hub.subscribers, subscriber)
+		close(subscriber.changes)
+	}
+}
+
+// CloseStreams ends the open counter streams and WebSocket connections so the HTTP server can shut down. It is meant to be
+// registered with http.Server.RegisterOnShutdown
+func (s *Server) CloseStreams() {
+	s.hub.Close()
+}
+
+// publishCounterChange notifies the subscribers of the tenant's counter of a successful change
+func (s *Server) publishCounterChange(tenant string, name string, operation string, username string, change common.CounterChange) {
+	s.hub.publish(tenant, name, common.CounterEvent{
+		Seq:       change.Seq,
+		Timestamp: time.Now().UTC(),
+		Username:  username,
+		Operation: operation,
+		Old:       change.Old,
+		New:       change.New,
+	})
+}
+
+// HandleCounterStream pushes (GET) the changes of the counter named in the path, or of the default counter,
+// as Server-Sent Events. The event ids are the counter history sequences, so a client reconnecting with
+// Last-Event-ID first receives the changes it missed. A heartbeat comment is sent while idle.
+// As for the history, only the authenticated callers see who changed the counter
+func (s *Server) HandleCounterStream(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+	claims, ok := s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+	withUsername := claims != nil
+
+	var lastSeq uint64
+	resume := len(r.Header.Get("Last-Event-ID")) > 0
+	if resume {
+		var err error
+		lastSeq, err = strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// subscribe first so no change is lost between the initial state and the live events
+	subscriber := s.hub.subscribe(s.requestTenant(r), name)
+	if subscriber == nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.hub.unsubscribe(subscriber)
+
+	value, err := store.GetCounter(name)
+	if writeCounterError(w, err, "Failed to get counter") {
+		return
+	}
+	var missed []common.CounterEvent
+	if resume {
+		missed, err = store.GetCounterHistory(name, common.CounterHistoryQuery{After: lastSeq, Limit: resumePageSize})
+		if writeCounterError(w, err, "Failed to get counter history") {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if resume {
+		// page through the history until caught up, the live changes queued meanwhile are skipped if already sent
+		for len(missed) > 0 {
+			for _, event := range missed {
+				writeStreamEvent(w, name, event, withUsername)
+				lastSeq = event.Seq
+			}
+			if len(missed) < resumePageSize {
+				break
+			}
+			flusher.Flush()
+
+			missed, err = store.GetCounterHistory(name, common.CounterHistoryQuery{After: lastSeq, Limit: resumePageSize})
+			if err != nil {
+				// the client resumes again from the last event it received
+				log.Debug("could not page the counter history", "counter", name, "error", err)
+				return
+			}
+		}
+	} else {
+		// the initial state carries no id, the client resumes from the first change it receives
+		writeStreamEvent(w, name, common.CounterEvent{Old: value, New: value}, withUsername)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-subscriber.changes:
+			if !open {
+				return
+			}
+			if event.Seq <= lastSeq {
+				// already sent while resuming
+				continue
+			}
+			writeStreamEvent(w, name, event, withUsername)
+			lastSeq = event.Seq
+			flusher.Flush()
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamEvent writes the counter change as an SSE event. The events without a sequence have no id
+func writeStreamEvent(w http.ResponseWriter, name string, event common.CounterEvent, withUsername bool) {
+	streamEvent := CounterStreamEvent{
+		Name:      name,
+		Operation: event.Operation,
+		Value:     event.New,
+		Previous:  event.Old,
+	}
+	if withUsername {
+		streamEvent.Username = event.Username
+	}
+
+	data, err := json.Marshal(streamEvent)
+	if err != nil {
+		return
+	}
+
+	if event.Seq > 0 {
+		_, _ = fmt.Fprintf(w, "id: %d\n", event.Seq)
+	}
+	_, _ = fmt.Fprintf(w, "event: counter\ndata: %s\n\n", data)
+}
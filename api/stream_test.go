@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openStream connects anonymously to the counter stream and returns a reader over its lines
+func openStream(t *testing.T, url string, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	return openStreamAs(t, url, "", lastEventID)
+}
+
+// openStreamAs connects to the counter stream with the token, if any, and returns a reader over its lines
+func openStreamAs(t *testing.T, url string, token string, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return bufio.NewReader(resp.Body), func() {
+		_ = resp.Body.Close()
+	}
+}
+
+// readStreamFrame reads the lines of the next SSE frame
+func readStreamFrame(t *testing.T, reader *bufio.Reader) []string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestHandleCounterStream(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/counter/stream", s.HandleCounterStream)
+	mux.HandleFunc("/counters/{name}/stream", s.HandleCounterStream)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	increment := func() {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	t.Run("should push the current value and the live changes", func(t *testing.T) {
+		reader, closeStream := openStreamAs(t, srv.URL+"/counter/stream", aliceToken, "")
+		defer closeStream()
+
+		frame := readStreamFrame(t, reader)
+		assert.Equal(t, []string{"event: counter", `data: {"name":"default","value":0,"previous":0}`}, frame)
+
+		increment()
+		frame = readStreamFrame(t, reader)
+		assert.Equal(t, []string{
+			"id: 1",
+			"event: counter",
+			`data: {"name":"default","operation":"add","username":"alice","value":1,"previous":0}`,
+		}, frame)
+	})
+
+	t.Run("should hide the usernames from the anonymous callers", func(t *testing.T) {
+		reader, closeStream := openStream(t, srv.URL+"/counter/stream", "0")
+		defer closeStream()
+
+		assert.Equal(t, []string{
+			"id: 1",
+			"event: counter",
+			`data: {"name":"default","operation":"add","value":1,"previous":0}`,
+		}, readStreamFrame(t, reader))
+
+		increment()
+		assert.Equal(t, []string{
+			"id: 2",
+			"event: counter",
+			`data: {"name":"default","operation":"add","value":2,"previous":1}`,
+		}, readStreamFrame(t, reader))
+	})
+
+	t.Run("should resume from Last-Event-ID", func(t *testing.T) {
+		increment()
+		increment()
+
+		reader, closeStream := openStream(t, srv.URL+"/counter/stream", "2")
+		defer closeStream()
+
+		assert.Equal(t, "id: 3", readStreamFrame(t, reader)[0])
+		assert.Equal(t, "id: 4", readStreamFrame(t, reader)[0])
+
+		increment()
+		assert.Equal(t, "id: 5", readStreamFrame(t, reader)[0])
+	})
+
+	t.Run("should replay more than one page of missed changes", func(t *testing.T) {
+		_ = s.store.CreateCounter(common.CounterInfo{Name: "busy"})
+		for i := 0; i < resumePageSize+5; i++ {
+			_, err := s.store.AddToCounter("busy", 1, "alice")
+			require.NoError(t, err)
+		}
+
+		reader, closeStream := openStream(t, srv.URL+"/counters/busy/stream", "0")
+		defer closeStream()
+
+		for seq := 1; seq <= resumePageSize+5; seq++ {
+			require.Equal(t, fmt.Sprintf("id: %d", seq), readStreamFrame(t, reader)[0])
+		}
+	})
+
+	t.Run("should validate the request", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/counters/missing/stream")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		req, _ := http.NewRequest("GET", srv.URL+"/counter/stream", nil)
+		req.Header.Set("Last-Event-ID", "abc")
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestHandleCounterStream_HeartbeatAndClose(t *testing.T) {
+	s := setupServer(t)
+	s.heartbeatInterval = 10 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(s.HandleCounterStream))
+	defer srv.Close()
+
+	reader, closeStream := openStream(t, srv.URL, "")
+	defer closeStream()
+	_ = readStreamFrame(t, reader)
+
+	t.Run("should send heartbeats while idle", func(t *testing.T) {
+		assert.Equal(t, []string{": heartbeat"}, readStreamFrame(t, reader))
+	})
+
+	t.Run("should end the streams on close", func(t *testing.T) {
+		s.CloseStreams()
+
+		for {
+			_, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+		}
+
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+func TestCounterHub_DropsSlowSubscribers(t *testing.T) {
+	hub := newCounterHub()
+	slow := hub.subscribe("", "default")
+	other := hub.subscribe("", "visits")
+
+	for i := 0; i <= subscriberBufferSize; i++ {
+		hub.publish("", "default", common.CounterEvent{Seq: uint64(i + 1)})
+	}
+
+	count := 0
+	for range slow.changes {
+		count++
+	}
+	assert.Equal(t, subscriberBufferSize, count)
+	assert.Empty(t, other.changes)
+
+	hub.unsubscribe(slow)
+	hub.unsubscribe(other)
+	_, open := <-other.changes
+	assert.False(t, open)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"FullStackApp01/common"
+)
+
+// TenantHeader selects the tenant of the requests that do not carry a token, e.g. an anonymous counter query
+const TenantHeader = "X-Tenant-ID"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// TenantStorageProvider returns the storage scoped to the provided tenant
+type TenantStorageProvider func(tenantID string) Storage
+
+// CreateTenantRequest is the DTO used by a super-admin to create a tenant together with its first admin
+type CreateTenantRequest struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password"`
+}
+
+// SetTenantStorageProvider sets the component that scopes the storage to a tenant
+func (s *Server) SetTenantStorageProvider(provider TenantStorageProvider) {
+	s.tenants = provider
+}
+
+// tenantStoreOrError returns the storage of an existing tenant. On error, it writes the response and returns false
+func (s *Server) tenantStoreOrError(w http.ResponseWriter, tenantID string) (Storage, bool) {
+	tenantID = tenantOrDefault(tenantID)
+
+	_, err := s.store.GetTenant(tenantID)
+	if errors.Is(err, common.ErrTenantNotFound) {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to get tenant", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return s.tenants(tenantID), true
+}
+
+// requestStore returns the storage of the caller's tenant: the one from a valid token, then the one
+// from the X-Tenant-ID header, then the default one. On error, it writes the response and returns false
+func (s *Server) requestStore(w http.ResponseWriter, r *http.Request) (Storage, bool) {
+	return s.tenantStoreOrError(w, s.requestTenant(r))
+}
+
+// requestTenant returns the caller's tenant: the one from a valid token, then the one from the X-Tenant-ID
+// header, then the default one. The tenant existence is not checked
+func (s *Server) requestTenant(r *http.Request) string {
+	claims, err := s.parseClaims(r)
+	if err == nil {
+		return claims.TenantID()
+	}
+
+	return tenantOrDefault(r.Header.Get(TenantHeader))
+}
+
+// HandleTenants lists (GET) or creates (POST) tenants. Only the admins of the default tenant (super-admins) are allowed
+func (s *Server) HandleTenants(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.superAdmin(w, r, func() {
+			tenants, err := s.store.ListTenants()
+			if err != nil {
+				http.Error(w, "Failed to list tenants", http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(tenants)
+		})
+	case http.MethodPost:
+		s.superAdmin(w, r, func() {
+			var req CreateTenantRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if !tenantIDPattern.MatchString(req.ID) {
+				http.Error(w, "Invalid tenant id", http.StatusBadRequest)
+				return
+			}
+
+			// reserved names only apply to self registrations
+			rules := s.usernameRules
+			rules.Reserved = nil
+			err = rules.Validate(req.AdminUsername)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(req.AdminPassword) == 0 || len(req.AdminPassword) > maxPassLength {
+				http.Error(w, fmt.Sprintf("Password should have between 1 and %d characters", maxPassLength), http.StatusBadRequest)
+				return
+			}
+
+			err = s.store.CreateTenant(req.ID, req.Name, req.AdminUsername, req.AdminPassword)
+			if writeHasherBusy(w, err) {
+				return
+			}
+			if errors.Is(err, common.ErrTenantAlreadyExists) {
+				http.Error(w, "Tenant already exists", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Could not create tenant", http.StatusInternalServerError)
+				return
+			}
+
+			tenant, err := s.store.GetTenant(req.ID)
+			if err != nil {
+				http.Error(w, "Failed to get tenant", http.StatusInternalServerError)
+				return
+			}
+
+			log.Debug("tenant created", "tenant", req.ID, "admin", req.AdminUsername)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(tenant)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// superAdmin calls next only for the admins of the default tenant
+func (s *Server) superAdmin(w http.ResponseWriter, r *http.Request, next func()) {
+	s.Authorized(w, r, []string{"admin"}, func() {
+		claims, err := s.parseClaims(r)
+		if err != nil || claims.TenantID() != common.DefaultTenantID {
+			http.Error(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		next()
+	})
+}
+
+// canRegisterInto tells whether the caller may register a user in the tenant. Anyone may in the default tenant,
+// the other tenants need the token of one of their admins or of a super-admin
+func (s *Server) canRegisterInto(r *http.Request, tenantID string) bool {
+	tenantID = tenantOrDefault(tenantID)
+	if tenantID == common.DefaultTenantID {
+		return true
+	}
+
+	claims, err := s.parseClaims(r)
+	if err != nil || !claims.HasAnyRole([]string{"admin"}) {
+		return false
+	}
+
+	return claims.TenantID() == tenantID || claims.TenantID() == common.DefaultTenantID
+}
+
+func tenantOrDefault(tenantID string) string {
+	if len(tenantID) == 0 {
+		return common.DefaultTenantID
+	}
+
+	return tenantID
+}
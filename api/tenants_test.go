@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+	"FullStackApp01/mock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTenantServer(t *testing.T) *Server {
+	t.Helper()
+	hasher := testHasher(t)
+	store := mock.NewMockStorage()
+	store.SetPasswordHasher(hasher)
+
+	err := store.SaveUser("admin", "admin123", "admin")
+	require.NoError(t, err)
+
+	s := NewServer(store, testVersion, testKey)
+	s.SetPasswordHasher(hasher)
+	s.SetTenantStorageProvider(func(tenantID string) Storage {
+		return store.ForTenant(tenantID)
+	})
+
+	return s
+}
+
+func loginTenantToken(t *testing.T, s *Server, tenantID string, username string, password string) string {
+	t.Helper()
+
+	req := groupRequest("POST", "/login", "", common.Credentials{Username: username, Password: password, Tenant: tenantID})
+	rr := httptest.NewRecorder()
+	s.HandleLogin(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp map[string]string
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+
+	return resp["token"]
+}
+
+func TestHandleTenants(t *testing.T) {
+	s := setupTenantServer(t)
+	superAdminToken := loginToken(t, s, "admin", "admin123")
+
+	createReq := CreateTenantRequest{
+		ID:            "acme",
+		Name:          "Acme",
+		AdminUsername: "boss",
+		AdminPassword: "bosspass",
+	}
+
+	t.Run("should reject invalid tenant ids", func(t *testing.T) {
+		invalid := createReq
+		invalid.ID = "Not/Valid"
+		rr := httptest.NewRecorder()
+		s.HandleTenants(rr, groupRequest("POST", "/tenants", superAdminToken, invalid))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("super-admin should create tenants", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleTenants(rr, groupRequest("POST", "/tenants", superAdminToken, createReq))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleTenants(rr, groupRequest("POST", "/tenants", superAdminToken, createReq))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleTenants(rr, groupRequest("GET", "/tenants", superAdminToken, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var tenants []common.Tenant
+		_ = json.Unmarshal(rr.Body.Bytes(), &tenants)
+		assert.Len(t, tenants, 2)
+	})
+
+	t.Run("tenant admins are not super-admins", func(t *testing.T) {
+		token := loginTenantToken(t, s, "acme", "boss", "bosspass")
+
+		rr := httptest.NewRecorder()
+		s.HandleTenants(rr, groupRequest("GET", "/tenants", token, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestTenants_Isolation(t *testing.T) {
+	s := setupTenantServer(t)
+	superAdminToken := loginToken(t, s, "admin", "admin123")
+
+	rr := httptest.NewRecorder()
+	s.HandleTenants(rr, groupRequest("POST", "/tenants", superAdminToken, CreateTenantRequest{
+		ID:            "acme",
+		AdminUsername: "boss",
+		AdminPassword: "bosspass",
+	}))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	t.Run("unknown tenant should return 404", func(t *testing.T) {
+		req := groupRequest("POST", "/register", superAdminToken, common.Credentials{Username: "alice", Password: "pass", Tenant: "missing"})
+		rr := httptest.NewRecorder()
+		s.HandleRegister(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should only let the admins register users in a named tenant", func(t *testing.T) {
+		creds := common.Credentials{Username: "mallory", Password: "pass", Tenant: "acme"}
+		rr := httptest.NewRecorder()
+		s.HandleRegister(rr, groupRequest("POST", "/register", "", creds))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleRegister(rr, groupRequest("POST", "/register", "", common.Credentials{Username: "mallory", Password: "pass"}))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleRegister(rr, groupRequest("POST", "/register", loginToken(t, s, "mallory", "pass"), creds))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("users should be scoped to their tenant", func(t *testing.T) {
+		bossToken := loginTenantToken(t, s, "acme", "boss", "bosspass")
+		req := groupRequest("POST", "/register", bossToken, common.Credentials{Username: "alice", Password: "pass", Tenant: "acme"})
+		rr := httptest.NewRecorder()
+		s.HandleRegister(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		req = groupRequest("POST", "/login", "", common.Credentials{Username: "alice", Password: "pass"})
+		rr = httptest.NewRecorder()
+		s.HandleLogin(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("counters should be scoped to their tenant", func(t *testing.T) {
+		token := loginTenantToken(t, s, "acme", "alice", "pass")
+
+		req := httptest.NewRequest("POST", "/counter", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		readCounter := func(tenantID string) uint64 {
+			req := httptest.NewRequest("GET", "/counter", nil)
+			req.Header.Set(TenantHeader, tenantID)
+			rr := httptest.NewRecorder()
+			s.HandleCounter(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var resp CounterResponse
+			_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+			return resp.Value
+		}
+
+		assert.Equal(t, uint64(1), readCounter("acme"))
+		assert.Zero(t, readCounter(""))
+	})
+}
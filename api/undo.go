@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// DefaultResetUndoWindow is how long the value cleared by a reset can be restored
+const DefaultResetUndoWindow = 15 * time.Minute
+
+// SetResetUndoWindow sets how long the value cleared by a reset can be restored
+func (s *Server) SetResetUndoWindow(window time.Duration) {
+	s.resetUndoWindow = window
+}
+
+// HandleCounterRestore shows (GET) or restores (POST) the value cleared by the last reset of the counter named
+// in the path, or of the default counter. Without any change since the reset the counter gets its value back,
+// otherwise the value is added to the current one. Both need the admin permission on the counter
+func (s *Server) HandleCounterRestore(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.counterAccess(w, r, store, name, common.PermissionAdmin, func(_ *common.Claims) {
+			undo, err := store.GetResetUndo(name, s.resetUndoWindow)
+			if writeCounterError(w, err, "Failed to get the reset to restore") {
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(undo)
+		})
+	case http.MethodPost:
+		s.idempotent(w, r, store, func(w http.ResponseWriter) {
+			s.restoreCounter(w, r, store, name)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) restoreCounter(w http.ResponseWriter, r *http.Request, store Storage, name string) {
+	s.counterAccess(w, r, store, name, common.PermissionAdmin, func(claims *common.Claims) {
+		username := callerName(claims)
+		change, err := store.RestoreCounter(name, username, s.resetUndoWindow)
+		if writeCounterError(w, err, "Failed to restore counter") {
+			return
+		}
+		s.publishCounterChange(s.requestTenant(r), name, common.CounterOperationRestore, username, change)
+
+		w.Header().Set("ETag", counterETag(change.New))
+		err = json.NewEncoder(w).Encode(CounterResponse{Name: name, Value: change.New, Previous: &change.Old})
+		if err != nil {
+			http.Error(w, "Failed to encode counter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Debug("counter restored", "counter", name, "old value", change.Old, "new value", change.New)
+	})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterRestore(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	t.Run("should report a missing reset with 404", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("POST", "/counter/restore", adminToken, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should require the admin role", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("POST", "/counter/restore", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("GET", "/counter/restore", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should restore the value cleared by the reset", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(7)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("DELETE", "/counter", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("GET", "/counter/restore", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var undo common.ResetUndo
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&undo))
+		assert.Equal(t, uint64(7), undo.Value)
+		assert.Equal(t, "admin", undo.ResetBy)
+		assert.Equal(t, undo.ResetAt.Add(DefaultResetUndoWindow), undo.ExpiresAt)
+
+		// an increment since the reset is kept
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("POST", "/counter/restore", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, uint64(8), resp.Value)
+		require.NotNil(t, resp.Previous)
+		assert.Equal(t, uint64(1), *resp.Previous)
+		assert.Equal(t, counterETag(8), rr.Header().Get("ETag"))
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("POST", "/counter/restore", adminToken, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should restore a conditional reset", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(3)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		before, _ := s.store.GetCounter(common.DefaultCounterName)
+
+		rr = httptest.NewRecorder()
+		req := groupRequest("DELETE", "/counter", adminToken, nil)
+		req.Header.Set("If-Match", etag)
+		s.HandleCounter(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRestore(rr, groupRequest("POST", "/counter/restore", adminToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		val, _ := s.store.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, before, val)
+	})
+
+	t.Run("should restore the named counter", func(t *testing.T) {
+		_ = s.store.CreateCounter(common.CounterInfo{Name: "visits"})
+		_, _ = s.store.AddToCounter("visits", 4, "alice")
+		_, _ = s.store.ResetCounter("visits", "admin")
+
+		rr := httptest.NewRecorder()
+		req := groupRequest("POST", "/counters/visits/restore", adminToken, nil)
+		req.SetPathValue("name", "visits")
+		s.HandleCounterRestore(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		val, _ := s.store.GetCounter("visits")
+		assert.Equal(t, uint64(4), val)
+
+		rr = httptest.NewRecorder()
+		req = groupRequest("POST", "/counters/missing/restore", adminToken, nil)
+		req.SetPathValue("name", "missing")
+		s.HandleCounterRestore(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// HandleCounterUnique returns (GET) the estimated number of distinct users and visitors that incremented the
+// counter named in the path, or the default counter: all time and, when the daily sketches are kept, for the
+// day, ISO week and month containing the optional date query parameter (YYYY-MM-DD, today by default)
+func (s *Server) HandleCounterUnique(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+	_, ok = s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+
+	day := time.Now().UTC()
+	if value := r.URL.Query().Get("date"); len(value) > 0 {
+		var err error
+		day, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	visitors, err := store.GetUniqueVisitors(name, day)
+	if writeCounterError(w, err, "Failed to get the unique visitors") {
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(visitors)
+}
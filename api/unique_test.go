@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterUnique(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	_ = s.store.SaveUser("bob", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	bobToken := loginToken(t, s, "bob", "pass")
+
+	for _, token := range []string{aliceToken, bobToken, aliceToken} {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", token, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	t.Run("should expose the unique visitors with the counter", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, httptest.NewRequest("GET", "/counter", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp CounterResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, uint64(3), resp.Value)
+		require.NotNil(t, resp.Unique)
+		assert.Equal(t, uint64(2), *resp.Unique)
+	})
+
+	t.Run("should return the estimates of the periods", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterUnique(rr, httptest.NewRequest("GET", "/counter/unique", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var visitors common.UniqueVisitors
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&visitors))
+		assert.Equal(t, uint64(2), visitors.All)
+		assert.Equal(t, time.Now().UTC().Format(time.DateOnly), visitors.Date)
+		require.NotNil(t, visitors.Week)
+		assert.Equal(t, uint64(2), *visitors.Week)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterUnique(rr, httptest.NewRequest("GET", "/counter/unique?date=2020-01-01", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&visitors))
+		assert.Equal(t, uint64(2), visitors.All)
+		assert.Zero(t, *visitors.Month)
+	})
+
+	t.Run("should validate the request", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounterUnique(rr, httptest.NewRequest("GET", "/counter/unique?date=yesterday", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/counters/missing/unique", nil)
+		req.SetPathValue("name", "missing")
+		s.HandleCounterUnique(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
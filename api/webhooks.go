@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256 computed by common.WebhookSignature
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	// webhookBatchSize bounds the deliveries attempted per tenant by one DeliverWebhooks call
+	webhookBatchSize = 100
+	// maxWebhookAttempts is the number of attempts after which a delivery is marked as failed
+	maxWebhookAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// WebhookRequest is the DTO used to create a webhook subscription. A secret is generated when none is provided
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	Events     []string `json:"events"`
+	Counter    string   `json:"counter"`
+	Thresholds []uint64 `json:"thresholds"`
+	Secret     string   `json:"secret"`
+}
+
+// WebhookDeliveriesResponse is the DTO holding a page of the delivery log. NextCursor is set when more deliveries are available
+type WebhookDeliveriesResponse struct {
+	Deliveries []common.WebhookDelivery `json:"deliveries"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// HandleWebhooks lists (GET) or creates (POST) the webhook subscriptions. Admin only.
+// The secret is only returned on creation
+func (s *Server) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			hooks, err := store.ListWebhooks()
+			if err != nil {
+				http.Error(w, "Failed to list webhooks", http.StatusInternalServerError)
+				return
+			}
+
+			for i := range hooks {
+				hooks[i].Secret = ""
+			}
+			_ = json.NewEncoder(w).Encode(hooks)
+		})
+	case http.MethodPost:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			var req WebhookRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			if len(req.Secret) == 0 {
+				req.Secret, err = generateWebhookSecret()
+				if err != nil {
+					http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			username, _ := s.GetUserFromToken(r)
+			hook, err := store.CreateWebhook(common.Webhook{
+				URL:        req.URL,
+				Events:     req.Events,
+				Counter:    req.Counter,
+				Thresholds: req.Thresholds,
+				Secret:     req.Secret,
+				CreatedBy:  username,
+			})
+			if errors.Is(err, common.ErrInvalidWebhook) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+				return
+			}
+
+			log.Debug("webhook created", "webhook", hook.ID, "url", hook.URL, "events", hook.Events)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(hook)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWebhook retrieves (GET) or deletes (DELETE) the webhook subscription with the ID from the path. Admin only
+func (s *Server) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			hook, err := store.GetWebhook(id)
+			if writeWebhookError(w, err, "Failed to get webhook") {
+				return
+			}
+
+			hook.Secret = ""
+			_ = json.NewEncoder(w).Encode(hook)
+		})
+	case http.MethodDelete:
+		s.Authorized(w, r, []string{"admin"}, func() {
+			err := store.DeleteWebhook(id)
+			if writeWebhookError(w, err, "Could not delete webhook") {
+				return
+			}
+
+			log.Debug("webhook deleted", "webhook", id)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWebhookDeliveries returns (GET) the delivery log of the webhook with the ID from the path, oldest first. Admin only.
+// The optional query parameters are limit and the cursor of the next page
+func (s *Server) HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	s.Authorized(w, r, []string{"admin"}, func() {
+		limit := defaultDeliveriesLimit
+		if value := r.URL.Query().Get("limit"); len(value) > 0 {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+				http.Error(w, "Invalid limit, expected a value between 1 and "+strconv.Itoa(maxDeliveriesLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// one more delivery tells if there is a next page
+		deliveries, err := store.GetWebhookDeliveries(r.PathValue("id"), r.URL.Query().Get("cursor"), limit+1)
+		if writeWebhookError(w, err, "Failed to get webhook deliveries") {
+			return
+		}
+
+		resp := WebhookDeliveriesResponse{Deliveries: deliveries}
+		if len(deliveries) > limit {
+			resp.Deliveries = deliveries[:limit]
+			resp.NextCursor = deliveries[limit-1].ID
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// DeliverWebhooks attempts the webhook deliveries of all the tenants that are due at now. A failed attempt is retried
+// with an exponential backoff until maxWebhookAttempts is reached. It is meant to be called periodically
+func (s *Server) DeliverWebhooks(now time.Time) {
+	tenants, err := s.store.ListTenants()
+	if err != nil {
+		log.Warn("could not list the tenants for the webhook deliveries", "error", err)
+		return
+	}
+
+	for _, tenant := range tenants {
+		store := s.tenants(tenant.ID)
+		deliveries, errDue := store.DueWebhookDeliveries(now, webhookBatchSize)
+		if errDue != nil {
+			log.Warn("could not read the webhook outbox", "tenant", tenant.ID, "error", errDue)
+			continue
+		}
+
+		for _, delivery := range deliveries {
+			s.deliverWebhook(store, delivery, now)
+		}
+	}
+}
+
+func (s *Server) deliverWebhook(store Storage, delivery common.WebhookDelivery, now time.Time) {
+	hook, err := store.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		log.Warn("could not get the webhook of a delivery", "webhook", delivery.WebhookID, "delivery", delivery.ID, "error", err)
+		return
+	}
+
+	attempt := s.sendWebhook(hook, delivery)
+	retryAt := time.Time{}
+	if !attempt.Succeeded() && len(delivery.Attempts)+1 < maxWebhookAttempts {
+		retryAt = now.Add(webhookRetryDelay(len(delivery.Attempts) + 1))
+	}
+
+	err = store.CompleteWebhookAttempt(hook.ID, delivery.ID, attempt, retryAt)
+	if err != nil {
+		log.Warn("could not record the webhook attempt", "webhook", hook.ID, "delivery", delivery.ID, "error", err)
+		return
+	}
+
+	log.Debug("webhook attempt", "webhook", hook.ID, "delivery", delivery.ID, "event", delivery.Event.Type,
+		"status", attempt.StatusCode, "error", attempt.Error, "retry at", retryAt)
+}
+
+// sendWebhook posts the signed event to the webhook URL and returns the attempt outcome
+func (s *Server) sendWebhook(hook *common.Webhook, delivery common.WebhookDelivery) common.WebhookAttempt {
+	attempt := common.WebhookAttempt{Timestamp: time.Now().UTC()}
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := attempt.Timestamp.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Event.Type)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+common.WebhookSignature(hook.Secret, timestamp, body))
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	// drain a bounded part of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	attempt.StatusCode = resp.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return attempt
+}
+
+// webhookRetryDelay returns the delay before the next attempt after the provided number of failed attempts,
+// doubling from webhookRetryBase up to webhookRetryMax
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, webhookRetryMax)
+}
+
+func generateWebhookSecret() (string, error) {
+	buff := make([]byte, 32)
+	_, err := rand.Read(buff)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buff), nil
+}
+
+// writeWebhookError writes the HTTP error matching err and returns true if there was an error
+func writeWebhookError(w http.ResponseWriter, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, common.ErrWebhookNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+
+	return true
+}
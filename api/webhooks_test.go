@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the deliveries it receives and answers with the configured status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (receiver *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	receiver.requests = append(receiver.requests, r)
+	receiver.bodies = append(receiver.bodies, body)
+	w.WriteHeader(receiver.status)
+}
+
+func createWebhook(t *testing.T, s *Server, token string, req WebhookRequest) common.Webhook {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	s.HandleWebhooks(rr, groupRequest("POST", "/webhooks", token, req))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var hook common.Webhook
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &hook))
+	return hook
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	t.Run("should require the admin role", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleWebhooks(rr, groupRequest("GET", "/webhooks", aliceToken, nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should validate the subscription", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleWebhooks(rr, groupRequest("POST", "/webhooks", adminToken, WebhookRequest{URL: "ftp://example.com", Events: []string{common.WebhookEventUserRegistered}}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleWebhooks(rr, groupRequest("POST", "/webhooks", adminToken, WebhookRequest{URL: "https://example.com", Events: []string{"counter.deleted"}}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should only return the secret on creation", func(t *testing.T) {
+		hook := createWebhook(t, s, adminToken, WebhookRequest{URL: "https://example.com", Events: []string{common.WebhookEventUserRegistered}})
+		assert.Len(t, hook.Secret, 64)
+
+		rr := httptest.NewRecorder()
+		s.HandleWebhooks(rr, groupRequest("GET", "/webhooks", adminToken, nil))
+		var hooks []common.Webhook
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &hooks))
+		require.Len(t, hooks, 1)
+		assert.Empty(t, hooks[0].Secret)
+
+		req := groupRequest("GET", "/webhooks/"+hook.ID, adminToken, nil)
+		req.SetPathValue("id", hook.ID)
+		rr = httptest.NewRecorder()
+		s.HandleWebhook(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), hook.Secret)
+
+		req = groupRequest("DELETE", "/webhooks/"+hook.ID, adminToken, nil)
+		req.SetPathValue("id", hook.ID)
+		rr = httptest.NewRecorder()
+		s.HandleWebhook(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleWebhook(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestServer_DeliverWebhooks(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	hook := createWebhook(t, s, adminToken, WebhookRequest{
+		URL:        srv.URL,
+		Events:     []string{common.WebhookEventUserRegistered, common.WebhookEventCounterIncremented, common.WebhookEventCounterThreshold},
+		Thresholds: []uint64{3},
+		Secret:     "shared-secret",
+	})
+
+	deliveries := func(target string) WebhookDeliveriesResponse {
+		req := groupRequest("GET", target, adminToken, nil)
+		req.SetPathValue("id", hook.ID)
+		rr := httptest.NewRecorder()
+		s.HandleWebhookDeliveries(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp WebhookDeliveriesResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("should deliver signed events", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleRegister(rr, httptest.NewRequest("POST", "/register", bytes.NewBufferString(`{"username":"bob","password":"password"}`)))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, CounterDeltaRequest{Delta: int64Ptr(3)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		s.DeliverWebhooks(time.Now())
+		require.Len(t, receiver.requests, 3)
+
+		req, body := receiver.requests[0], receiver.bodies[0]
+		assert.Equal(t, common.WebhookEventUserRegistered, req.Header.Get(WebhookEventHeader))
+		timestamp, err := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256="+common.WebhookSignature("shared-secret", timestamp, body), req.Header.Get(WebhookSignatureHeader))
+
+		var event common.WebhookEvent
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "bob", event.Username)
+
+		assert.Equal(t, common.WebhookEventCounterIncremented, receiver.requests[1].Header.Get(WebhookEventHeader))
+		assert.Equal(t, common.WebhookEventCounterThreshold, receiver.requests[2].Header.Get(WebhookEventHeader))
+
+		resp := deliveries("/webhooks/" + hook.ID + "/deliveries")
+		require.Len(t, resp.Deliveries, 3)
+		for _, delivery := range resp.Deliveries {
+			assert.Equal(t, common.WebhookDeliveryDelivered, delivery.Status)
+			assert.Len(t, delivery.Attempts, 1)
+		}
+
+		// nothing left to deliver
+		s.DeliverWebhooks(time.Now())
+		assert.Len(t, receiver.requests, 3)
+	})
+
+	t.Run("should retry with an exponential backoff", func(t *testing.T) {
+		receiver.status = http.StatusServiceUnavailable
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		now := time.Now()
+		s.DeliverWebhooks(now)
+		require.Len(t, receiver.requests, 4)
+
+		s.DeliverWebhooks(now.Add(webhookRetryBase - time.Second))
+		assert.Len(t, receiver.requests, 4)
+
+		receiver.status = http.StatusNoContent
+		s.DeliverWebhooks(now.Add(webhookRetryBase))
+		assert.Len(t, receiver.requests, 5)
+
+		resp := deliveries("/webhooks/" + hook.ID + "/deliveries?limit=3")
+		require.Len(t, resp.Deliveries, 3)
+		require.NotEmpty(t, resp.NextCursor)
+
+		resp = deliveries("/webhooks/" + hook.ID + "/deliveries?cursor=" + resp.NextCursor)
+		require.Len(t, resp.Deliveries, 1)
+		delivery := resp.Deliveries[0]
+		assert.Equal(t, common.WebhookDeliveryDelivered, delivery.Status)
+		require.Len(t, delivery.Attempts, 2)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.Attempts[0].StatusCode)
+		assert.NotEmpty(t, delivery.Attempts[0].Error)
+		assert.Equal(t, http.StatusNoContent, delivery.Attempts[1].StatusCode)
+	})
+
+	t.Run("should give up after the maximum attempts", func(t *testing.T) {
+		srv.Close()
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		now := time.Now()
+		for i := 0; i < maxWebhookAttempts; i++ {
+			s.DeliverWebhooks(now)
+			now = now.Add(webhookRetryMax)
+		}
+
+		resp := deliveries("/webhooks/" + hook.ID + "/deliveries")
+		require.Len(t, resp.Deliveries, 5)
+		delivery := resp.Deliveries[4]
+		assert.Equal(t, common.WebhookDeliveryFailed, delivery.Status)
+		assert.Len(t, delivery.Attempts, maxWebhookAttempts)
+		assert.Nil(t, delivery.NextAttempt)
+	})
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, webhookRetryBase, webhookRetryDelay(1))
+	assert.Equal(t, 2*webhookRetryBase, webhookRetryDelay(2))
+	assert.Equal(t, 8*webhookRetryBase, webhookRetryDelay(4))
+	assert.Equal(t, webhookRetryMax, webhookRetryDelay(30))
+}
@@ -0,0 +1,397 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket message types
+const (
+	// WSMessageSubscribe subscribes the connection to the counter updates and answers with the current value
+	WSMessageSubscribe = "subscribe"
+	// WSMessageIncrement adds the delta (default 1) to the counter and answers with the new value
+	WSMessageIncrement = "increment"
+	// WSMessageReset resets the counter and answers with the new value
+	WSMessageReset = "reset"
+	// WSMessageValue queries the counter. It is also the type of the answers carrying a counter value
+	WSMessageValue = "value"
+	// WSMessageUpdate is pushed to the subscribers on every counter change
+	WSMessageUpdate = "update"
+	// WSMessageError answers a message that failed
+	WSMessageError = "error"
+)
+
+const (
+	// wsMaxMessageSize bounds the size of a message received from the client
+	wsMaxMessageSize = 4096
+	// wsSendBufferSize bounds the messages queued for a connection. A client that does not keep up is disconnected
+	wsSendBufferSize = 64
+	// wsMaxSubscriptions bounds the counters a connection can subscribe to
+	wsMaxSubscriptions = 32
+	wsWriteWait        = 10 * time.Second
+)
+
+// WSRequest is a message sent by the client over the WebSocket connection. The counter defaults to the default counter
+// and the optional ID is echoed in the answer
+type WSRequest struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Counter string `json:"counter,omitempty"`
+	Delta   *int64 `json:"delta,omitempty"`
+}
+
+// WSResponse is a message sent by the server over the WebSocket connection: an answer to a WSRequest,
+// an update of a subscribed counter or an error. Status holds the HTTP status matching the error
+type WSResponse struct {
+	ID        string  `json:"id,omitempty"`
+	Type      string  `json:"type"`
+	Counter   string  `json:"counter,omitempty"`
+	Value     *uint64 `json:"value,omitempty"`
+	Previous  *uint64 `json:"previous,omitempty"`
+	Seq       uint64  `json:"seq,omitempty"`
+	Operation string  `json:"operation,omitempty"`
+	Username  string  `json:"username,omitempty"`
+	Status    int     `json:"status,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{
+	// the API is open to any origin, the same as the CORS headers
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// wsConnection is a WebSocket client. Only the write loop writes the data messages, the connection
+// ends when the read loop ends
+type wsConnection struct {
+	server *Server
+	conn   *websocket.Conn
+	store  Storage
+	tenant string
+	// claims is nil for an anonymous connection
+	claims *common.Claims
+	// visitor identifies an anonymous connection in the unique visitors
+	visitor       string
+	send          chan WSResponse
+	done          chan struct{}
+	closeOnce     sync.Once
+	subscriptions map[string]*counterSubscriber
+}
+
+// HandleWebSocket upgrades the connection to a WebSocket exchanging JSON messages: subscribe, increment, reset and value.
+// The token is read at connect time from the Authorization header or, for the browsers, from the token query parameter.
+// A connection without a token is anonymous. Each message is checked against the counter access control list
+func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	var claims *common.Claims
+	tokenString := r.URL.Query().Get("token")
+	if len(r.Header.Get("Authorization")) > 0 || len(tokenString) > 0 {
+		var err error
+		if len(tokenString) > 0 {
+			claims, err = s.parseToken(tokenString)
+		} else {
+			claims, err = s.parseClaims(r)
+		}
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	tenant := r.Header.Get(TenantHeader)
+	if len(tenant) == 0 {
+		tenant = r.URL.Query().Get("tenant")
+	}
+	if claims != nil {
+		tenant = claims.TenantID()
+	}
+	tenant = tenantOrDefault(tenant)
+	store, ok := s.tenantStoreOrError(w, tenant)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already wrote the error response
+		log.Debug("websocket upgrade failed", "error", err)
+		return
+	}
+
+	c := &wsConnection{
+		server:        s,
+		conn:          conn,
+		store:         store,
+		tenant:        tenant,
+		claims:        claims,
+		visitor:       r.Header.Get(VisitorHeader),
+		send:          make(chan WSResponse, wsSendBufferSize),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]*counterSubscriber),
+	}
+
+	go c.writeLoop()
+	c.readLoop()
+}
+
+func (c *wsConnection) readLoop() {
+	defer func() {
+		for _, subscriber := range c.subscriptions {
+			c.server.hub.unsubscribe(subscriber)
+		}
+		c.close(websocket.CloseNormalClosure, "")
+	}()
+
+	pongWait := 2 * c.server.heartbeatInterval
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debug("websocket read failed", "error", err)
+			}
+			return
+		}
+
+		var req WSRequest
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			c.enqueue(WSResponse{Type: WSMessageError, Status: http.StatusBadRequest, Error: "Invalid message"})
+			continue
+		}
+
+		// the messages are handled one at a time, a client sending faster than it reads fills its send buffer
+		c.handle(req)
+	}
+}
+
+func (c *wsConnection) writeLoop() {
+	ping := time.NewTicker(c.server.heartbeatInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.server.hub.done:
+			c.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err := c.conn.WriteJSON(msg)
+			if err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// close sends the close message, if the code allows it, and closes the connection, which ends the read loop
+func (c *wsConnection) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if code != websocket.CloseAbnormalClosure {
+			message := websocket.FormatCloseMessage(code, reason)
+			_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+		}
+		_ = c.conn.Close()
+	})
+}
+
+// enqueue queues the message without blocking. A client whose send buffer is full is disconnected
+func (c *wsConnection) enqueue(msg WSResponse) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		log.Debug("disconnecting a slow websocket client", "tenant", c.tenant)
+		c.close(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+func (c *wsConnection) handle(req WSRequest) {
+	name := req.Counter
+	if len(name) == 0 {
+		name = common.DefaultCounterName
+	}
+
+	switch req.Type {
+	case WSMessageValue:
+		c.sendValue(req, name)
+	case WSMessageSubscribe:
+		c.subscribe(req, name)
+	case WSMessageIncrement:
+		c.increment(req, name)
+	case WSMessageReset:
+		c.reset(req, name)
+	default:
+		c.sendError(req, http.StatusBadRequest, "Unknown message type")
+	}
+}
+
+func (c *wsConnection) sendValue(req WSRequest, name string) {
+	if !c.permitted(req, name, common.PermissionRead) {
+		return
+	}
+
+	value, err := c.store.GetCounter(name)
+	if err != nil {
+		c.sendCounterError(req, err, "Failed to get counter")
+		return
+	}
+
+	c.enqueue(WSResponse{ID: req.ID, Type: WSMessageValue, Counter: name, Value: &value})
+}
+
+// subscribe forwards the counter updates to the connection, then answers with the current value
+func (c *wsConnection) subscribe(req WSRequest, name string) {
+	_, subscribed := c.subscriptions[name]
+	if subscribed {
+		c.sendValue(req, name)
+		return
+	}
+	if len(c.subscriptions) >= wsMaxSubscriptions {
+		c.sendError(req, http.StatusTooManyRequests, "Too many subscriptions")
+		return
+	}
+	if !c.permitted(req, name, common.PermissionRead) {
+		return
+	}
+
+	_, err := c.store.GetCounter(name)
+	if err != nil {
+		c.sendCounterError(req, err, "Failed to get counter")
+		return
+	}
+
+	subscriber := c.server.hub.subscribe(c.tenant, name)
+	if subscriber == nil {
+		c.sendError(req, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	c.subscriptions[name] = subscriber
+
+	// as for the history, only the authenticated connections see who changed the counter
+	withUsername := c.claims != nil
+	go func() {
+		for event := range subscriber.changes {
+			value, previous := event.New, event.Old
+			update := WSResponse{
+				Type:      WSMessageUpdate,
+				Counter:   name,
+				Value:     &value,
+				Previous:  &previous,
+				Seq:       event.Seq,
+				Operation: event.Operation,
+			}
+			if withUsername {
+				update.Username = event.Username
+			}
+			c.enqueue(update)
+		}
+
+		// the hub dropped the subscriber because the connection did not keep up, or it was closed
+		c.close(websocket.CloseTryAgainLater, "subscription ended")
+	}()
+
+	c.sendValue(req, name)
+}
+
+func (c *wsConnection) increment(req WSRequest, name string) {
+	if !c.permitted(req, name, common.PermissionIncrement) {
+		return
+	}
+
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+	if delta == 0 {
+		c.sendError(req, http.StatusBadRequest, "Delta must not be 0")
+		return
+	}
+
+	var change common.CounterChange
+	var err error
+	if c.claims == nil {
+		change, err = c.store.AddToCounterAsVisitor(name, delta, c.visitor)
+	} else {
+		change, err = c.store.AddToCounter(name, delta, c.claims.Username)
+	}
+	if err != nil {
+		c.sendCounterError(req, err, "Failed to increment counter")
+		return
+	}
+	c.server.publishCounterChange(c.tenant, name, common.CounterOperationAdd, callerName(c.claims), change)
+
+	c.enqueue(WSResponse{ID: req.ID, Type: WSMessageValue, Counter: name, Value: &change.New, Previous: &change.Old, Seq: change.Seq})
+	log.Debug("counter updated", "counter", name, "delta", delta, "old value", change.Old, "new value", change.New)
+}
+
+func (c *wsConnection) reset(req WSRequest, name string) {
+	if !c.permitted(req, name, common.PermissionReset) {
+		return
+	}
+
+	change, err := c.store.ResetCounter(name, callerName(c.claims))
+	if err != nil {
+		c.sendCounterError(req, err, "Failed to reset counter")
+		return
+	}
+	c.server.publishCounterChange(c.tenant, name, common.CounterOperationReset, callerName(c.claims), change)
+
+	c.enqueue(WSResponse{ID: req.ID, Type: WSMessageValue, Counter: name, Value: &change.New, Previous: &change.Old, Seq: change.Seq})
+	log.Debug("counter reset", "counter", name, "new value", 0)
+}
+
+// permitted checks the counter access control list grants the permission to the connection and, for an authenticated
+// one, that the token has not expired since the connection started. Otherwise, it answers with an error and returns false
+func (c *wsConnection) permitted(req WSRequest, name string, permission string) bool {
+	if c.claims != nil && c.claims.ExpiresAt != nil && c.claims.ExpiresAt.Before(time.Now()) {
+		c.sendError(req, http.StatusUnauthorized, "Token expired")
+		return false
+	}
+
+	acl, err := c.store.GetCounterACL(name)
+	if err != nil {
+		c.sendCounterError(req, err, "Failed to get the counter access control list")
+		return false
+	}
+	if !acl.Allows(c.claims, permission) {
+		if c.claims == nil {
+			c.sendError(req, http.StatusUnauthorized, "Authorization required")
+			return false
+		}
+		c.sendError(req, http.StatusForbidden, "Forbidden: Insufficient permissions")
+		return false
+	}
+
+	return true
+}
+
+func (c *wsConnection) sendCounterError(req WSRequest, err error, message string) {
+	status, text := counterErrorStatus(err, message)
+	c.sendError(req, status, text)
+}
+
+func (c *wsConnection) sendError(req WSRequest, status int, message string) {
+	c.enqueue(WSResponse{ID: req.ID, Type: WSMessageError, Counter: req.Counter, Status: status, Error: message})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialWebSocket connects to the test server with the optional token
+func dialWebSocket(t *testing.T, srv *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	if len(token) > 0 {
+		url += "?token=" + token
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	return conn
+}
+
+// exchange sends the request and returns the next message received
+func exchange(t *testing.T, conn *websocket.Conn, req WSRequest) WSResponse {
+	t.Helper()
+
+	require.NoError(t, conn.WriteJSON(req))
+	return readWebSocket(t, conn)
+}
+
+func readWebSocket(t *testing.T, conn *websocket.Conn) WSResponse {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp WSResponse
+	require.NoError(t, conn.ReadJSON(&resp))
+
+	return resp
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+	adminToken := loginToken(t, s, "admin", "admin123")
+
+	srv := httptest.NewServer(http.HandlerFunc(s.HandleWebSocket))
+	defer srv.Close()
+
+	t.Run("should reject an invalid token at connect time", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?token=invalid", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should let anonymous clients read but not update", func(t *testing.T) {
+		conn := dialWebSocket(t, srv, "")
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		resp := exchange(t, conn, WSRequest{ID: "1", Type: WSMessageValue})
+		assert.Equal(t, "1", resp.ID)
+		assert.Equal(t, WSMessageValue, resp.Type)
+		assert.Equal(t, "default", resp.Counter)
+		require.NotNil(t, resp.Value)
+		assert.Zero(t, *resp.Value)
+
+		resp = exchange(t, conn, WSRequest{ID: "2", Type: WSMessageIncrement})
+		assert.Equal(t, WSMessageError, resp.Type)
+		assert.Equal(t, http.StatusUnauthorized, resp.Status)
+	})
+
+	t.Run("should increment and push the updates to the subscribers", func(t *testing.T) {
+		watcher := dialWebSocket(t, srv, adminToken)
+		defer func() {
+			_ = watcher.Close()
+		}()
+		resp := exchange(t, watcher, WSRequest{Type: WSMessageSubscribe})
+		assert.Equal(t, WSMessageValue, resp.Type)
+
+		anonymous := dialWebSocket(t, srv, "")
+		defer func() {
+			_ = anonymous.Close()
+		}()
+		resp = exchange(t, anonymous, WSRequest{Type: WSMessageSubscribe})
+		assert.Equal(t, WSMessageValue, resp.Type)
+
+		kiosk := dialWebSocket(t, srv, aliceToken)
+		defer func() {
+			_ = kiosk.Close()
+		}()
+		resp = exchange(t, kiosk, WSRequest{ID: "inc", Type: WSMessageIncrement, Delta: int64Ptr(5)})
+		assert.Equal(t, "inc", resp.ID)
+		assert.Equal(t, WSMessageValue, resp.Type)
+		assert.Equal(t, uint64(5), *resp.Value)
+		assert.Zero(t, *resp.Previous)
+
+		resp = readWebSocket(t, watcher)
+		assert.Equal(t, WSMessageUpdate, resp.Type)
+		assert.Equal(t, uint64(5), *resp.Value)
+		assert.Equal(t, "add", resp.Operation)
+		assert.Equal(t, "alice", resp.Username)
+
+		// the anonymous subscribers do not see who changed the counter
+		resp = readWebSocket(t, anonymous)
+		assert.Equal(t, WSMessageUpdate, resp.Type)
+		assert.Equal(t, uint64(5), *resp.Value)
+		assert.Equal(t, "add", resp.Operation)
+		assert.Empty(t, resp.Username)
+
+		rr := httptest.NewRecorder()
+		s.HandleCounter(rr, groupRequest("POST", "/counter", aliceToken, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		resp = readWebSocket(t, watcher)
+		assert.Equal(t, uint64(6), *resp.Value)
+		resp = readWebSocket(t, anonymous)
+		assert.Equal(t, uint64(6), *resp.Value)
+	})
+
+	t.Run("should require the admin role to reset", func(t *testing.T) {
+		conn := dialWebSocket(t, srv, aliceToken)
+		defer func() {
+			_ = conn.Close()
+		}()
+		resp := exchange(t, conn, WSRequest{Type: WSMessageReset})
+		assert.Equal(t, http.StatusForbidden, resp.Status)
+
+		admin := dialWebSocket(t, srv, adminToken)
+		defer func() {
+			_ = admin.Close()
+		}()
+		resp = exchange(t, admin, WSRequest{Type: WSMessageReset})
+		assert.Equal(t, WSMessageValue, resp.Type)
+		assert.Zero(t, *resp.Value)
+	})
+
+	t.Run("should answer the invalid messages with errors", func(t *testing.T) {
+		conn := dialWebSocket(t, srv, aliceToken)
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+		assert.Equal(t, http.StatusBadRequest, readWebSocket(t, conn).Status)
+		assert.Equal(t, http.StatusBadRequest, exchange(t, conn, WSRequest{Type: "unknown"}).Status)
+		assert.Equal(t, http.StatusNotFound, exchange(t, conn, WSRequest{Type: WSMessageSubscribe, Counter: "missing"}).Status)
+		assert.Equal(t, http.StatusConflict, exchange(t, conn, WSRequest{Type: WSMessageIncrement, Delta: int64Ptr(-100)}).Status)
+	})
+}
+
+func TestHandleWebSocket_PingAndClose(t *testing.T) {
+	s := setupServer(t)
+	s.heartbeatInterval = 50 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(s.HandleWebSocket))
+	defer srv.Close()
+
+	conn := dialWebSocket(t, srv, "")
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, nil, time.Now().Add(time.Second))
+	})
+
+	t.Run("should ping the client and stay connected while it answers", func(t *testing.T) {
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			s.CloseStreams()
+		}()
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+		assert.NotEmpty(t, pings)
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"FullStackApp01/common"
+)
+
+// HandleCounterRate returns (GET) the increments of the sliding window counter named in the path over the window
+// query parameter (a Go duration, e.g. 5m), ending now. The window defaults to the maximum one of the counter
+func (s *Server) HandleCounterRate(w http.ResponseWriter, r *http.Request) {
+	s.EnableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, ok := s.requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	_, ok = s.counterCaller(w, r, store, name, common.PermissionRead)
+	if !ok {
+		return
+	}
+	info, err := store.GetCounterInfo(name)
+	if writeCounterError(w, err, "Failed to get counter") {
+		return
+	}
+	if info.Window == nil {
+		http.Error(w, "Not a sliding window counter", http.StatusBadRequest)
+		return
+	}
+
+	value := r.URL.Query().Get("window")
+	if len(value) == 0 {
+		value = info.Window.MaxWindow
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		http.Error(w, "Invalid window, expected a duration such as 5m", http.StatusBadRequest)
+		return
+	}
+
+	rate, err := store.GetCounterRate(name, window, time.Now())
+	if writeCounterError(w, err, "Failed to get the counter rate") {
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(rate)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCounterRate(t *testing.T) {
+	s := setupServer(t)
+	_ = s.store.SaveUser("alice", "pass", "user")
+	aliceToken := loginToken(t, s, "alice", "pass")
+
+	rateRequest := func(target string, name string) *http.Request {
+		req := httptest.NewRequest("GET", target, nil)
+		req.SetPathValue("name", name)
+		return req
+	}
+
+	t.Run("should create a sliding window counter", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{
+			Name:   "clicks",
+			Window: &common.SlidingWindow{Resolution: "30s", MaxWindow: "45s"},
+		}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounters(rr, groupRequest("POST", "/counters", aliceToken, CreateCounterRequest{
+			Name:   "clicks",
+			Window: &common.SlidingWindow{Resolution: "10s", MaxWindow: "1h"},
+		}))
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var info common.CounterInfo
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&info))
+		require.NotNil(t, info.Window)
+		assert.Equal(t, "1h", info.Window.MaxWindow)
+	})
+
+	t.Run("should return the increments of the window", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s.HandleNamedCounter(rr, namedCounterRequest("POST", "/counters/clicks", "clicks", aliceToken, CounterDeltaRequest{Delta: int64Ptr(3)}))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRate(rr, rateRequest("/counters/clicks/rate?window=5m", "clicks"))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var rate common.CounterRate
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&rate))
+		assert.Equal(t, "5m0s", rate.Window)
+		assert.Equal(t, uint64(3), rate.Increments)
+
+		// the maximum window by default
+		rr = httptest.NewRecorder()
+		s.HandleCounterRate(rr, rateRequest("/counters/clicks/rate", "clicks"))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&rate))
+		assert.Equal(t, "1h0m0s", rate.Window)
+	})
+
+	t.Run("should validate the request", func(t *testing.T) {
+		for target, status := range map[string]int{
+			"/counters/clicks/rate?window=2h":    http.StatusBadRequest,
+			"/counters/clicks/rate?window=often": http.StatusBadRequest,
+		} {
+			rr := httptest.NewRecorder()
+			s.HandleCounterRate(rr, rateRequest(target, "clicks"))
+			assert.Equal(t, status, rr.Code, target)
+		}
+
+		rr := httptest.NewRecorder()
+		s.HandleCounterRate(rr, rateRequest("/counters/default/rate", common.DefaultCounterName))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptest.NewRecorder()
+		s.HandleCounterRate(rr, rateRequest("/counters/missing/rate", "missing"))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"FullStackApp01/common"
+	"FullStackApp01/storage"
+	"FullStackApp01/userio"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli"
+)
+
+var (
+	// dryRun defines the flag used by the maintenance commands to only report what they would do
+	dryRun = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Only report the changes, without writing anything to the database",
+	}
+
+	// filePath defines the file read by the import or written by the export
+	filePath = cli.StringFlag{
+		Name:  "file",
+		Usage: "The `path` of the users file",
+	}
+
+	// fileFormat defines the format of the users file
+	fileFormat = cli.StringFlag{
+		Name:  "format",
+		Usage: "The users file `format`: csv or jsonl. If not set, it is guessed from the file extension",
+	}
+
+	// onConflict defines the policy applied when an imported user already exists
+	onConflict = cli.StringFlag{
+		Name:  "on-conflict",
+		Usage: "What to do when a user already exists: skip, overwrite or fail",
+		Value: string(storage.ConflictFail),
+	}
+
+	// tenant defines the tenant whose users are imported or exported
+	tenant = cli.StringFlag{
+		Name:  "tenant",
+		Usage: "The `id` of the tenant",
+		Value: common.DefaultTenantID,
+	}
+
+	// adminUsername defines the username of the bootstrapped admin
+	adminUsername = cli.StringFlag{
+		Name:  "username",
+		Usage: "The `username` of the admin",
+		Value: defaultAdminUsername,
+	}
+
+	// adminPassword defines the password of the bootstrapped admin
+	adminPassword = cli.StringFlag{
+		Name:   "password",
+		Usage:  "The `password` of the admin",
+		EnvVar: "ADMIN_PASSWORD",
+	}
+
+	// resetPassword defines if the password of an existing admin is overwritten
+	resetPassword = cli.BoolFlag{
+		Name:  "reset-password",
+		Usage: "Overwrite the password if the admin already exists",
+	}
+
+	// includeHashes defines if the password hashes are exported
+	includeHashes = cli.BoolFlag{
+		Name:  "include-hashes",
+		Usage: "Also export the bcrypt password hashes",
+	}
+)
+
+func commands() []cli.Command {
+	return []cli.Command{
+		{
+			Name:   "bootstrap",
+			Usage:  "Creates the initial admin of the default tenant. Running it again does not change an existing admin",
+			Flags:  []cli.Flag{adminUsername, adminPassword, resetPassword},
+			Action: bootstrap,
+		},
+		{
+			Name:   "migrate-usernames",
+			Usage:  "Moves the users under their canonical username keys and reports the colliding usernames",
+			Flags:  []cli.Flag{dryRun},
+			Action: migrateUsernames,
+		},
+		{
+			Name:   "import-users",
+			Usage:  "Imports users from a CSV or JSON Lines file containing plaintext passwords or bcrypt hashes",
+			Flags:  []cli.Flag{filePath, fileFormat, onConflict, tenant, dryRun},
+			Action: importUsers,
+		},
+		{
+			Name:   "export-users",
+			Usage:  "Exports the users to a CSV or JSON Lines file",
+			Flags:  []cli.Flag{filePath, fileFormat, tenant, includeHashes},
+			Action: exportUsers,
+		},
+	}
+}
+
+// prepareCommand sets up the logger and the environment for a maintenance command
+func prepareCommand(c *cli.Context) error {
+	var err error
+	logfile, err = prepareLogger(c.GlobalString(logLevel.Name))
+	if err != nil {
+		return err
+	}
+
+	// the .env file is optional for the maintenance commands
+	err = godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	return nil
+}
+
+func bootstrap(c *cli.Context) error {
+	err := prepareCommand(c)
+	if err != nil {
+		return err
+	}
+
+	username := c.String(adminUsername.Name)
+	password := c.String(adminPassword.Name)
+	if len(password) == 0 {
+		return errors.New("the --password flag or the ADMIN_PASSWORD variable is required")
+	}
+	if len(password) > maxPassLength {
+		return fmt.Errorf("password too long (max %d characters)", maxPassLength)
+	}
+
+	store, err := storage.NewStore(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	created, err := store.BootstrapAdmin(username, password, c.Bool(resetPassword.Name))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case created:
+		log.Info("admin created", "user", username)
+	case c.Bool(resetPassword.Name):
+		log.Info("admin password reset", "user", username)
+	default:
+		log.Info("admin already exists, nothing changed", "user", username)
+	}
+
+	return nil
+}
+
+func migrateUsernames(c *cli.Context) error {
+	err := prepareCommand(c)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewStore(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	report, err := store.MigrateUsernames(c.Bool(dryRun.Name))
+	if err != nil {
+		return err
+	}
+	logUsernameMigrationReport(report)
+
+	return nil
+}
+
+func logUsernameMigrationReport(report *storage.UsernameMigrationReport) {
+	if len(report.Migrated) > 0 {
+		log.Info("migrated users to canonical usernames", "users", strings.Join(report.Migrated, ", "))
+	}
+	for canonical, usernames := range report.Collisions {
+		log.Warn("colliding usernames found, these users must be renamed manually",
+			"canonical", canonical, "users", strings.Join(usernames, ", "))
+	}
+}
+
+func importUsers(c *cli.Context) error {
+	err := prepareCommand(c)
+	if err != nil {
+		return err
+	}
+
+	path, format, err := usersFile(c)
+	if err != nil {
+		return err
+	}
+	policy, err := storage.ParseConflictPolicy(c.String(onConflict.Name))
+	if err != nil {
+		return err
+	}
+	rules, err := loadUsernameRules()
+	if err != nil {
+		return err
+	}
+	// reserved names are only meant to block self registrations, exported admins should be importable
+	rules.Reserved = nil
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	records, err := userio.ReadRecords(f, format)
+	if err != nil {
+		return fmt.Errorf("%w while reading %s", err, path)
+	}
+
+	// hashing is done before opening the database, it is the slow part of the import
+	users, err := userio.ToUsers(records, rules, "user")
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewStore(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	_, err = store.GetTenant(c.String(tenant.Name))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, c.String(tenant.Name))
+	}
+	tenantStore := store.ForTenant(c.String(tenant.Name))
+
+	isDryRun := c.Bool(dryRun.Name)
+	report, err := tenantStore.ImportUsers(users, policy, isDryRun)
+	if err != nil {
+		return err
+	}
+
+	log.Info("users import finished", "tenant", tenantStore.TenantID(), "dry run", isDryRun,
+		"created", len(report.Created), "overwritten", len(report.Overwritten), "skipped", len(report.Skipped))
+	if len(report.Overwritten) > 0 {
+		log.Info("overwritten users", "users", strings.Join(report.Overwritten, ", "))
+	}
+	if len(report.Skipped) > 0 {
+		log.Info("skipped users", "users", strings.Join(report.Skipped, ", "))
+	}
+
+	return nil
+}
+
+func exportUsers(c *cli.Context) error {
+	err := prepareCommand(c)
+	if err != nil {
+		return err
+	}
+
+	path, format, err := usersFile(c)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewStore(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	_, err = store.GetTenant(c.String(tenant.Name))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, c.String(tenant.Name))
+	}
+	tenantStore := store.ForTenant(c.String(tenant.Name))
+
+	users, err := tenantStore.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = userio.WriteUsers(f, format, users, c.Bool(includeHashes.Name))
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("%w while writing %s", err, path)
+	}
+
+	log.Info("users exported", "tenant", tenantStore.TenantID(), "file", path, "num users", len(users))
+
+	return f.Close()
+}
+
+func usersFile(c *cli.Context) (string, string, error) {
+	path := c.String(filePath.Name)
+	if len(path) == 0 {
+		return "", "", errors.New("the --file flag is required")
+	}
+
+	format := strings.ToLower(c.String(fileFormat.Name))
+	if len(format) > 0 {
+		return path, format, nil
+	}
+
+	format, err := userio.FormatFromPath(path)
+	return path, format, err
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Counter permissions. The admin permission grants all the others and the management of the counter:
+// its bounds, its access control list and its deletion
+const (
+	PermissionRead      = "read"
+	PermissionIncrement = "increment"
+	PermissionReset     = "reset"
+	PermissionAdmin     = "admin"
+)
+
+// Permissions lists the counter permissions
+var Permissions = []string{PermissionRead, PermissionIncrement, PermissionReset, PermissionAdmin}
+
+// ACL principal types. The anonymous entries apply to every caller, with or without a token
+const (
+	PrincipalUser      = "user"
+	PrincipalRole      = "role"
+	PrincipalAnonymous = "anonymous"
+)
+
+// AdminRole is the tenant role allowed everything on every counter, so no access control list can lock the
+// counters out of reach
+const AdminRole = "admin"
+
+// ACLEntry grants the permissions to a user, a role or the anonymous callers. Name is empty for the latter
+type ACLEntry struct {
+	Type        string   `json:"type"`
+	Name        string   `json:"name,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// CounterACL holds the owner of a counter and the entries granting access to it. The owner has all the permissions
+type CounterACL struct {
+	Counter string     `json:"counter"`
+	Owner   string     `json:"owner,omitempty"`
+	Entries []ACLEntry `json:"entries"`
+}
+
+// DefaultACLEntries returns the entries of the counters without an explicit access control list: anyone can read
+// them and the users can increment them
+func DefaultACLEntries() []ACLEntry {
+	return []ACLEntry{
+		{Type: PrincipalAnonymous, Permissions: []string{PermissionRead}},
+		{Type: PrincipalRole, Name: "user", Permissions: []string{PermissionRead, PermissionIncrement}},
+	}
+}
+
+// Validate checks the principals and the permissions of the entries
+func (acl *CounterACL) Validate() error {
+	for _, entry := range acl.Entries {
+		switch entry.Type {
+		case PrincipalUser, PrincipalRole:
+			if len(entry.Name) == 0 {
+				return fmt.Errorf("%w: the %s entries need a name", ErrInvalidACL, entry.Type)
+			}
+		case PrincipalAnonymous:
+			if len(entry.Name) > 0 {
+				return fmt.Errorf("%w: the anonymous entries have no name", ErrInvalidACL)
+			}
+		default:
+			return fmt.Errorf("%w: unknown principal type %q", ErrInvalidACL, entry.Type)
+		}
+
+		if len(entry.Permissions) == 0 {
+			return fmt.Errorf("%w: an entry grants no permission", ErrInvalidACL)
+		}
+		for _, permission := range entry.Permissions {
+			if !slices.Contains(Permissions, permission) {
+				return fmt.Errorf("%w: unknown permission %q", ErrInvalidACL, permission)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allows returns true if the caller has the permission on the counter. The claims are nil for an anonymous caller
+func (acl *CounterACL) Allows(claims *Claims, permission string) bool {
+	if claims != nil {
+		if claims.HasAnyRole([]string{AdminRole}) {
+			return true
+		}
+		if len(acl.Owner) > 0 && CanonicalUsername(acl.Owner) == CanonicalUsername(claims.Username) {
+			return true
+		}
+	}
+
+	for _, entry := range acl.Entries {
+		if !entry.matches(claims) {
+			continue
+		}
+		if slices.Contains(entry.Permissions, permission) || slices.Contains(entry.Permissions, PermissionAdmin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches returns true if the entry applies to the caller
+func (entry *ACLEntry) matches(claims *Claims) bool {
+	switch entry.Type {
+	case PrincipalAnonymous:
+		return true
+	case PrincipalUser:
+		return claims != nil && CanonicalUsername(entry.Name) == CanonicalUsername(claims.Username)
+	case PrincipalRole:
+		return claims != nil && claims.HasAnyRole([]string{entry.Name})
+	default:
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterACL_Validate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should accept the default entries", func(t *testing.T) {
+		acl := CounterACL{Counter: "visits", Owner: "alice", Entries: DefaultACLEntries()}
+		assert.Nil(t, acl.Validate())
+	})
+	t.Run("should reject the invalid entries", func(t *testing.T) {
+		for _, entry := range []ACLEntry{
+			{Type: PrincipalUser, Permissions: []string{PermissionRead}},
+			{Type: PrincipalRole, Permissions: []string{PermissionRead}},
+			{Type: PrincipalAnonymous, Name: "bob", Permissions: []string{PermissionRead}},
+			{Type: "group", Name: "staff", Permissions: []string{PermissionRead}},
+			{Type: PrincipalUser, Name: "bob"},
+			{Type: PrincipalUser, Name: "bob", Permissions: []string{"write"}},
+		} {
+			acl := CounterACL{Counter: "visits", Entries: []ACLEntry{entry}}
+			assert.True(t, errors.Is(acl.Validate(), ErrInvalidACL), "entry %+v", entry)
+		}
+	})
+}
+
+func TestCounterACL_Allows(t *testing.T) {
+	t.Parallel()
+
+	acl := CounterACL{
+		Counter: "visits",
+		Owner:   "Alice",
+		Entries: []ACLEntry{
+			{Type: PrincipalAnonymous, Permissions: []string{PermissionRead}},
+			{Type: PrincipalRole, Name: "editor", Permissions: []string{PermissionIncrement}},
+			{Type: PrincipalUser, Name: "bob", Permissions: []string{PermissionReset}},
+			{Type: PrincipalUser, Name: "carol", Permissions: []string{PermissionAdmin}},
+		},
+	}
+
+	t.Run("should let the owner and the admins do everything", func(t *testing.T) {
+		for _, permission := range Permissions {
+			assert.True(t, acl.Allows(&Claims{Username: "alice", Role: "user"}, permission))
+			assert.True(t, acl.Allows(&Claims{Username: "root", Role: AdminRole}, permission))
+			assert.True(t, acl.Allows(&Claims{Username: "carol", Role: "user"}, permission))
+		}
+	})
+	t.Run("should grant the permissions of the matching entries", func(t *testing.T) {
+		assert.True(t, acl.Allows(nil, PermissionRead))
+		assert.False(t, acl.Allows(nil, PermissionIncrement))
+
+		editor := &Claims{Username: "dave", Role: "user", Roles: []string{"user", "editor"}}
+		assert.True(t, acl.Allows(editor, PermissionRead))
+		assert.True(t, acl.Allows(editor, PermissionIncrement))
+		assert.False(t, acl.Allows(editor, PermissionReset))
+
+		bob := &Claims{Username: "Bob", Role: "user"}
+		assert.True(t, acl.Allows(bob, PermissionReset))
+		assert.False(t, acl.Allows(bob, PermissionIncrement))
+		assert.False(t, acl.Allows(bob, PermissionAdmin))
+	})
+}
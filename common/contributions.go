@@ -0,0 +1,47 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Contribution periods
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+	PeriodAll  = "all"
+)
+
+// Periods lists the contribution periods
+var Periods = []string{PeriodDay, PeriodWeek, PeriodAll}
+
+// Contribution holds the amount a user incremented a counter by in a period
+type Contribution struct {
+	Rank       int    `json:"rank,omitempty"`
+	Username   string `json:"username"`
+	Increments uint64 `json:"increments"`
+}
+
+// UserContributions holds the contributions of one user to a counter, for each period
+type UserContributions struct {
+	Counter string `json:"counter"`
+	Day     uint64 `json:"day"`
+	Week    uint64 `json:"week"`
+	All     uint64 `json:"all"`
+}
+
+// PeriodKey identifies the period containing the timestamp: the UTC day, the ISO week or all time
+func PeriodKey(period string, timestamp time.Time) (string, error) {
+	timestamp = timestamp.UTC()
+	switch period {
+	case PeriodDay:
+		return PeriodDay + ":" + timestamp.Format(time.DateOnly), nil
+	case PeriodWeek:
+		year, week := timestamp.ISOWeek()
+		return fmt.Sprintf("%s:%04d-W%02d", PeriodWeek, year, week), nil
+	case PeriodAll:
+		return PeriodAll, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+}
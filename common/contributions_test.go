@@ -0,0 +1,29 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodKey(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Date(2024, 12, 30, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600))
+
+	key, err := PeriodKey(PeriodDay, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "day:2024-12-31", key)
+
+	key, err = PeriodKey(PeriodWeek, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "week:2025-W01", key)
+
+	key, err = PeriodKey(PeriodAll, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "all", key)
+
+	_, err = PeriodKey("month", timestamp)
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
@@ -1,6 +1,18 @@
 package common
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultTenantID is the tenant used when none is specified. It holds the data created before tenants existed
+const DefaultTenantID = "default"
+
+// DefaultCounterName is the counter served at /counter. It holds the value counted before named counters existed
+const DefaultCounterName = "default"
 
 // User represents a registered user
 type User struct {
@@ -13,11 +25,160 @@ type User struct {
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Tenant is optional, the default tenant is used if empty
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // Claims represents the claims DTO holder
 type Claims struct {
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// Roles holds the effective roles: the user's own role together with the roles inherited from its groups
+	Roles []string `json:"roles,omitempty"`
+	// Tenant is empty for the tokens issued before tenants existed, meaning the default tenant
+	Tenant string `json:"tenant,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// TenantID returns the tenant of the claims, falling back to the default tenant
+func (claims *Claims) TenantID() string {
+	if len(claims.Tenant) == 0 {
+		return DefaultTenantID
+	}
+
+	return claims.Tenant
+}
+
+// HasAnyRole returns true if any of the effective roles is one of the provided roles.
+// Tokens issued before the effective roles existed only carry the user's own role
+func (claims *Claims) HasAnyRole(roles []string) bool {
+	effective := claims.Roles
+	if len(effective) == 0 {
+		effective = []string{claims.Role}
+	}
+
+	for _, role := range roles {
+		for _, owned := range effective {
+			if role == owned {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Group represents a named set of users sharing the same roles
+type Group struct {
+	Name    string   `json:"name"`
+	Roles   []string `json:"roles"`
+	Members []string `json:"members"`
+}
+
+// Tenant represents an organization whose users and data are isolated from the other tenants
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CounterInfo represents a named counter together with its metadata
+type CounterInfo struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	Value       uint64    `json:"value"`
+	// Min and Max are the optional inclusive bounds of the value
+	Min *uint64 `json:"min,omitempty"`
+	Max *uint64 `json:"max,omitempty"`
+	// Window makes it a sliding window counter, its recent increments can be queried per window
+	Window *SlidingWindow `json:"window,omitempty"`
+}
+
+// CheckBounds returns ErrCounterOutOfBounds if the value is outside the counter bounds
+func (info *CounterInfo) CheckBounds(value uint64) error {
+	if info.Min != nil && value < *info.Min {
+		return fmt.Errorf("%w: %d is lower than the minimum %d", ErrCounterOutOfBounds, value, *info.Min)
+	}
+	if info.Max != nil && value > *info.Max {
+		return fmt.Errorf("%w: %d is higher than the maximum %d", ErrCounterOutOfBounds, value, *info.Max)
+	}
+
+	return nil
+}
+
+// Counter history operations
+const (
+	CounterOperationAdd     = "add"
+	CounterOperationSet     = "set"
+	CounterOperationReset   = "reset"
+	CounterOperationRestore = "restore"
+)
+
+// CounterEvent records one mutation of a counter
+type CounterEvent struct {
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Username  string    `json:"username,omitempty"`
+	Operation string    `json:"operation"`
+	Old       uint64    `json:"old"`
+	New       uint64    `json:"new"`
+}
+
+// ResetUndo is the recoverable slot keeping the value cleared by the last reset of a counter. Seq is the
+// sequence of the reset event, it tells if the counter changed since. ExpiresAt is set when the slot is read
+type ResetUndo struct {
+	Counter   string    `json:"counter"`
+	Value     uint64    `json:"value"`
+	Seq       uint64    `json:"seq"`
+	ResetBy   string    `json:"reset_by,omitempty"`
+	ResetAt   time.Time `json:"reset_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CounterHistoryQuery selects the counter events. Zero From/To mean unbounded; only the events with a
+// sequence higher than After are returned, at most Limit of them
+type CounterHistoryQuery struct {
+	From  time.Time
+	To    time.Time
+	After uint64
+	Limit int
+}
+
+// CounterChange holds the counter value before and after a mutation
+type CounterChange struct {
+	Old uint64 `json:"old"`
+	New uint64 `json:"new"`
+	// Seq is the sequence of the history event recording the change
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// ApplyDelta adds the signed delta to the value, detecting the uint64 overflow and underflow
+func ApplyDelta(value uint64, delta int64) (uint64, error) {
+	if delta >= 0 {
+		if value > math.MaxUint64-uint64(delta) {
+			return 0, fmt.Errorf("%w: %d + %d", ErrCounterOverflow, value, delta)
+		}
+		return value + uint64(delta), nil
+	}
+
+	// -delta can not be computed for math.MinInt64, the unsigned conversion handles it
+	magnitude := uint64(-(delta + 1)) + 1
+	if value < magnitude {
+		return 0, fmt.Errorf("%w: %d - %d", ErrCounterUnderflow, value, magnitude)
+	}
+	return value - magnitude, nil
+}
+
+// IdempotencyRecord holds the outcome of a request sent with an Idempotency-Key header.
+// A record that is not completed marks a request still in progress
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status,omitempty"`
+	// Headers holds the replayed response headers
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      []byte            `json:"body,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDelta(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should add and subtract", func(t *testing.T) {
+		value, err := ApplyDelta(10, 5)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(15), value)
+
+		value, err = ApplyDelta(10, -10)
+		assert.Nil(t, err)
+		assert.Zero(t, value)
+	})
+	t.Run("should detect the overflow", func(t *testing.T) {
+		value, err := ApplyDelta(math.MaxUint64-1, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(math.MaxUint64), value)
+
+		_, err = ApplyDelta(math.MaxUint64, 1)
+		assert.True(t, errors.Is(err, ErrCounterOverflow))
+		_, err = ApplyDelta(math.MaxUint64-math.MaxInt64+1, math.MaxInt64)
+		assert.True(t, errors.Is(err, ErrCounterOverflow))
+	})
+	t.Run("should detect the underflow", func(t *testing.T) {
+		_, err := ApplyDelta(0, -1)
+		assert.True(t, errors.Is(err, ErrCounterUnderflow))
+		_, err = ApplyDelta(math.MaxInt64, math.MinInt64)
+		assert.True(t, errors.Is(err, ErrCounterUnderflow))
+
+		value, err := ApplyDelta(math.MaxInt64+1, math.MinInt64)
+		assert.Nil(t, err)
+		assert.Zero(t, value)
+	})
+}
+
+func TestCounterInfo_CheckBounds(t *testing.T) {
+	t.Parallel()
+
+	minValue, maxValue := uint64(2), uint64(5)
+	info := CounterInfo{Min: &minValue, Max: &maxValue}
+
+	assert.Nil(t, info.CheckBounds(2))
+	assert.Nil(t, info.CheckBounds(5))
+	assert.True(t, errors.Is(info.CheckBounds(1), ErrCounterOutOfBounds))
+	assert.True(t, errors.Is(info.CheckBounds(6), ErrCounterOutOfBounds))
+
+	unbounded := CounterInfo{}
+	assert.Nil(t, unbounded.CheckBounds(math.MaxUint64))
+}
@@ -0,0 +1,87 @@
+package common
+
+import "errors"
+
+// ErrUserNotFound signals that the requested user does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrGroupNotFound signals that the requested group does not exist
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrGroupAlreadyExists signals that a group with the same name already exists
+var ErrGroupAlreadyExists = errors.New("group already exists")
+
+// ErrTenantNotFound signals that the requested tenant does not exist
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// ErrTenantAlreadyExists signals that a tenant with the same id already exists
+var ErrTenantAlreadyExists = errors.New("tenant already exists")
+
+// ErrCounterNotFound signals that the requested counter does not exist
+var ErrCounterNotFound = errors.New("counter not found")
+
+// ErrCounterAlreadyExists signals that a counter with the same name already exists
+var ErrCounterAlreadyExists = errors.New("counter already exists")
+
+// ErrDefaultCounter signals an operation that is not allowed on the default counter
+var ErrDefaultCounter = errors.New("operation not allowed on the default counter")
+
+// ErrCounterOverflow signals that a counter update would exceed the maximum representable value
+var ErrCounterOverflow = errors.New("counter overflow")
+
+// ErrCounterUnderflow signals that a counter update would go below 0
+var ErrCounterUnderflow = errors.New("counter underflow")
+
+// ErrCounterOutOfBounds signals that a counter update would violate the configured bounds
+var ErrCounterOutOfBounds = errors.New("counter out of bounds")
+
+// ErrInvalidBounds signals that the minimum bound is higher than the maximum one
+var ErrInvalidBounds = errors.New("invalid counter bounds")
+
+// ErrCounterValueMismatch signals that a compare-and-swap found a different counter value than the expected one
+var ErrCounterValueMismatch = errors.New("counter value mismatch")
+
+// ErrInvalidGranularity signals an unknown statistics granularity
+var ErrInvalidGranularity = errors.New("invalid granularity")
+
+// ErrInvalidPeriod signals an unknown leaderboard period
+var ErrInvalidPeriod = errors.New("invalid period")
+
+// ErrInvalidSchedule signals an invalid cron expression or time zone
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ErrScheduleNotFound signals that the reset schedule does not exist
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ErrWebhookNotFound signals that the webhook subscription does not exist
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrInvalidWebhook signals an invalid webhook URL or event filter
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// ErrQuotaExceeded signals that the user has used up its increment quota for the current window
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrInvalidQuota signals a quota with an unknown period
+var ErrInvalidQuota = errors.New("invalid quota")
+
+// ErrHasherBusy signals that the password hashing pool is saturated and the request should be retried later
+var ErrHasherBusy = errors.New("password hashing is busy")
+
+// ErrNothingToRestore signals that the counter has no reset to undo, or that its undo window has passed
+var ErrNothingToRestore = errors.New("nothing to restore")
+
+// ErrInvalidSketch signals a HyperLogLog sketch that can not be decoded
+var ErrInvalidSketch = errors.New("invalid sketch")
+
+// ErrInvalidWindow signals an invalid sliding window configuration or query
+var ErrInvalidWindow = errors.New("invalid sliding window")
+
+// ErrInvalidACL signals an access control list with an unknown principal or permission
+var ErrInvalidACL = errors.New("invalid access control list")
+
+// ErrInvalidChallenge signals a proof of work challenge that is forged, expired or not solved
+var ErrInvalidChallenge = errors.New("invalid proof of work")
+
+// ErrChallengeUsed signals a proof of work challenge that was already used
+var ErrChallengeUsed = errors.New("proof of work already used")
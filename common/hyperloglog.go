@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLogPrecision is the number of hash bits selecting the register. The 4096 one byte registers
+// estimate the distinct items with a standard error of about 1.6%
+const HyperLogLogPrecision = 12
+
+const hyperLogLogRegisters = 1 << HyperLogLogPrecision
+
+// HyperLogLog estimates the number of distinct items added to it in a fixed amount of memory. Two sketches
+// merge into the sketch of the union of their items
+type HyperLogLog struct {
+	registers []byte
+}
+
+// NewHyperLogLog returns an empty sketch
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]byte, hyperLogLogRegisters)}
+}
+
+// DecodeHyperLogLog returns the sketch encoded by Bytes
+func DecodeHyperLogLog(data []byte) (*HyperLogLog, error) {
+	if len(data) != hyperLogLogRegisters {
+		return nil, fmt.Errorf("%w: expected %d bytes, found %d", ErrInvalidSketch, hyperLogLogRegisters, len(data))
+	}
+
+	return &HyperLogLog{registers: append([]byte{}, data...)}, nil
+}
+
+// Bytes encodes the sketch
+func (sketch *HyperLogLog) Bytes() []byte {
+	return append([]byte{}, sketch.registers...)
+}
+
+// Add adds the item to the sketch and returns true if the sketch changed. Most repeated items do not
+// change it, so it only needs to be saved when it did
+func (sketch *HyperLogLog) Add(item string) bool {
+	hash := hashItem(item)
+	index := hash >> (64 - HyperLogLogPrecision)
+	// the guard bit bounds the rank when all the remaining bits are 0
+	rank := byte(bits.LeadingZeros64(hash<<HyperLogLogPrecision|1<<(HyperLogLogPrecision-1)) + 1)
+	if rank <= sketch.registers[index] {
+		return false
+	}
+
+	sketch.registers[index] = rank
+	return true
+}
+
+// Merge adds the items of the other sketch to this one
+func (sketch *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, rank := range other.registers {
+		sketch.registers[i] = max(sketch.registers[i], rank)
+	}
+}
+
+// Estimate returns the estimated number of distinct items added to the sketch
+func (sketch *HyperLogLog) Estimate() uint64 {
+	const registers = float64(hyperLogLogRegisters)
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range sketch.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/registers)
+	estimate := alpha * registers * registers / sum
+	if estimate <= 2.5*registers && zeros > 0 {
+		// the linear counting is more accurate for the small cardinalities
+		estimate = registers * math.Log(registers/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+// hashItem returns the 64 bits hash of the item. The FNV hash is mixed with the MurmurHash3 finalizer,
+// the sketch needs all its bits to be uniform
+func hashItem(item string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(item))
+	hash := hasher.Sum64()
+
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+
+	return hash
+}
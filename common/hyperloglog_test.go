@@ -0,0 +1,87 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should estimate the distinct items within the error", func(t *testing.T) {
+		for _, count := range []int{10, 1000, 50000} {
+			sketch := NewHyperLogLog()
+			for i := 0; i < count; i++ {
+				sketch.Add(fmt.Sprintf("user:%d", i))
+				// the repeated items are not counted again
+				sketch.Add(fmt.Sprintf("user:%d", i/2))
+			}
+
+			relativeError := math.Abs(float64(sketch.Estimate())-float64(count)) / float64(count)
+			assert.Less(t, relativeError, 0.05, "%d items estimated as %d", count, sketch.Estimate())
+		}
+		assert.Zero(t, NewHyperLogLog().Estimate())
+	})
+	t.Run("should only report the changes", func(t *testing.T) {
+		sketch := NewHyperLogLog()
+		assert.True(t, sketch.Add("alice"))
+		assert.False(t, sketch.Add("alice"))
+	})
+	t.Run("should merge into the union", func(t *testing.T) {
+		first, second, union := NewHyperLogLog(), NewHyperLogLog(), NewHyperLogLog()
+		for i := 0; i < 3000; i++ {
+			item := fmt.Sprintf("visitor:%d", i)
+			union.Add(item)
+			if i < 2000 {
+				first.Add(item)
+			}
+			if i >= 1000 {
+				second.Add(item)
+			}
+		}
+
+		first.Merge(second)
+		assert.Equal(t, union.Estimate(), first.Estimate())
+	})
+	t.Run("should decode the encoded sketch", func(t *testing.T) {
+		sketch := NewHyperLogLog()
+		sketch.Add("alice")
+		sketch.Add("bob")
+
+		decoded, err := DecodeHyperLogLog(sketch.Bytes())
+		require.Nil(t, err)
+		assert.Equal(t, uint64(2), decoded.Estimate())
+
+		_, err = DecodeHyperLogLog([]byte{1, 2, 3})
+		assert.ErrorIs(t, err, ErrInvalidSketch)
+	})
+}
+
+func TestPeriodDays(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Date(2024, 12, 31, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*3600))
+
+	start, end, err := PeriodDays(PeriodDay, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	start, end, err = PeriodDays(PeriodWeek, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), end)
+
+	start, end, err = PeriodDays(PeriodMonth, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	_, _, err = PeriodDays(PeriodAll, timestamp)
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Defaults of the password hashing pool
+const (
+	DefaultHasherQueueLimit = 64
+	DefaultHasherTimeout    = 5 * time.Second
+)
+
+// PasswordHasherConfig configures the bcrypt pool. At most Workers hash or compare calls run at the same time,
+// at most QueueLimit more wait for a worker and none waits longer than Timeout
+type PasswordHasherConfig struct {
+	Cost       int
+	Workers    int
+	QueueLimit int
+	Timeout    time.Duration
+}
+
+// DefaultPasswordHasherConfig returns the bcrypt default cost and one worker per CPU
+func DefaultPasswordHasherConfig() PasswordHasherConfig {
+	return PasswordHasherConfig{
+		Cost:       bcrypt.DefaultCost,
+		Workers:    runtime.NumCPU(),
+		QueueLimit: DefaultHasherQueueLimit,
+		Timeout:    DefaultHasherTimeout,
+	}
+}
+
+// Validate checks the cost is in the bcrypt range and the pool can run at least one call
+func (config *PasswordHasherConfig) Validate() error {
+	if config.Cost < bcrypt.MinCost || config.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("the bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if config.Workers < 1 {
+		return errors.New("the password hashing pool needs at least one worker")
+	}
+	if config.QueueLimit < 0 {
+		return errors.New("the password hashing queue limit must not be negative")
+	}
+	if config.Timeout <= 0 {
+		return errors.New("the password hashing timeout must be positive")
+	}
+
+	return nil
+}
+
+// PasswordHasher runs the bcrypt calls on a bounded pool, so the anonymous requests can not use up the CPU.
+// A call that finds the queue full, or waits longer than the timeout, fails with ErrHasherBusy
+type PasswordHasher struct {
+	config  PasswordHasherConfig
+	workers chan struct{}
+	waiting atomic.Int64
+}
+
+// NewPasswordHasher creates a password hashing pool
+func NewPasswordHasher(config PasswordHasherConfig) (*PasswordHasher, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordHasher{
+		config:  config,
+		workers: make(chan struct{}, config.Workers),
+	}, nil
+}
+
+// Cost returns the bcrypt cost of the new hashes
+func (hasher *PasswordHasher) Cost() int {
+	return hasher.config.Cost
+}
+
+// Hash returns the bcrypt hash of the password
+func (hasher *PasswordHasher) Hash(password string) ([]byte, error) {
+	release, err := hasher.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return bcrypt.GenerateFromPassword([]byte(password), hasher.config.Cost)
+}
+
+// Compare returns nil if the password matches the hash, bcrypt.ErrMismatchedHashAndPassword if it does not
+func (hasher *PasswordHasher) Compare(hash []byte, password string) error {
+	release, err := hasher.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return bcrypt.CompareHashAndPassword(hash, []byte(password))
+}
+
+// acquire waits for a free worker and returns the function releasing it
+func (hasher *PasswordHasher) acquire() (func(), error) {
+	release := func() {
+		<-hasher.workers
+	}
+
+	select {
+	case hasher.workers <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if hasher.waiting.Add(1) > int64(hasher.config.QueueLimit) {
+		hasher.waiting.Add(-1)
+		return nil, ErrHasherBusy
+	}
+	defer hasher.waiting.Add(-1)
+
+	timer := time.NewTimer(hasher.config.Timeout)
+	defer timer.Stop()
+
+	select {
+	case hasher.workers <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrHasherBusy
+	}
+}
+
+// CalibrateBcryptCost returns the highest bcrypt cost whose hashing takes at most the target duration on this
+// machine, and never less than bcrypt.MinCost. Each cost step doubles the duration, so the next one is predicted
+// instead of measured
+func CalibrateBcryptCost(target time.Duration) (int, error) {
+	cost := bcrypt.MinCost
+	for cost < bcrypt.MaxCost {
+		start := time.Now()
+		_, err := bcrypt.GenerateFromPassword([]byte("calibration password"), cost)
+		if err != nil {
+			return 0, err
+		}
+		if 2*time.Since(start) > target {
+			break
+		}
+		cost++
+	}
+
+	return cost, nil
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasherConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should accept the default configuration", func(t *testing.T) {
+		config := DefaultPasswordHasherConfig()
+		assert.Nil(t, config.Validate())
+	})
+	t.Run("should reject an invalid configuration", func(t *testing.T) {
+		config := DefaultPasswordHasherConfig()
+		config.Cost = bcrypt.MaxCost + 1
+		assert.NotNil(t, config.Validate())
+
+		config = DefaultPasswordHasherConfig()
+		config.Workers = 0
+		assert.NotNil(t, config.Validate())
+
+		config = DefaultPasswordHasherConfig()
+		config.QueueLimit = -1
+		assert.NotNil(t, config.Validate())
+
+		config = DefaultPasswordHasherConfig()
+		config.Timeout = 0
+		assert.NotNil(t, config.Validate())
+	})
+}
+
+func TestPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	newHasher := func(workers int, queueLimit int, timeout time.Duration) *PasswordHasher {
+		hasher, err := NewPasswordHasher(PasswordHasherConfig{Cost: bcrypt.MinCost, Workers: workers, QueueLimit: queueLimit, Timeout: timeout})
+		require.Nil(t, err)
+		return hasher
+	}
+
+	t.Run("should hash and compare with the configured cost", func(t *testing.T) {
+		hasher := newHasher(1, 0, time.Second)
+
+		hash, err := hasher.Hash("secret")
+		require.Nil(t, err)
+		cost, _ := bcrypt.Cost(hash)
+		assert.Equal(t, bcrypt.MinCost, cost)
+		assert.Nil(t, hasher.Compare(hash, "secret"))
+		assert.Equal(t, bcrypt.ErrMismatchedHashAndPassword, hasher.Compare(hash, "other"))
+	})
+	t.Run("should reject right away when the queue is full", func(t *testing.T) {
+		hasher := newHasher(1, 0, time.Second)
+		release, err := hasher.acquire()
+		require.Nil(t, err)
+		defer release()
+
+		_, err = hasher.Hash("secret")
+		assert.Equal(t, ErrHasherBusy, err)
+	})
+	t.Run("should reject a call waiting longer than the timeout", func(t *testing.T) {
+		hasher := newHasher(1, 1, 20*time.Millisecond)
+		release, err := hasher.acquire()
+		require.Nil(t, err)
+		defer release()
+
+		start := time.Now()
+		err = hasher.Compare([]byte("hash"), "secret")
+		assert.Equal(t, ErrHasherBusy, err)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+	t.Run("a queued call should run once a worker is free", func(t *testing.T) {
+		hasher := newHasher(1, 1, time.Second)
+		release, err := hasher.acquire()
+		require.Nil(t, err)
+
+		result := make(chan error)
+		go func() {
+			_, errHash := hasher.Hash("secret")
+			result <- errHash
+		}()
+		time.Sleep(10 * time.Millisecond)
+		release()
+
+		assert.Nil(t, <-result)
+	})
+}
+
+func TestCalibrateBcryptCost(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should not go below the minimum cost", func(t *testing.T) {
+		cost, err := CalibrateBcryptCost(time.Nanosecond)
+		require.Nil(t, err)
+		assert.Equal(t, bcrypt.MinCost, cost)
+	})
+	t.Run("should keep the hashing under the target", func(t *testing.T) {
+		target := 50 * time.Millisecond
+		cost, err := CalibrateBcryptCost(target)
+		require.Nil(t, err)
+
+		start := time.Now()
+		_, _ = bcrypt.GenerateFromPassword([]byte("password"), cost)
+		// the measurements are noisy, allow some margin
+		assert.Less(t, time.Since(start), 2*target)
+	})
+}
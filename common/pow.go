@@ -0,0 +1,263 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the proof of work challenges
+const (
+	DefaultPoWMinDifficulty = 16
+	DefaultPoWMaxDifficulty = 20
+	DefaultPoWChallengeTTL  = 2 * time.Minute
+	DefaultPoWFailureStep   = 5
+	DefaultPoWFailureWindow = 15 * time.Minute
+	// MaxPoWDifficulty keeps the hardest challenge solvable in a few seconds in a browser
+	MaxPoWDifficulty = 22
+	// MaxPoWClients bounds the clients whose failures are tracked, the others get the minimum difficulty
+	MaxPoWClients = 100000
+	// MaxPoWNonceLength bounds the nonce hashed with the challenge
+	MaxPoWNonceLength = 64
+	// PoWAlgorithm is the hash the solutions are checked with
+	PoWAlgorithm = "sha256"
+)
+
+// ProofOfWorkConfig configures the challenges. The difficulty is the number of leading zero bits the solution hash
+// needs. It starts at MinDifficulty and rises by one bit for every FailureStep failed registrations or logins of
+// the client within FailureWindow, up to MaxDifficulty. A zero FailureStep keeps the difficulty at MinDifficulty
+type ProofOfWorkConfig struct {
+	MinDifficulty int
+	MaxDifficulty int
+	TTL           time.Duration
+	FailureStep   int
+	FailureWindow time.Duration
+}
+
+// DefaultProofOfWorkConfig returns a difficulty costing a fraction of a second to a browser, a few seconds after
+// repeated failures
+func DefaultProofOfWorkConfig() ProofOfWorkConfig {
+	return ProofOfWorkConfig{
+		MinDifficulty: DefaultPoWMinDifficulty,
+		MaxDifficulty: DefaultPoWMaxDifficulty,
+		TTL:           DefaultPoWChallengeTTL,
+		FailureStep:   DefaultPoWFailureStep,
+		FailureWindow: DefaultPoWFailureWindow,
+	}
+}
+
+// Validate checks the difficulty range, the challenge lifetime and the failure tracking
+func (config *ProofOfWorkConfig) Validate() error {
+	if config.MinDifficulty < 1 || config.MaxDifficulty > MaxPoWDifficulty || config.MinDifficulty > config.MaxDifficulty {
+		return fmt.Errorf("the proof of work difficulty must be between 1 and %d bits, the minimum not above the maximum", MaxPoWDifficulty)
+	}
+	if config.TTL <= 0 {
+		return errors.New("the proof of work challenge lifetime must be positive")
+	}
+	if config.FailureStep < 0 {
+		return errors.New("the proof of work failure step must not be negative")
+	}
+	if config.FailureStep > 0 && config.FailureWindow <= 0 {
+		return errors.New("the proof of work failure window must be positive")
+	}
+
+	return nil
+}
+
+// PoWChallenge is a signed challenge. The client looks for a nonce such that the sha256 of Challenge, a colon and the
+// nonce starts with Difficulty zero bits
+type PoWChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// PoWSolution identifies a checked challenge, so it can be used only once
+type PoWSolution struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// ProofOfWork issues and checks the challenges. They are stateless: the id, the difficulty and the expiry are
+// signed with HMAC-SHA256, only the used ids need to be stored
+type ProofOfWork struct {
+	config ProofOfWorkConfig
+	key    []byte
+
+	mu sync.Mutex
+	// failures holds the failed attempts of the clients in their current window
+	failures map[string]*powFailures
+	// pruned is when the expired windows were last removed
+	pruned time.Time
+}
+
+// powFailures counts the failed attempts of a client since the start of its window
+type powFailures struct {
+	count int
+	since time.Time
+}
+
+// NewProofOfWork creates the challenge issuer. The signing key is derived from the provided secret, so the
+// same secret can be shared with other uses
+func NewProofOfWork(config ProofOfWorkConfig, secret []byte) (*ProofOfWork, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("the proof of work needs a signing secret")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("proof-of-work challenges"))
+
+	return &ProofOfWork{
+		config:   config,
+		key:      mac.Sum(nil),
+		failures: make(map[string]*powFailures),
+	}, nil
+}
+
+// Issue creates a challenge for the client with the difficulty matching its recent failures
+func (pow *ProofOfWork) Issue(client string, now time.Time) (*PoWChallenge, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := pow.difficulty(client, now)
+	expiresAt := now.Add(pow.config.TTL).UTC().Truncate(time.Second)
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(id), difficulty, expiresAt.Unix())
+
+	return &PoWChallenge{
+		Challenge:  payload + "." + pow.sign(payload),
+		Algorithm:  PoWAlgorithm,
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify checks the challenge was issued by this server, has not expired and is solved by the nonce.
+// It fails with ErrInvalidChallenge otherwise. Whether the challenge was already used is up to the caller
+func (pow *ProofOfWork) Verify(challenge string, nonce string, now time.Time) (*PoWSolution, error) {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%w: malformed challenge", ErrInvalidChallenge)
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(pow.sign(payload))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidChallenge)
+	}
+
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed difficulty", ErrInvalidChallenge)
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed expiry", ErrInvalidChallenge)
+	}
+	expiresAt := time.Unix(expires, 0).UTC()
+	if !now.Before(expiresAt) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidChallenge)
+	}
+
+	if len(nonce) == 0 || len(nonce) > MaxPoWNonceLength {
+		return nil, fmt.Errorf("%w: the nonce must have between 1 and %d characters", ErrInvalidChallenge, MaxPoWNonceLength)
+	}
+	if PoWLeadingZeroBits(challenge, nonce) < difficulty {
+		return nil, fmt.Errorf("%w: not solved", ErrInvalidChallenge)
+	}
+
+	return &PoWSolution{ID: parts[0], ExpiresAt: expiresAt}, nil
+}
+
+// RecordFailure counts a failed registration or login of the client, raising the difficulty of its next challenges
+func (pow *ProofOfWork) RecordFailure(client string, now time.Time) {
+	if pow.config.FailureStep == 0 {
+		return
+	}
+
+	pow.mu.Lock()
+	defer pow.mu.Unlock()
+
+	if now.Sub(pow.pruned) >= pow.config.FailureWindow {
+		for key, failures := range pow.failures {
+			if now.Sub(failures.since) >= pow.config.FailureWindow {
+				delete(pow.failures, key)
+			}
+		}
+		pow.pruned = now
+	}
+
+	failures, ok := pow.failures[client]
+	if !ok || now.Sub(failures.since) >= pow.config.FailureWindow {
+		if !ok && len(pow.failures) >= MaxPoWClients {
+			return
+		}
+		failures = &powFailures{since: now}
+		pow.failures[client] = failures
+	}
+	failures.count++
+}
+
+// difficulty returns the difficulty of the next challenge of the client
+func (pow *ProofOfWork) difficulty(client string, now time.Time) int {
+	if pow.config.FailureStep == 0 {
+		return pow.config.MinDifficulty
+	}
+
+	pow.mu.Lock()
+	defer pow.mu.Unlock()
+
+	failures, ok := pow.failures[client]
+	if !ok || now.Sub(failures.since) >= pow.config.FailureWindow {
+		return pow.config.MinDifficulty
+	}
+	difficulty := pow.config.MinDifficulty + failures.count/pow.config.FailureStep
+
+	return min(difficulty, pow.config.MaxDifficulty)
+}
+
+func (pow *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, pow.key)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// PoWLeadingZeroBits returns the number of leading zero bits of the sha256 of the challenge, a colon and the nonce
+func PoWLeadingZeroBits(challenge string, nonce string) int {
+	hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+
+	return zeros
+}
+
+// SolvePoW finds a nonce solving the challenge. It is what the clients do, kept here for the tools and the tests
+func SolvePoW(challenge *PoWChallenge) string {
+	for i := uint64(0); ; i++ {
+		nonce := strconv.FormatUint(i, 36)
+		if PoWLeadingZeroBits(challenge.Challenge, nonce) >= challenge.Difficulty {
+			return nonce
+		}
+	}
+}
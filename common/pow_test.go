@@ -0,0 +1,124 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofOfWorkConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultProofOfWorkConfig()
+	assert.Nil(t, config.Validate())
+
+	for _, invalid := range []ProofOfWorkConfig{
+		{MinDifficulty: 0, MaxDifficulty: 8, TTL: time.Minute},
+		{MinDifficulty: 8, MaxDifficulty: 4, TTL: time.Minute},
+		{MinDifficulty: 8, MaxDifficulty: MaxPoWDifficulty + 1, TTL: time.Minute},
+		{MinDifficulty: 8, MaxDifficulty: 8},
+		{MinDifficulty: 8, MaxDifficulty: 8, TTL: time.Minute, FailureStep: -1},
+		{MinDifficulty: 8, MaxDifficulty: 8, TTL: time.Minute, FailureStep: 1},
+	} {
+		assert.NotNil(t, invalid.Validate(), "config %+v", invalid)
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 10, 12, 0, 30, 0, time.UTC)
+	newProofOfWork := func(failureStep int) *ProofOfWork {
+		config := ProofOfWorkConfig{MinDifficulty: 8, MaxDifficulty: 10, TTL: time.Minute, FailureStep: failureStep, FailureWindow: 10 * time.Minute}
+		pow, err := NewProofOfWork(config, []byte("secret"))
+		require.Nil(t, err)
+		return pow
+	}
+
+	t.Run("should accept a solved challenge", func(t *testing.T) {
+		pow := newProofOfWork(0)
+		challenge, err := pow.Issue("client", now)
+		require.Nil(t, err)
+		assert.Equal(t, 8, challenge.Difficulty)
+		assert.Equal(t, PoWAlgorithm, challenge.Algorithm)
+		assert.Equal(t, now.Add(time.Minute), challenge.ExpiresAt)
+
+		nonce := SolvePoW(challenge)
+		assert.GreaterOrEqual(t, PoWLeadingZeroBits(challenge.Challenge, nonce), 8)
+		solution, err := pow.Verify(challenge.Challenge, nonce, now)
+		require.Nil(t, err)
+		assert.Equal(t, challenge.ExpiresAt, solution.ExpiresAt)
+		assert.Equal(t, strings.Split(challenge.Challenge, ".")[0], solution.ID)
+
+		// every challenge is different
+		other, _ := pow.Issue("client", now)
+		assert.NotEqual(t, challenge.Challenge, other.Challenge)
+	})
+	t.Run("should reject the unsolved, expired or forged challenges", func(t *testing.T) {
+		pow := newProofOfWork(0)
+		challenge, _ := pow.Issue("client", now)
+		nonce := SolvePoW(challenge)
+
+		unsolved := "0"
+		for PoWLeadingZeroBits(challenge.Challenge, unsolved) >= 8 {
+			unsolved += "0"
+		}
+		_, err := pow.Verify(challenge.Challenge, unsolved, now)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+
+		_, err = pow.Verify(challenge.Challenge, nonce, challenge.ExpiresAt)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+
+		// lowering the difficulty breaks the signature
+		parts := strings.Split(challenge.Challenge, ".")
+		parts[1] = "1"
+		_, err = pow.Verify(strings.Join(parts, "."), nonce, now)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+
+		// so does a different secret
+		other, _ := NewProofOfWork(ProofOfWorkConfig{MinDifficulty: 8, MaxDifficulty: 10, TTL: time.Minute}, []byte("other"))
+		_, err = other.Verify(challenge.Challenge, nonce, now)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+
+		_, err = pow.Verify("garbage", nonce, now)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+		_, err = pow.Verify(challenge.Challenge, strings.Repeat("a", MaxPoWNonceLength+1), now)
+		assert.True(t, errors.Is(err, ErrInvalidChallenge))
+	})
+	t.Run("should raise the difficulty with the failures of the client", func(t *testing.T) {
+		pow := newProofOfWork(2)
+		difficulties := make([]int, 0)
+		for i := 0; i < 6; i++ {
+			challenge, _ := pow.Issue("client", now)
+			difficulties = append(difficulties, challenge.Difficulty)
+			pow.RecordFailure("client", now)
+		}
+		assert.Equal(t, []int{8, 8, 9, 9, 10, 10}, difficulties)
+
+		// issuing challenges alone does not raise it
+		for i := 0; i < 10; i++ {
+			challenge, _ := pow.Issue("other", now)
+			assert.Equal(t, 8, challenge.Difficulty)
+		}
+
+		// the failures are forgotten after the window
+		challenge, _ := pow.Issue("client", now.Add(9*time.Minute))
+		assert.Equal(t, 10, challenge.Difficulty)
+		challenge, _ = pow.Issue("client", now.Add(10*time.Minute))
+		assert.Equal(t, 8, challenge.Difficulty)
+		pow.RecordFailure("other", now.Add(10*time.Minute))
+		assert.NotContains(t, pow.failures, "client")
+	})
+	t.Run("should keep the difficulty fixed without a failure step", func(t *testing.T) {
+		pow := newProofOfWork(0)
+		for i := 0; i < 5; i++ {
+			pow.RecordFailure("client", now)
+		}
+		challenge, _ := pow.Issue("client", now)
+		assert.Equal(t, 8, challenge.Difficulty)
+	})
+}
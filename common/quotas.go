@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Quota limits the amount a user can increment the counters by, over all the counters, in each window of the period.
+// The period is one of the statistics granularities and the windows are aligned to it, in UTC
+type Quota struct {
+	Limit  uint64 `json:"limit"`
+	Period string `json:"period"`
+}
+
+// Validate checks the quota period is known
+func (quota *Quota) Validate() error {
+	_, err := BucketSize(quota.Period)
+	if err != nil {
+		return fmt.Errorf("%w: unknown period %q", ErrInvalidQuota, quota.Period)
+	}
+
+	return nil
+}
+
+// QuotaStatus describes the quota applying to a user. Quota is nil when the user is unlimited, Source tells
+// where it comes from: "user" for an override, "role:<role>" otherwise
+type QuotaStatus struct {
+	Username  string    `json:"username"`
+	Override  *Quota    `json:"override,omitempty"`
+	Quota     *Quota    `json:"quota,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Used      uint64    `json:"used"`
+	Remaining uint64    `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at,omitempty"`
+}
+
+// QuotaExceededError is returned when an increment would exceed the user quota. It matches ErrQuotaExceeded
+type QuotaExceededError struct {
+	Limit     uint64
+	Remaining uint64
+	ResetAt   time.Time
+}
+
+// Error returns the error message
+func (err *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %d remaining of %d until %s", ErrQuotaExceeded.Error(), err.Remaining, err.Limit, err.ResetAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is match ErrQuotaExceeded
+func (err *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ResetSchedule resets a counter at the times matching the cron expression, evaluated in the time zone.
+// NextRun is advanced together with every reset, so a schedule fires at most once per due time
+type ResetSchedule struct {
+	ID        string     `json:"id"`
+	Counter   string     `json:"counter"`
+	Cron      string     `json:"cron"`
+	Timezone  string     `json:"timezone"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	NextRun   time.Time  `json:"next_run"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	// LastError holds the reason the last due reset was skipped, if any
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Next returns the first time matching the schedule strictly after the provided time, in UTC
+func (schedule *ResetSchedule) Next(after time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, schedule.Timezone)
+	}
+	parsed, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	next := parsed.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: %q never fires", ErrInvalidSchedule, schedule.Cron)
+	}
+
+	return next.UTC(), nil
+}
+
+// CounterPeriod is an archived counter period: the value the counter had when it was reset at End.
+// Seq is the sequence of the reset event. Start is the end of the previous period or the counter creation time, if known
+type CounterPeriod struct {
+	Seq        uint64     `json:"seq"`
+	Start      *time.Time `json:"start,omitempty"`
+	End        time.Time  `json:"end"`
+	Value      uint64     `json:"value"`
+	ScheduleID string     `json:"schedule_id,omitempty"`
+}
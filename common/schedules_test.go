@@ -0,0 +1,48 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetSchedule_Next(t *testing.T) {
+	t.Parallel()
+
+	// Saturday, 2026-10-17 12:00 UTC
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should evaluate the cron expression in the time zone", func(t *testing.T) {
+		schedule := ResetSchedule{Cron: "0 0 * * MON", Timezone: "Europe/Bucharest"}
+		next, err := schedule.Next(now)
+		assert.Nil(t, err)
+		// midnight in Bucharest is 21:00 UTC the day before, during the summer time
+		assert.Equal(t, time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC), next)
+
+		schedule.Timezone = "UTC"
+		next, err = schedule.Next(now)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), next)
+	})
+	t.Run("should be strictly after the provided time", func(t *testing.T) {
+		schedule := ResetSchedule{Cron: "@hourly", Timezone: "UTC"}
+		next, err := schedule.Next(now)
+		assert.Nil(t, err)
+		assert.Equal(t, now.Add(time.Hour), next)
+	})
+	t.Run("should reject the invalid schedules", func(t *testing.T) {
+		schedule := ResetSchedule{Cron: "every monday", Timezone: "UTC"}
+		_, err := schedule.Next(now)
+		assert.True(t, errors.Is(err, ErrInvalidSchedule))
+
+		schedule = ResetSchedule{Cron: "0 0 * * MON", Timezone: "Mars/Olympus"}
+		_, err = schedule.Next(now)
+		assert.True(t, errors.Is(err, ErrInvalidSchedule))
+
+		schedule = ResetSchedule{Cron: "0 0 30 2 *", Timezone: "UTC"}
+		_, err = schedule.Next(now)
+		assert.True(t, errors.Is(err, ErrInvalidSchedule))
+	})
+}
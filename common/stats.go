@@ -0,0 +1,58 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Counter statistics granularities
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+)
+
+// Granularities lists the counter statistics granularities, the finest first
+var Granularities = []string{GranularityMinute, GranularityHour, GranularityDay}
+
+// CounterStat holds the amount the counter was incremented by in the bucket starting at Start
+type CounterStat struct {
+	Start      time.Time `json:"start"`
+	Increments uint64    `json:"increments"`
+}
+
+// StatsRetention defines how long the statistics buckets are kept for each granularity. 0 keeps them forever
+type StatsRetention map[string]time.Duration
+
+// DefaultStatsRetention keeps the minute buckets for 2 days, the hour buckets for 90 days and the day buckets forever
+func DefaultStatsRetention() StatsRetention {
+	return StatsRetention{
+		GranularityMinute: 48 * time.Hour,
+		GranularityHour:   90 * 24 * time.Hour,
+		GranularityDay:    0,
+	}
+}
+
+// BucketSize returns the duration of the buckets of the granularity
+func BucketSize(granularity string) (time.Duration, error) {
+	switch granularity {
+	case GranularityMinute:
+		return time.Minute, nil
+	case GranularityHour:
+		return time.Hour, nil
+	case GranularityDay:
+		return 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrInvalidGranularity, granularity)
+	}
+}
+
+// BucketStart returns the start of the UTC bucket of the granularity containing the timestamp
+func BucketStart(timestamp time.Time, granularity string) (time.Time, error) {
+	size, err := BucketSize(granularity)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return timestamp.UTC().Truncate(size), nil
+}
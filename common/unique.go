@@ -0,0 +1,49 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// PeriodMonth is the UTC calendar month, the unique visitors are also estimated per month
+const PeriodMonth = "month"
+
+// UniqueVisitors holds the estimated number of distinct users and anonymous visitors that incremented a counter.
+// The day, week and month estimates refer to the periods containing Date and are only set when the daily
+// sketches are kept
+type UniqueVisitors struct {
+	Counter string  `json:"counter"`
+	Date    string  `json:"date,omitempty"`
+	All     uint64  `json:"all"`
+	Day     *uint64 `json:"day,omitempty"`
+	Week    *uint64 `json:"week,omitempty"`
+	Month   *uint64 `json:"month,omitempty"`
+}
+
+// UserVisitorKey identifies a registered user in the unique visitors sketches
+func UserVisitorKey(username string) string {
+	return "user:" + CanonicalUsername(username)
+}
+
+// AnonymousVisitorKey identifies an anonymous visitor in the unique visitors sketches
+func AnonymousVisitorKey(visitorID string) string {
+	return "visitor:" + visitorID
+}
+
+// PeriodDays returns the first day and the day after the last day of the period containing the timestamp:
+// the UTC day, the ISO week (Monday to Sunday) or the calendar month
+func PeriodDays(period string, timestamp time.Time) (time.Time, time.Time, error) {
+	day := timestamp.UTC().Truncate(24 * time.Hour)
+	switch period {
+	case PeriodDay:
+		return day, day.AddDate(0, 0, 1), nil
+	case PeriodWeek:
+		start := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7), nil
+	case PeriodMonth:
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+}
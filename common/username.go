@@ -0,0 +1,105 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// DefaultUsernameMinLength is the default minimum username length, in characters
+	DefaultUsernameMinLength = 3
+	// DefaultUsernameMaxLength is the default maximum username length, in characters
+	DefaultUsernameMaxLength = 32
+	// DefaultUsernamePattern is the default set of characters allowed in a username
+	DefaultUsernamePattern = `^[a-zA-Z0-9][a-zA-Z0-9._-]*$`
+)
+
+// DefaultReservedUsernames contains the names that can not be registered by default
+var DefaultReservedUsernames = []string{"admin", "administrator", "root", "system", "superadmin"}
+
+// ErrInvalidUsername signals that a username does not satisfy the configured rules
+var ErrInvalidUsername = errors.New("invalid username")
+
+// UsernameRules defines the constraints a new username must satisfy
+type UsernameRules struct {
+	MinLength int
+	MaxLength int
+	Pattern   *regexp.Regexp
+	Reserved  []string
+}
+
+// NewUsernameRules creates the username rules, compiling the provided pattern
+func NewUsernameRules(minLength int, maxLength int, pattern string, reserved []string) (UsernameRules, error) {
+	if minLength < 1 {
+		return UsernameRules{}, fmt.Errorf("invalid username min length %d", minLength)
+	}
+	if maxLength < minLength {
+		return UsernameRules{}, fmt.Errorf("invalid username max length %d, should be at least %d", maxLength, minLength)
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return UsernameRules{}, fmt.Errorf("%w while compiling the username pattern", err)
+	}
+
+	return UsernameRules{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		Pattern:   compiled,
+		Reserved:  reserved,
+	}, nil
+}
+
+// DefaultUsernameRules returns the rules used when nothing else is configured
+func DefaultUsernameRules() UsernameRules {
+	return UsernameRules{
+		MinLength: DefaultUsernameMinLength,
+		MaxLength: DefaultUsernameMaxLength,
+		Pattern:   regexp.MustCompile(DefaultUsernamePattern),
+		Reserved:  DefaultReservedUsernames,
+	}
+}
+
+// Validate checks the username against the rules. The check is done on the display form
+// (see DisplayUsername) so compatibility characters (e.g. full-width letters) are treated as their plain equivalents
+func (rules UsernameRules) Validate(username string) error {
+	display := DisplayUsername(username)
+
+	length := utf8.RuneCountInString(display)
+	if length < rules.MinLength || length > rules.MaxLength {
+		return fmt.Errorf("%w: length should be between %d and %d characters", ErrInvalidUsername, rules.MinLength, rules.MaxLength)
+	}
+	if rules.Pattern != nil && !rules.Pattern.MatchString(display) {
+		return fmt.Errorf("%w: contains characters that are not allowed", ErrInvalidUsername)
+	}
+
+	canonical := CanonicalUsername(display)
+	for _, reserved := range rules.Reserved {
+		if CanonicalUsername(reserved) == canonical {
+			return fmt.Errorf("%w: the name is reserved", ErrInvalidUsername)
+		}
+	}
+
+	return nil
+}
+
+// DisplayUsername returns the NFKC normalized form of the username, preserving its case
+func DisplayUsername(username string) string {
+	return norm.NFKC.String(username)
+}
+
+// CanonicalUsername returns the form used to identify a user: NFKC normalized and case folded,
+// so that "Admin", "ADMIN" and "Ａｄｍｉｎ" all map to the same account
+func CanonicalUsername(username string) string {
+	// a Caser is stateful so it can not be shared between goroutines
+	folded := cases.Fold().String(norm.NFKC.String(username))
+
+	// case folding can produce sequences that are no longer NFKC normalized
+	return norm.NFKC.String(strings.TrimSpace(folded))
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalUsername(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should fold the case", func(t *testing.T) {
+		assert.Equal(t, "admin", CanonicalUsername("Admin"))
+		assert.Equal(t, "admin", CanonicalUsername("ADMIN"))
+		assert.Equal(t, "strasse", CanonicalUsername("STRASSE"))
+		assert.Equal(t, CanonicalUsername("Straße"), CanonicalUsername("STRASSE"))
+	})
+	t.Run("should apply NFKC", func(t *testing.T) {
+		assert.Equal(t, "admin", CanonicalUsername("Ａｄｍｉｎ"))
+		assert.Equal(t, CanonicalUsername("é"), CanonicalUsername("é"))
+	})
+	t.Run("display form should keep the case", func(t *testing.T) {
+		assert.Equal(t, "Admin", DisplayUsername("Ａｄｍｉｎ"))
+	})
+}
+
+func TestNewUsernameRules(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid min length should error", func(t *testing.T) {
+		_, err := NewUsernameRules(0, 10, DefaultUsernamePattern, nil)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "invalid username min length 0")
+	})
+	t.Run("max length lower than min length should error", func(t *testing.T) {
+		_, err := NewUsernameRules(5, 4, DefaultUsernamePattern, nil)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "invalid username max length 4")
+	})
+	t.Run("invalid pattern should error", func(t *testing.T) {
+		_, err := NewUsernameRules(1, 4, "[", nil)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "while compiling the username pattern")
+	})
+	t.Run("should work", func(t *testing.T) {
+		rules, err := NewUsernameRules(1, 4, DefaultUsernamePattern, []string{"x"})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, rules.MinLength)
+		assert.Equal(t, 4, rules.MaxLength)
+		assert.Equal(t, []string{"x"}, rules.Reserved)
+	})
+}
+
+func TestUsernameRules_Validate(t *testing.T) {
+	t.Parallel()
+
+	rules := DefaultUsernameRules()
+
+	invalidNames := []string{
+		"",
+		"ab",
+		strings.Repeat("a", DefaultUsernameMaxLength+1),
+		" alice",
+		"alice bob",
+		"аlice", // starts with a cyrillic a
+		".alice",
+		"Admin",
+		"ＲＯＯＴ",
+	}
+	for _, name := range invalidNames {
+		err := rules.Validate(name)
+		assert.True(t, errors.Is(err, ErrInvalidUsername), "name %q should be invalid", name)
+	}
+
+	validNames := []string{
+		"alice",
+		"Alice.Bob",
+		"user_01",
+		"Ａｌｉｃｅ",
+	}
+	for _, name := range validNames {
+		assert.Nil(t, rules.Validate(name), "name %q should be valid", name)
+	}
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Webhook event types
+const (
+	WebhookEventCounterIncremented = "counter.incremented"
+	WebhookEventCounterReset       = "counter.reset"
+	WebhookEventCounterThreshold   = "counter.threshold"
+	WebhookEventUserRegistered     = "user.registered"
+)
+
+// WebhookEvents lists the webhook event types
+var WebhookEvents = []string{WebhookEventCounterIncremented, WebhookEventCounterReset, WebhookEventCounterThreshold, WebhookEventUserRegistered}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Threshold crossing directions
+const (
+	ThresholdUp   = "up"
+	ThresholdDown = "down"
+)
+
+// Webhook is a subscription notifying the URL of the events of the listed types. Counter optionally restricts
+// the counter events to one counter and Thresholds are the values whose crossing raises a counter.threshold event
+type Webhook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	Counter    string    `json:"counter,omitempty"`
+	Thresholds []uint64  `json:"thresholds,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the payload delivered to the webhooks. Change is set for the counter events, Threshold and
+// Direction for the threshold crossings
+type WebhookEvent struct {
+	Type      string         `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	Counter   string         `json:"counter,omitempty"`
+	Username  string         `json:"username,omitempty"`
+	Change    *CounterChange `json:"change,omitempty"`
+	Threshold *uint64        `json:"threshold,omitempty"`
+	Direction string         `json:"direction,omitempty"`
+}
+
+// WebhookAttempt records one delivery attempt: the receiver status code or the error that prevented the delivery
+type WebhookAttempt struct {
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Succeeded returns true if the receiver accepted the delivery with a 2xx status
+func (attempt *WebhookAttempt) Succeeded() bool {
+	return len(attempt.Error) == 0 && attempt.StatusCode >= 200 && attempt.StatusCode < 300
+}
+
+// WebhookDelivery is an entry of the delivery log of a webhook. NextAttempt is set while the delivery is pending
+type WebhookDelivery struct {
+	ID          string           `json:"id"`
+	WebhookID   string           `json:"webhook_id"`
+	Event       WebhookEvent     `json:"event"`
+	Status      string           `json:"status"`
+	Attempts    []WebhookAttempt `json:"attempts"`
+	NextAttempt *time.Time       `json:"next_attempt,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// Validate checks the webhook URL is an absolute HTTP(S) URL and the event types are known
+func (hook *Webhook) Validate() error {
+	parsed, err := url.Parse(hook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return fmt.Errorf("%w: the URL must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if len(hook.Events) == 0 {
+		return fmt.Errorf("%w: at least one event type is required", ErrInvalidWebhook)
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, event)
+		}
+	}
+	if slices.Contains(hook.Events, WebhookEventCounterThreshold) && len(hook.Thresholds) == 0 {
+		return fmt.Errorf("%w: the %s event requires thresholds", ErrInvalidWebhook, WebhookEventCounterThreshold)
+	}
+
+	return nil
+}
+
+// Match returns the events the webhook is notified of for the event: the event itself, if subscribed to,
+// and for the counter changes, the crossings of the webhook thresholds. An event without a type only raises
+// the threshold crossings
+func (hook *Webhook) Match(event WebhookEvent) []WebhookEvent {
+	if len(event.Counter) > 0 && len(hook.Counter) > 0 && hook.Counter != event.Counter {
+		return nil
+	}
+
+	var matches []WebhookEvent
+	if len(event.Type) > 0 && slices.Contains(hook.Events, event.Type) {
+		matches = append(matches, event)
+	}
+	if event.Change == nil || !slices.Contains(hook.Events, WebhookEventCounterThreshold) {
+		return matches
+	}
+
+	for _, threshold := range hook.Thresholds {
+		direction := ""
+		switch {
+		case event.Change.Old < threshold && event.Change.New >= threshold:
+			direction = ThresholdUp
+		case event.Change.New < threshold && event.Change.Old >= threshold:
+			direction = ThresholdDown
+		default:
+			continue
+		}
+
+		crossing := event
+		crossing.Type = WebhookEventCounterThreshold
+		crossing.Threshold = &threshold
+		crossing.Direction = direction
+		matches = append(matches, crossing)
+	}
+
+	return matches
+}
+
+// WebhookSignature returns the hex HMAC-SHA256 of the timestamp and the body, joined by a dot, keyed with the webhook secret.
+// The receivers recompute it to authenticate the deliveries
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook_Validate(t *testing.T) {
+	t.Parallel()
+
+	hook := Webhook{URL: "https://example.com/hook", Events: []string{WebhookEventCounterReset}}
+	assert.Nil(t, hook.Validate())
+
+	invalid := []Webhook{
+		{URL: "example.com/hook", Events: []string{WebhookEventCounterReset}},
+		{URL: "ftp://example.com/hook", Events: []string{WebhookEventCounterReset}},
+		{URL: "https://example.com/hook"},
+		{URL: "https://example.com/hook", Events: []string{"counter.deleted"}},
+		{URL: "https://example.com/hook", Events: []string{WebhookEventCounterThreshold}},
+	}
+	for _, hook := range invalid {
+		assert.True(t, errors.Is(hook.Validate(), ErrInvalidWebhook), hook)
+	}
+}
+
+func TestWebhook_Match(t *testing.T) {
+	t.Parallel()
+
+	event := WebhookEvent{
+		Type:      WebhookEventCounterIncremented,
+		Timestamp: time.Now(),
+		Counter:   "visits",
+		Change:    &CounterChange{Old: 8, New: 12},
+	}
+
+	t.Run("should match the subscribed event types and counter", func(t *testing.T) {
+		hook := Webhook{Events: []string{WebhookEventCounterIncremented}}
+		assert.Equal(t, []WebhookEvent{event}, hook.Match(event))
+
+		hook.Counter = "builds"
+		assert.Empty(t, hook.Match(event))
+
+		hook = Webhook{Events: []string{WebhookEventCounterReset}}
+		assert.Empty(t, hook.Match(event))
+	})
+	t.Run("should raise the threshold crossings", func(t *testing.T) {
+		hook := Webhook{Events: []string{WebhookEventCounterThreshold}, Thresholds: []uint64{5, 10, 12, 20}}
+		matches := hook.Match(event)
+		require.Len(t, matches, 2)
+		assert.Equal(t, WebhookEventCounterThreshold, matches[0].Type)
+		assert.Equal(t, uint64(10), *matches[0].Threshold)
+		assert.Equal(t, ThresholdUp, matches[0].Direction)
+		assert.Equal(t, uint64(12), *matches[1].Threshold)
+
+		reset := WebhookEvent{Type: WebhookEventCounterReset, Counter: "visits", Change: &CounterChange{Old: 12, New: 0}}
+		matches = hook.Match(reset)
+		require.Len(t, matches, 3)
+		assert.Equal(t, ThresholdDown, matches[2].Direction)
+
+		// the changes that are not subscribed to still raise the crossings
+		set := WebhookEvent{Counter: "visits", Change: &CounterChange{Old: 0, New: 5}}
+		assert.Len(t, hook.Match(set), 1)
+	})
+}
+
+func TestWebhookSignature(t *testing.T) {
+	t.Parallel()
+
+	signature := WebhookSignature("secret", 1700000000, []byte(`{"type":"user.registered"}`))
+	assert.Len(t, signature, 64)
+	assert.Equal(t, signature, WebhookSignature("secret", 1700000000, []byte(`{"type":"user.registered"}`)))
+	assert.NotEqual(t, signature, WebhookSignature("other", 1700000000, []byte(`{"type":"user.registered"}`)))
+	assert.NotEqual(t, signature, WebhookSignature("secret", 1700000001, []byte(`{"type":"user.registered"}`)))
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxWindowBuckets bounds the ring of a sliding window counter
+const MaxWindowBuckets = 3600
+
+// SlidingWindow makes a counter keep its increments in a ring of buckets of Resolution each, covering MaxWindow.
+// The durations use the Go syntax, e.g. "10s" and "1h"
+type SlidingWindow struct {
+	Resolution string `json:"resolution"`
+	MaxWindow  string `json:"max_window"`
+}
+
+// Durations returns the validated resolution and maximum window. The resolution is whole seconds and divides
+// the maximum window into at most MaxWindowBuckets buckets
+func (window *SlidingWindow) Durations() (time.Duration, time.Duration, error) {
+	resolution, err := time.ParseDuration(window.Resolution)
+	if err != nil || resolution < time.Second || resolution%time.Second != 0 {
+		return 0, 0, fmt.Errorf("%w: the resolution %q must be whole seconds", ErrInvalidWindow, window.Resolution)
+	}
+	maxWindow, err := time.ParseDuration(window.MaxWindow)
+	if err != nil || maxWindow < resolution || maxWindow%resolution != 0 {
+		return 0, 0, fmt.Errorf("%w: the max window %q must be a multiple of the resolution", ErrInvalidWindow, window.MaxWindow)
+	}
+	if maxWindow/resolution > MaxWindowBuckets {
+		return 0, 0, fmt.Errorf("%w: more than %d buckets", ErrInvalidWindow, MaxWindowBuckets)
+	}
+
+	return resolution, maxWindow, nil
+}
+
+// CounterRate holds the increments of a sliding window counter in the buckets starting in [From, To). The
+// requested window is rounded up to whole buckets and the current bucket, still filling, is included
+type CounterRate struct {
+	Counter    string    `json:"counter"`
+	Window     string    `json:"window"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Increments uint64    `json:"increments"`
+}
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	// the reset schedules time zones must not depend on the host zoneinfo
+	_ "time/tzdata"
 
 	"FullStackApp01/api"
 	"FullStackApp01/common"
@@ -25,11 +31,14 @@ const (
 	helpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 USAGE:
-   {{.HelpName}} {{if .VisibleFlags}}[global options]{{end}}
+   {{.HelpName}} {{if .VisibleFlags}}[global options]{{end}}{{if .VisibleCommands}} [command] [command options]{{end}}
    {{if len .Authors}}
 AUTHOR:
    {{range .Authors}}{{ . }}{{end}}
-   {{end}}{{if .Commands}}
+   {{end}}{{if .VisibleCommands}}
+COMMANDS:
+   {{range .VisibleCommands}}{{join .Names ", "}}{{"\t"}}{{.Usage}}
+   {{end}}{{end}}{{if .Commands}}
 GLOBAL OPTIONS:
    {{range .VisibleFlags}}{{.}}
    {{end}}
@@ -41,6 +50,14 @@ VERSION:
 	logsPath          = "log"
 	logsLifeSpan      = time.Hour * 24
 	logsFileLimitInMB = 1024
+	dbPath            = "data"
+	purgeInterval     = time.Hour
+	scheduleInterval  = 10 * time.Second
+	webhookInterval   = 5 * time.Second
+	deliveryRetention = 30 * 24 * time.Hour
+
+	defaultAdminUsername = "admin"
+	maxPassLength        = 72
 )
 
 var (
@@ -96,6 +113,7 @@ func initCliFlags() {
 	cliApp.Flags = []cli.Flag{
 		logLevel,
 	}
+	cliApp.Commands = commands()
 }
 
 func startApp(c *cli.Context) error {
@@ -124,18 +142,55 @@ func startApp(c *cli.Context) error {
 		return errors.New("JWT_KEY is not set in the .env file")
 	}
 
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
-	if len(adminPassword) == 0 {
-		return errors.New("ADMIN_PASSWORD is not set in the .env file")
-	}
-
 	backendInterface := os.Getenv("BACKEND_INTERFACE")
 	if len(backendInterface) == 0 {
 		return errors.New("BACKEND_INTERFACE is not set in the .env file")
 	}
 
+	usernameRules, err := loadUsernameRules()
+	if err != nil {
+		return err
+	}
+
+	statsRetention, err := loadStatsRetention()
+	if err != nil {
+		return err
+	}
+
+	idempotencyTTL := api.DefaultIdempotencyTTL
+	if value := os.Getenv("IDEMPOTENCY_TTL"); len(value) > 0 {
+		idempotencyTTL, err = time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid IDEMPOTENCY_TTL: %w", err)
+		}
+	}
+
+	resetUndoWindow := api.DefaultResetUndoWindow
+	if value := os.Getenv("RESET_UNDO_WINDOW"); len(value) > 0 {
+		resetUndoWindow, err = time.ParseDuration(value)
+		if err != nil || resetUndoWindow <= 0 {
+			return fmt.Errorf("invalid RESET_UNDO_WINDOW %q, expected a positive duration", value)
+		}
+	}
+
+	powConfig, err := loadProofOfWorkConfig()
+	if err != nil {
+		return err
+	}
+
+	hasherConfig, err := loadPasswordHasherConfig()
+	if err != nil {
+		return err
+	}
+	hasher, err := common.NewPasswordHasher(hasherConfig)
+	if err != nil {
+		return fmt.Errorf("invalid password hashing configuration: %w", err)
+	}
+	log.Info("password hashing", "bcrypt cost", hasherConfig.Cost, "workers", hasherConfig.Workers,
+		"queue limit", hasherConfig.QueueLimit, "timeout", hasherConfig.Timeout)
+
 	// Create or open a database in the "data" folder
-	store, err := storage.NewStore("data")
+	store, err := storage.NewStore(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -143,23 +198,149 @@ func startApp(c *cli.Context) error {
 		_ = store.Close()
 	}()
 
-	// Ensure an admin exists
-	_ = store.SaveUser("admin", adminPassword, "admin")
+	store.SetPasswordHasher(hasher)
+	if value := os.Getenv("UNIQUE_VISITORS_DAILY"); len(value) > 0 {
+		daily, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid UNIQUE_VISITORS_DAILY: %w", err)
+		}
+		store.SetDailyUniqueVisitors(daily)
+	}
+
+	groupCommit, err := loadGroupCommit()
+	if err != nil {
+		return err
+	}
+	if groupCommit != nil {
+		err = store.EnableGroupCommit(*groupCommit)
+		if err != nil {
+			return fmt.Errorf("failed to enable the group commit: %w", err)
+		}
+		log.Info("counter increments group commit enabled", "interval", groupCommit.Interval, "durability", groupCommit.Durability)
+	}
+
+	report, err := store.MigrateUsernames(false)
+	if err != nil {
+		return fmt.Errorf("failed to migrate usernames: %w", err)
+	}
+	logUsernameMigrationReport(report)
 
 	server := api.NewServer(store, appVersion, []byte(jwtKey))
+	server.SetUsernameRules(usernameRules)
+	server.SetPasswordHasher(hasher)
+	server.SetIdempotencyTTL(idempotencyTTL)
+	server.SetResetUndoWindow(resetUndoWindow)
+	if powConfig != nil {
+		pow, errPoW := common.NewProofOfWork(*powConfig, []byte(jwtKey))
+		if errPoW != nil {
+			return fmt.Errorf("invalid proof of work configuration: %w", errPoW)
+		}
+		server.SetProofOfWork(pow)
+		log.Info("proof of work required on registration and login", "min difficulty", powConfig.MinDifficulty,
+			"max difficulty", powConfig.MaxDifficulty, "failure step", powConfig.FailureStep, "failure window", powConfig.FailureWindow, "challenge lifetime", powConfig.TTL)
+	}
+	server.SetTenantStorageProvider(func(tenantID string) api.Storage {
+		return store.ForTenant(tenantID)
+	})
+
+	err = ensureAdmin(store, server)
+	if err != nil {
+		return err
+	}
+
+	stopPurge := startPeriodic(purgeInterval, func() {
+		purgeExpired(store.ListTenants, map[string]tenantPurge{
+			"idempotency records": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeIdempotencyRecords()
+			},
+			"counter statistics": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeCounterStats(statsRetention)
+			},
+			"contributions": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeContributions()
+			},
+			"webhook deliveries": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeWebhookDeliveries(deliveryRetention)
+			},
+			"quota usage": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeQuotaUsage()
+			},
+			"reset undo slots": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeResetUndos(resetUndoWindow)
+			},
+			"daily unique visitor sketches": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeUniqueVisitors(statsRetention[common.GranularityDay])
+			},
+			"used proof of work challenges": func(tenantID string) (int, error) {
+				return store.ForTenant(tenantID).PurgeUsedChallenges()
+			},
+		})
+	})
+	defer stopPurge()
+
+	stopSchedules := startPeriodic(scheduleInterval, func() {
+		server.RunScheduledResets(time.Now())
+	})
+	defer stopSchedules()
+
+	stopWebhooks := startPeriodic(webhookInterval, func() {
+		server.DeliverWebhooks(time.Now())
+	})
+	defer stopWebhooks()
 
 	// Create a new ServeMux to avoid global state issues if we expand later
 	mux := http.NewServeMux()
 	mux.HandleFunc("/register", server.HandleRegister)
 	mux.HandleFunc("/login", server.HandleLogin)
+	mux.HandleFunc("/challenge", server.HandleChallenge)
 	mux.HandleFunc("/change-password", server.HandleChangePassword)
 	mux.HandleFunc("/counter", server.HandleCounter)
+	mux.HandleFunc("/counter/history", server.HandleCounterHistory)
+	mux.HandleFunc("/counter/stats", server.HandleCounterStats)
+	mux.HandleFunc("/counter/leaderboard", server.HandleLeaderboard)
+	mux.HandleFunc("/counter/stream", server.HandleCounterStream)
+	mux.HandleFunc("/counter/periods", server.HandleCounterPeriods)
+	mux.HandleFunc("/counter/restore", server.HandleCounterRestore)
+	mux.HandleFunc("/counter/unique", server.HandleCounterUnique)
+	mux.HandleFunc("/counter/acl", server.HandleCounterACL)
+	mux.HandleFunc("/counters", server.HandleCounters)
+	mux.HandleFunc("/counters/{name}", server.HandleNamedCounter)
+	mux.HandleFunc("/counters/{name}/reset", server.HandleCounterReset)
+	mux.HandleFunc("/counters/{name}/restore", server.HandleCounterRestore)
+	mux.HandleFunc("/counters/{name}/unique", server.HandleCounterUnique)
+	mux.HandleFunc("/counters/{name}/rate", server.HandleCounterRate)
+	mux.HandleFunc("/counters/{name}/acl", server.HandleCounterACL)
+	mux.HandleFunc("/counters/{name}/bounds", server.HandleCounterBounds)
+	mux.HandleFunc("/counters/{name}/history", server.HandleCounterHistory)
+	mux.HandleFunc("/counters/{name}/stats", server.HandleCounterStats)
+	mux.HandleFunc("/counters/{name}/leaderboard", server.HandleLeaderboard)
+	mux.HandleFunc("/counters/{name}/stream", server.HandleCounterStream)
+	mux.HandleFunc("/counters/{name}/periods", server.HandleCounterPeriods)
+	mux.HandleFunc("/me/contributions", server.HandleMyContributions)
+	mux.HandleFunc("/me/quota", server.HandleMyQuota)
+	mux.HandleFunc("/ws", server.HandleWebSocket)
 	mux.HandleFunc("/version", server.HandleVersion)
+	mux.HandleFunc("/groups", server.HandleGroups)
+	mux.HandleFunc("/groups/{name}", server.HandleGroup)
+	mux.HandleFunc("/groups/{name}/members", server.HandleGroupMembers)
+	mux.HandleFunc("/groups/{name}/members/{username}", server.HandleGroupMembers)
+	mux.HandleFunc("/tenants", server.HandleTenants)
+	mux.HandleFunc("/schedules", server.HandleResetSchedules)
+	mux.HandleFunc("/schedules/{id}", server.HandleResetSchedule)
+	mux.HandleFunc("/webhooks", server.HandleWebhooks)
+	mux.HandleFunc("/webhooks/{id}", server.HandleWebhook)
+	mux.HandleFunc("/webhooks/{id}/deliveries", server.HandleWebhookDeliveries)
+	mux.HandleFunc("/quotas/roles", server.HandleRoleQuotas)
+	mux.HandleFunc("/quotas/roles/{role}", server.HandleRoleQuotas)
+	mux.HandleFunc("/quotas/users/{username}", server.HandleUserQuota)
+	mux.HandleFunc("/setup", server.HandleSetup)
 
 	srv := &http.Server{
 		Addr:    backendInterface,
 		Handler: mux,
 	}
+	// the counter streams and the WebSocket connections never end by themselves, close them when the shutdown starts
+	srv.RegisterOnShutdown(server.CloseStreams)
 
 	// Run server in a goroutine
 	go func() {
@@ -190,6 +371,300 @@ func startApp(c *cli.Context) error {
 	return nil
 }
 
+// ensureAdmin creates the initial admin if the optional ADMIN_PASSWORD is set. If there is still no admin,
+// the first-run setup is enabled when SETUP_ENABLED is true
+func ensureAdmin(store api.Storage, server *api.Server) error {
+	adminPassword := os.Getenv("ADMIN_PASSWORD")
+	if len(adminPassword) > 0 {
+		created, err := store.BootstrapAdmin(defaultAdminUsername, adminPassword, false)
+		if err != nil {
+			return fmt.Errorf("failed to bootstrap the admin: %w", err)
+		}
+		if created {
+			log.Info("admin created from ADMIN_PASSWORD, it can now be removed from the .env file", "user", defaultAdminUsername)
+		} else {
+			log.Warn("ADMIN_PASSWORD is ignored because the admin already exists. Use the bootstrap command with " +
+				"--reset-password to change the password and remove ADMIN_PASSWORD from the .env file")
+		}
+	}
+
+	hasAdmin, err := store.HasAdmin()
+	if err != nil {
+		return err
+	}
+	if hasAdmin {
+		return nil
+	}
+
+	if os.Getenv("SETUP_ENABLED") != "true" {
+		log.Warn("there is no admin, run the bootstrap command or set SETUP_ENABLED=true to use the first-run setup")
+		return nil
+	}
+
+	token, err := generateSetupToken()
+	if err != nil {
+		return err
+	}
+	server.EnableSetup(token)
+	log.Info("first-run setup enabled, POST this token with the admin credentials to /setup", "token", token)
+
+	return nil
+}
+
+// startPeriodic calls job on every interval until the returned function is called. That function returns once
+// a running job is over, so the storage can be closed after it
+func startPeriodic(interval time.Duration, job func()) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				job()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// tenantPurge removes the expired entries of one kind from the tenant storage and returns how many were removed
+type tenantPurge func(tenantID string) (int, error)
+
+// purgeExpired runs the purges for all the tenants
+func purgeExpired(listTenants func() ([]common.Tenant, error), purges map[string]tenantPurge) {
+	tenants, err := listTenants()
+	if err != nil {
+		log.Warn("could not list the tenants for the purge", "error", err)
+		return
+	}
+
+	for _, tenant := range tenants {
+		for kind, purge := range purges {
+			removed, errPurge := purge(tenant.ID)
+			if errPurge != nil {
+				log.Warn("could not purge the expired entries", "kind", kind, "tenant", tenant.ID, "error", errPurge)
+				continue
+			}
+			if removed > 0 {
+				log.Debug("purged expired entries", "kind", kind, "tenant", tenant.ID, "removed", removed)
+			}
+		}
+	}
+}
+
+func generateSetupToken() (string, error) {
+	buff := make([]byte, 16)
+	_, err := rand.Read(buff)
+	if err != nil {
+		return "", fmt.Errorf("%w while generating the setup token", err)
+	}
+
+	return hex.EncodeToString(buff), nil
+}
+
+// loadUsernameRules builds the username rules from the optional USERNAME_* environment variables
+func loadUsernameRules() (common.UsernameRules, error) {
+	minLength := common.DefaultUsernameMinLength
+	maxLength := common.DefaultUsernameMaxLength
+	pattern := common.DefaultUsernamePattern
+	reserved := common.DefaultReservedUsernames
+
+	var err error
+	if value := os.Getenv("USERNAME_MIN_LENGTH"); len(value) > 0 {
+		minLength, err = strconv.Atoi(value)
+		if err != nil {
+			return common.UsernameRules{}, fmt.Errorf("invalid USERNAME_MIN_LENGTH: %w", err)
+		}
+	}
+	if value := os.Getenv("USERNAME_MAX_LENGTH"); len(value) > 0 {
+		maxLength, err = strconv.Atoi(value)
+		if err != nil {
+			return common.UsernameRules{}, fmt.Errorf("invalid USERNAME_MAX_LENGTH: %w", err)
+		}
+	}
+	if value := os.Getenv("USERNAME_PATTERN"); len(value) > 0 {
+		pattern = value
+	}
+	if value, ok := os.LookupEnv("USERNAME_RESERVED"); ok {
+		reserved = splitList(value)
+	}
+
+	return common.NewUsernameRules(minLength, maxLength, pattern, reserved)
+}
+
+// loadStatsRetention builds the counter statistics retention from the optional STATS_RETENTION_<GRANULARITY>
+// environment variables. A 0 duration keeps the buckets forever
+func loadStatsRetention() (common.StatsRetention, error) {
+	retention := common.DefaultStatsRetention()
+	for _, granularity := range common.Granularities {
+		name := "STATS_RETENTION_" + strings.ToUpper(granularity)
+		value := os.Getenv(name)
+		if len(value) == 0 {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		retention[granularity] = duration
+	}
+
+	return retention, nil
+}
+
+// loadGroupCommit builds the group commit configuration from the optional GROUP_COMMIT_* environment variables.
+// It returns nil, leaving the group commit disabled, if GROUP_COMMIT_INTERVAL is not set
+func loadGroupCommit() (*storage.GroupCommitConfig, error) {
+	value := os.Getenv("GROUP_COMMIT_INTERVAL")
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GROUP_COMMIT_INTERVAL: %w", err)
+	}
+	config := &storage.GroupCommitConfig{
+		Interval:   interval,
+		Durability: storage.DurabilityFlush,
+	}
+	if value = os.Getenv("GROUP_COMMIT_DURABILITY"); len(value) > 0 {
+		config.Durability = value
+	}
+	if value = os.Getenv("GROUP_COMMIT_MAX_PENDING"); len(value) > 0 {
+		config.MaxPending, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GROUP_COMMIT_MAX_PENDING: %w", err)
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// loadProofOfWorkConfig builds the proof of work configuration from the optional POW_* environment variables.
+// It returns nil, leaving the registration and the login without proof of work, if POW_ENABLED is not true
+func loadProofOfWorkConfig() (*common.ProofOfWorkConfig, error) {
+	value := os.Getenv("POW_ENABLED")
+	if len(value) == 0 {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POW_ENABLED: %w", err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	config := common.DefaultProofOfWorkConfig()
+	if value = os.Getenv("POW_MIN_DIFFICULTY"); len(value) > 0 {
+		config.MinDifficulty, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POW_MIN_DIFFICULTY: %w", err)
+		}
+	}
+	if value = os.Getenv("POW_MAX_DIFFICULTY"); len(value) > 0 {
+		config.MaxDifficulty, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POW_MAX_DIFFICULTY: %w", err)
+		}
+	}
+	if value = os.Getenv("POW_FAILURE_STEP"); len(value) > 0 {
+		config.FailureStep, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POW_FAILURE_STEP: %w", err)
+		}
+	}
+	if value = os.Getenv("POW_FAILURE_WINDOW"); len(value) > 0 {
+		config.FailureWindow, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POW_FAILURE_WINDOW: %w", err)
+		}
+	}
+	if value = os.Getenv("POW_CHALLENGE_TTL"); len(value) > 0 {
+		config.TTL, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid POW_CHALLENGE_TTL: %w", err)
+		}
+	}
+
+	return &config, config.Validate()
+}
+
+// loadPasswordHasherConfig builds the password hashing pool configuration from the optional PASSWORD_HASH_*
+// environment variables. PASSWORD_HASH_TARGET calibrates the bcrypt cost to the target duration on this machine,
+// it can not be combined with PASSWORD_HASH_COST
+func loadPasswordHasherConfig() (common.PasswordHasherConfig, error) {
+	config := common.DefaultPasswordHasherConfig()
+
+	var err error
+	cost := os.Getenv("PASSWORD_HASH_COST")
+	target := os.Getenv("PASSWORD_HASH_TARGET")
+	switch {
+	case len(cost) > 0 && len(target) > 0:
+		return config, errors.New("PASSWORD_HASH_COST and PASSWORD_HASH_TARGET can not be both set")
+	case len(cost) > 0:
+		config.Cost, err = strconv.Atoi(cost)
+		if err != nil {
+			return config, fmt.Errorf("invalid PASSWORD_HASH_COST: %w", err)
+		}
+	case len(target) > 0:
+		duration, errParse := time.ParseDuration(target)
+		if errParse != nil {
+			return config, fmt.Errorf("invalid PASSWORD_HASH_TARGET: %w", errParse)
+		}
+		config.Cost, err = common.CalibrateBcryptCost(duration)
+		if err != nil {
+			return config, fmt.Errorf("could not calibrate the bcrypt cost: %w", err)
+		}
+	}
+
+	if value := os.Getenv("PASSWORD_HASH_WORKERS"); len(value) > 0 {
+		config.Workers, err = strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid PASSWORD_HASH_WORKERS: %w", err)
+		}
+	}
+	if value := os.Getenv("PASSWORD_HASH_QUEUE"); len(value) > 0 {
+		config.QueueLimit, err = strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid PASSWORD_HASH_QUEUE: %w", err)
+		}
+	}
+	if value := os.Getenv("PASSWORD_HASH_TIMEOUT"); len(value) > 0 {
+		config.Timeout, err = time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid PASSWORD_HASH_TIMEOUT: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+// splitList splits a comma-separated value, dropping the empty entries
+func splitList(value string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
 func prepareLogger(logLevel string) (common.LoggerFile, error) {
 	err := logger.SetLogLevel(logLevel)
 	if err != nil {
@@ -2,6 +2,9 @@ package mock
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	"FullStackApp01/common"
 
@@ -9,22 +12,124 @@ import (
 )
 
 type mockStorage struct {
-	counter uint64
-	users   map[string]*common.User
+	counters map[string]*common.CounterInfo
+	users    map[string]*common.User
+	groups   map[string]*common.Group
+	tenants  *mockTenants
+	events   map[string][]common.CounterEvent
+	// idempotency holds the records keyed by canonical username and key
+	idempotency map[string]common.IdempotencyRecord
+	periods     map[string][]common.CounterPeriod
+	schedules   map[string]*common.ResetSchedule
+	scheduleSeq int
+	webhooks    map[string]*common.Webhook
+	deliveries  map[string][]*common.WebhookDelivery
+	webhookSeq  int
+	roleQuotas  map[string]common.Quota
+	userQuotas  map[string]common.Quota
+	// quotaUsage holds the usage keyed by canonical username, period and window start
+	quotaUsage map[string]uint64
+	resetUndo  map[string]common.ResetUndo
+	acls       map[string]common.CounterACL
+	// usedChallenges holds the expiry of the used proof of work challenges
+	usedChallenges map[string]time.Time
+}
+
+// mockTenants is the tenant registry shared by all the tenant views
+type mockTenants struct {
+	entries map[string]common.Tenant
+	stores  map[string]*mockStorage
+	// hasher hashes the passwords, bcrypt with the default cost is used without one
+	hasher passwordHasher
+}
+
+// passwordHasher is the storage.PasswordHasher, named here to keep the mock free of the storage package
+type passwordHasher interface {
+	Hash(password string) ([]byte, error)
 }
 
 // NewMockStorage -
 func NewMockStorage() *mockStorage {
+	mock := newMockStorage(&mockTenants{
+		entries: make(map[string]common.Tenant),
+		stores:  make(map[string]*mockStorage),
+	})
+	mock.tenants.stores[common.DefaultTenantID] = mock
+
+	return mock
+}
+
+func newMockStorage(tenants *mockTenants) *mockStorage {
 	return &mockStorage{
-		users: make(map[string]*common.User),
+		counters: map[string]*common.CounterInfo{
+			common.DefaultCounterName: {Name: common.DefaultCounterName},
+		},
+		users:          make(map[string]*common.User),
+		groups:         make(map[string]*common.Group),
+		tenants:        tenants,
+		events:         make(map[string][]common.CounterEvent),
+		idempotency:    make(map[string]common.IdempotencyRecord),
+		periods:        make(map[string][]common.CounterPeriod),
+		schedules:      make(map[string]*common.ResetSchedule),
+		webhooks:       make(map[string]*common.Webhook),
+		deliveries:     make(map[string][]*common.WebhookDelivery),
+		roleQuotas:     make(map[string]common.Quota),
+		userQuotas:     make(map[string]common.Quota),
+		quotaUsage:     make(map[string]uint64),
+		resetUndo:      make(map[string]common.ResetUndo),
+		acls:           make(map[string]common.CounterACL),
+		usedChallenges: make(map[string]time.Time),
 	}
 }
 
+// ForTenant -
+func (mock *mockStorage) ForTenant(tenantID string) *mockStorage {
+	if len(tenantID) == 0 {
+		tenantID = common.DefaultTenantID
+	}
+
+	tenantStore, ok := mock.tenants.stores[tenantID]
+	if !ok {
+		tenantStore = newMockStorage(mock.tenants)
+		mock.tenants.stores[tenantID] = tenantStore
+	}
+
+	return tenantStore
+}
+
+// SetPasswordHasher -
+func (mock *mockStorage) SetPasswordHasher(hasher passwordHasher) {
+	mock.tenants.hasher = hasher
+}
+
+func (mock *mockStorage) hashPassword(password string) ([]byte, error) {
+	if mock.tenants.hasher != nil {
+		return mock.tenants.hasher.Hash(password)
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// RegisterUser -
+func (mock *mockStorage) RegisterUser(username, password string, role string) error {
+	err := mock.SaveUser(username, password, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = mock.EnqueueWebhookEvent(common.WebhookEvent{
+		Type:      common.WebhookEventUserRegistered,
+		Timestamp: time.Now().UTC(),
+		Username:  common.DisplayUsername(username),
+	})
+	return err
+}
+
 // GetUser -
 func (mock *mockStorage) GetUser(username string) (*common.User, error) {
-	data, ok := mock.users[username]
+	data, ok := mock.users[common.CanonicalUsername(username)]
 	if !ok {
-		return nil, errors.New("user not found")
+		return nil, common.ErrUserNotFound
 	}
 
 	return data, nil
@@ -32,13 +137,18 @@ func (mock *mockStorage) GetUser(username string) (*common.User, error) {
 
 // SaveUser -
 func (mock *mockStorage) SaveUser(username, password string, role string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	_, exists := mock.users[common.CanonicalUsername(username)]
+	if exists {
+		return errors.New("user already exists")
+	}
+
+	hash, err := mock.hashPassword(password)
 	if err != nil {
 		return err
 	}
 
-	mock.users[username] = &common.User{
-		Username: username,
+	mock.users[common.CanonicalUsername(username)] = &common.User{
+		Username: common.DisplayUsername(username),
 		Role:     role,
 		Hash:     hash,
 	}
@@ -47,21 +157,646 @@ func (mock *mockStorage) SaveUser(username, password string, role string) error
 }
 
 // ResetCounter -
-func (mock *mockStorage) ResetCounter() error {
-	mock.counter = 0
+func (mock *mockStorage) ResetCounter(name string, username string) (common.CounterChange, error) {
+	change, _, err := mock.resetCounter(name, username, "")
+	return change, err
+}
 
-	return nil
+// CompareAndResetCounter -
+func (mock *mockStorage) CompareAndResetCounter(name string, expected uint64, username string) (common.CounterChange, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return common.CounterChange{}, common.ErrCounterNotFound
+	}
+	if counter.Value != expected {
+		return common.CounterChange{}, common.ErrCounterValueMismatch
+	}
+
+	return mock.ResetCounter(name, username)
+}
+
+func (mock *mockStorage) resetCounter(name string, username string, scheduleID string) (common.CounterChange, *common.CounterPeriod, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return common.CounterChange{}, nil, common.ErrCounterNotFound
+	}
+	err := counter.CheckBounds(0)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+
+	change := common.CounterChange{Old: counter.Value, New: 0}
+	change.Seq = mock.recordEvent(name, common.CounterOperationReset, username, change)
+	counter.Value = 0
+
+	period := common.CounterPeriod{
+		Seq:        change.Seq,
+		End:        time.Now().UTC(),
+		Value:      change.Old,
+		ScheduleID: scheduleID,
+	}
+	if periods := mock.periods[name]; len(periods) > 0 {
+		period.Start = &periods[len(periods)-1].End
+	}
+	mock.periods[name] = append(mock.periods[name], period)
+	delete(mock.resetUndo, name)
+	if change.Old > 0 {
+		mock.resetUndo[name] = common.ResetUndo{
+			Counter: name,
+			Value:   change.Old,
+			Seq:     change.Seq,
+			ResetBy: username,
+			ResetAt: period.End,
+		}
+	}
+
+	return change, &period, nil
 }
 
-// IncrementCounter -
-func (mock *mockStorage) IncrementCounter() (uint64, error) {
-	mock.counter++
-	return mock.counter, nil
+// GetResetUndo -
+func (mock *mockStorage) GetResetUndo(name string, window time.Duration) (*common.ResetUndo, error) {
+	_, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+	undo, ok := mock.resetUndo[name]
+	if !ok {
+		return nil, common.ErrNothingToRestore
+	}
+	undo.ExpiresAt = undo.ResetAt.Add(window)
+	if !undo.ExpiresAt.After(time.Now()) {
+		return nil, common.ErrNothingToRestore
+	}
+
+	return &undo, nil
+}
+
+// RestoreCounter -
+func (mock *mockStorage) RestoreCounter(name string, username string, window time.Duration) (common.CounterChange, error) {
+	undo, err := mock.GetResetUndo(name, window)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	counter := mock.counters[name]
+	newValue := undo.Value
+	if uint64(len(mock.events[name])) != undo.Seq {
+		newValue, err = common.ApplyDelta(counter.Value, int64(undo.Value))
+		if err != nil {
+			return common.CounterChange{}, err
+		}
+	}
+	err = counter.CheckBounds(newValue)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	change := common.CounterChange{Old: counter.Value, New: newValue}
+	change.Seq = mock.recordEvent(name, common.CounterOperationRestore, username, change)
+	counter.Value = newValue
+	delete(mock.resetUndo, name)
+	periods := mock.periods[name]
+	if len(periods) > 0 && periods[len(periods)-1].Seq == undo.Seq {
+		mock.periods[name] = periods[:len(periods)-1]
+	}
+
+	return change, nil
+}
+
+// AddToCounter -
+func (mock *mockStorage) AddToCounter(name string, delta int64, username string) (common.CounterChange, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return common.CounterChange{}, common.ErrCounterNotFound
+	}
+
+	newValue, err := common.ApplyDelta(counter.Value, delta)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	err = counter.CheckBounds(newValue)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	err = mock.chargeQuota(username, counter.Value, newValue)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	change := common.CounterChange{Old: counter.Value, New: newValue}
+	change.Seq = mock.recordEvent(name, common.CounterOperationAdd, username, change)
+	counter.Value = newValue
+	return change, nil
+}
+
+// AddToCounterAsVisitor -
+func (mock *mockStorage) AddToCounterAsVisitor(name string, delta int64, _ string) (common.CounterChange, error) {
+	return mock.AddToCounter(name, delta, "")
+}
+
+// CompareAndSwapCounter -
+func (mock *mockStorage) CompareAndSwapCounter(name string, expected uint64, value uint64, username string) (common.CounterChange, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return common.CounterChange{}, common.ErrCounterNotFound
+	}
+	if counter.Value != expected {
+		return common.CounterChange{}, common.ErrCounterValueMismatch
+	}
+	err := counter.CheckBounds(value)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	err = mock.chargeQuota(username, counter.Value, value)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	change := common.CounterChange{Old: counter.Value, New: value}
+	change.Seq = mock.recordEvent(name, common.CounterOperationSet, username, change)
+	counter.Value = value
+	return change, nil
+}
+
+// SetCounterBounds -
+func (mock *mockStorage) SetCounterBounds(name string, minValue *uint64, maxValue *uint64) error {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return common.ErrCounterNotFound
+	}
+	if minValue != nil && maxValue != nil && *minValue > *maxValue {
+		return common.ErrInvalidBounds
+	}
+
+	bounded := *counter
+	bounded.Min = minValue
+	bounded.Max = maxValue
+	err := bounded.CheckBounds(counter.Value)
+	if err != nil {
+		return err
+	}
+
+	counter.Min = minValue
+	counter.Max = maxValue
+	return nil
 }
 
 // GetCounter -
-func (mock *mockStorage) GetCounter() (uint64, error) {
-	return mock.counter, nil
+func (mock *mockStorage) GetCounter(name string) (uint64, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return 0, common.ErrCounterNotFound
+	}
+
+	return counter.Value, nil
+}
+
+// CreateCounter -
+func (mock *mockStorage) CreateCounter(counter common.CounterInfo) error {
+	_, exists := mock.counters[counter.Name]
+	if exists {
+		return common.ErrCounterAlreadyExists
+	}
+	if counter.Min != nil && counter.Max != nil && *counter.Min > *counter.Max {
+		return common.ErrInvalidBounds
+	}
+	if counter.Window != nil {
+		_, _, err := counter.Window.Durations()
+		if err != nil {
+			return err
+		}
+	}
+
+	counter.CreatedAt = time.Now()
+	counter.Value = 0
+	if counter.Min != nil {
+		counter.Value = *counter.Min
+	}
+	mock.counters[counter.Name] = &counter
+
+	return nil
+}
+
+// GetCounterInfo -
+func (mock *mockStorage) GetCounterInfo(name string) (*common.CounterInfo, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	counterCopy := *counter
+	return &counterCopy, nil
+}
+
+// ListCounters -
+func (mock *mockStorage) ListCounters() ([]common.CounterInfo, error) {
+	counters := make([]common.CounterInfo, 0, len(mock.counters))
+	for _, counter := range mock.counters {
+		counters = append(counters, *counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Name == common.DefaultCounterName {
+			return true
+		}
+		if counters[j].Name == common.DefaultCounterName {
+			return false
+		}
+		return counters[i].Name < counters[j].Name
+	})
+
+	return counters, nil
+}
+
+// DeleteCounter -
+func (mock *mockStorage) DeleteCounter(name string) error {
+	if name == common.DefaultCounterName {
+		return common.ErrDefaultCounter
+	}
+	_, ok := mock.counters[name]
+	if !ok {
+		return common.ErrCounterNotFound
+	}
+
+	delete(mock.counters, name)
+	delete(mock.events, name)
+	delete(mock.periods, name)
+	delete(mock.resetUndo, name)
+	delete(mock.acls, name)
+	for id, schedule := range mock.schedules {
+		if schedule.Counter == name {
+			delete(mock.schedules, id)
+		}
+	}
+	return nil
+}
+
+// GetCounterACL -
+func (mock *mockStorage) GetCounterACL(name string) (*common.CounterACL, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	acl, ok := mock.acls[name]
+	if !ok {
+		return &common.CounterACL{Counter: name, Owner: counter.CreatedBy, Entries: common.DefaultACLEntries()}, nil
+	}
+	acl.Entries = append([]common.ACLEntry(nil), acl.Entries...)
+
+	return &acl, nil
+}
+
+// SetCounterACL -
+func (mock *mockStorage) SetCounterACL(acl common.CounterACL) error {
+	err := acl.Validate()
+	if err != nil {
+		return err
+	}
+	_, ok := mock.counters[acl.Counter]
+	if !ok {
+		return common.ErrCounterNotFound
+	}
+	if len(acl.Owner) > 0 {
+		_, ok = mock.users[common.CanonicalUsername(acl.Owner)]
+		if !ok {
+			return common.ErrUserNotFound
+		}
+	}
+	if acl.Entries == nil {
+		acl.Entries = make([]common.ACLEntry, 0)
+	}
+
+	mock.acls[acl.Counter] = acl
+	return nil
+}
+
+// GetCounterPeriods -
+func (mock *mockStorage) GetCounterPeriods(name string, query common.CounterHistoryQuery) ([]common.CounterPeriod, error) {
+	_, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	periods := make([]common.CounterPeriod, 0)
+	for _, period := range mock.periods[name] {
+		if period.Seq <= query.After {
+			continue
+		}
+		if !query.From.IsZero() && period.End.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !period.End.Before(query.To) {
+			break
+		}
+		periods = append(periods, period)
+		if query.Limit > 0 && len(periods) >= query.Limit {
+			break
+		}
+	}
+
+	return periods, nil
+}
+
+// CreateResetSchedule -
+func (mock *mockStorage) CreateResetSchedule(schedule common.ResetSchedule) (*common.ResetSchedule, error) {
+	now := time.Now().UTC()
+	nextRun, err := schedule.Next(now)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := mock.counters[schedule.Counter]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	mock.scheduleSeq++
+	schedule.ID = fmt.Sprintf("schedule-%d", mock.scheduleSeq)
+	schedule.CreatedAt = now
+	schedule.NextRun = nextRun
+	mock.schedules[schedule.ID] = &schedule
+
+	result := schedule
+	return &result, nil
+}
+
+// ListResetSchedules -
+func (mock *mockStorage) ListResetSchedules() ([]common.ResetSchedule, error) {
+	schedules := make([]common.ResetSchedule, 0, len(mock.schedules))
+	for _, schedule := range mock.schedules {
+		schedules = append(schedules, *schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	return schedules, nil
+}
+
+// DeleteResetSchedule -
+func (mock *mockStorage) DeleteResetSchedule(id string) error {
+	_, ok := mock.schedules[id]
+	if !ok {
+		return common.ErrScheduleNotFound
+	}
+
+	delete(mock.schedules, id)
+	return nil
+}
+
+// RunResetSchedule -
+func (mock *mockStorage) RunResetSchedule(id string, now time.Time) (*common.CounterPeriod, error) {
+	schedule, ok := mock.schedules[id]
+	if !ok {
+		return nil, common.ErrScheduleNotFound
+	}
+	if now.Before(schedule.NextRun) {
+		return nil, nil
+	}
+
+	nextRun, err := schedule.Next(now)
+	if err != nil {
+		return nil, err
+	}
+	lastRun := schedule.NextRun
+	schedule.LastRun = &lastRun
+	schedule.NextRun = nextRun
+
+	_, period, err := mock.resetCounter(schedule.Counter, "", schedule.ID)
+	schedule.LastError = ""
+	if err != nil {
+		schedule.LastError = err.Error()
+	}
+
+	return period, err
+}
+
+// GetCounterHistory -
+func (mock *mockStorage) GetCounterHistory(name string, query common.CounterHistoryQuery) ([]common.CounterEvent, error) {
+	_, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	events := make([]common.CounterEvent, 0)
+	for _, event := range mock.events[name] {
+		if event.Seq <= query.After {
+			continue
+		}
+		if !query.From.IsZero() && event.Timestamp.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !event.Timestamp.Before(query.To) {
+			break
+		}
+		events = append(events, event)
+		if query.Limit > 0 && len(events) >= query.Limit {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// GetUniqueCount -
+func (mock *mockStorage) GetUniqueCount(name string) (uint64, error) {
+	_, ok := mock.counters[name]
+	if !ok {
+		return 0, common.ErrCounterNotFound
+	}
+
+	return mock.uniqueVisitors(name, time.Time{}, time.Time{}), nil
+}
+
+// GetUniqueVisitors -
+func (mock *mockStorage) GetUniqueVisitors(name string, day time.Time) (*common.UniqueVisitors, error) {
+	all, err := mock.GetUniqueCount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	visitors := &common.UniqueVisitors{Counter: name, Date: day.UTC().Format(time.DateOnly), All: all}
+	dayStart, dayEnd, _ := common.PeriodDays(common.PeriodDay, day)
+	weekStart, weekEnd, _ := common.PeriodDays(common.PeriodWeek, day)
+	monthStart, monthEnd, _ := common.PeriodDays(common.PeriodMonth, day)
+	dayCount := mock.uniqueVisitors(name, dayStart, dayEnd)
+	weekCount := mock.uniqueVisitors(name, weekStart, weekEnd)
+	monthCount := mock.uniqueVisitors(name, monthStart, monthEnd)
+	visitors.Day, visitors.Week, visitors.Month = &dayCount, &weekCount, &monthCount
+
+	return visitors, nil
+}
+
+// uniqueVisitors estimates the users that incremented the counter in [from, to), all time for zero times
+func (mock *mockStorage) uniqueVisitors(name string, from time.Time, to time.Time) uint64 {
+	sketch := common.NewHyperLogLog()
+	for _, event := range mock.events[name] {
+		if event.Operation != common.CounterOperationAdd || event.New <= event.Old || len(event.Username) == 0 {
+			continue
+		}
+		if !from.IsZero() && (event.Timestamp.Before(from) || !event.Timestamp.Before(to)) {
+			continue
+		}
+		sketch.Add(common.UserVisitorKey(event.Username))
+	}
+
+	return sketch.Estimate()
+}
+
+// GetCounterRate -
+func (mock *mockStorage) GetCounterRate(name string, window time.Duration, now time.Time) (*common.CounterRate, error) {
+	counter, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+	if counter.Window == nil {
+		return nil, common.ErrInvalidWindow
+	}
+	resolution, maxWindow, err := counter.Window.Durations()
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 || window > maxWindow {
+		return nil, common.ErrInvalidWindow
+	}
+
+	buckets := (window + resolution - 1) / resolution
+	to := now.UTC().Truncate(resolution).Add(resolution)
+	rate := &common.CounterRate{
+		Counter: name,
+		Window:  (buckets * resolution).String(),
+		From:    to.Add(-buckets * resolution),
+		To:      to,
+	}
+	for _, event := range mock.events[name] {
+		if event.Operation == common.CounterOperationAdd && event.New > event.Old &&
+			!event.Timestamp.Before(rate.From) && event.Timestamp.Before(rate.To) {
+			rate.Increments += event.New - event.Old
+		}
+	}
+
+	return rate, nil
+}
+
+// GetCounterStats -
+func (mock *mockStorage) GetCounterStats(name string, granularity string, from time.Time, to time.Time) ([]common.CounterStat, error) {
+	size, err := common.BucketSize(granularity)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	stats := make([]common.CounterStat, 0)
+	start, _ := common.BucketStart(from, granularity)
+	for bucket := start; bucket.Before(to); bucket = bucket.Add(size) {
+		stat := common.CounterStat{Start: bucket}
+		for _, event := range mock.events[name] {
+			eventBucket, _ := common.BucketStart(event.Timestamp, granularity)
+			if event.Operation == common.CounterOperationAdd && event.New > event.Old && eventBucket.Equal(bucket) {
+				stat.Increments += event.New - event.Old
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// GetLeaderboard -
+func (mock *mockStorage) GetLeaderboard(name string, period string, limit int) ([]common.Contribution, error) {
+	_, err := common.PeriodKey(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	_, ok := mock.counters[name]
+	if !ok {
+		return nil, common.ErrCounterNotFound
+	}
+
+	totals := mock.contributions(name, period)
+	contributions := make([]common.Contribution, 0, len(totals))
+	for username, increments := range totals {
+		contributions = append(contributions, common.Contribution{Username: username, Increments: increments})
+	}
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].Increments != contributions[j].Increments {
+			return contributions[i].Increments > contributions[j].Increments
+		}
+		return common.CanonicalUsername(contributions[i].Username) < common.CanonicalUsername(contributions[j].Username)
+	})
+	if len(contributions) > limit {
+		contributions = contributions[:limit]
+	}
+	for i := range contributions {
+		contributions[i].Rank = i + 1
+		if i > 0 && contributions[i].Increments == contributions[i-1].Increments {
+			contributions[i].Rank = contributions[i-1].Rank
+		}
+	}
+
+	return contributions, nil
+}
+
+// GetUserContributions -
+func (mock *mockStorage) GetUserContributions(username string) ([]common.UserContributions, error) {
+	counters, _ := mock.ListCounters()
+	result := make([]common.UserContributions, 0, len(counters))
+	for _, counter := range counters {
+		result = append(result, common.UserContributions{
+			Counter: counter.Name,
+			Day:     mock.contributions(counter.Name, common.PeriodDay)[common.DisplayUsername(username)],
+			Week:    mock.contributions(counter.Name, common.PeriodWeek)[common.DisplayUsername(username)],
+			All:     mock.contributions(counter.Name, common.PeriodAll)[common.DisplayUsername(username)],
+		})
+	}
+
+	return result, nil
+}
+
+// contributions returns the increments per user of the counter in the current period
+func (mock *mockStorage) contributions(name string, period string) map[string]uint64 {
+	current, _ := common.PeriodKey(period, time.Now())
+	totals := make(map[string]uint64)
+	for _, event := range mock.events[name] {
+		periodKey, _ := common.PeriodKey(period, event.Timestamp)
+		if periodKey == current && event.Operation == common.CounterOperationAdd && event.New > event.Old && len(event.Username) > 0 {
+			totals[event.Username] += event.New - event.Old
+		}
+	}
+
+	return totals
+}
+
+func (mock *mockStorage) recordEvent(name string, operation string, username string, change common.CounterChange) uint64 {
+	seq := uint64(len(mock.events[name]) + 1)
+	mock.events[name] = append(mock.events[name], common.CounterEvent{
+		Seq:       seq,
+		Timestamp: time.Now().UTC(),
+		Username:  username,
+		Operation: operation,
+		Old:       change.Old,
+		New:       change.New,
+	})
+
+	webhookEvent := common.WebhookEvent{
+		Timestamp: time.Now().UTC(),
+		Counter:   name,
+		Username:  username,
+		Change:    &common.CounterChange{Old: change.Old, New: change.New, Seq: seq},
+	}
+	switch {
+	case operation == common.CounterOperationReset:
+		webhookEvent.Type = common.WebhookEventCounterReset
+	case operation == common.CounterOperationAdd && change.New > change.Old:
+		webhookEvent.Type = common.WebhookEventCounterIncremented
+	}
+	_, _ = mock.EnqueueWebhookEvent(webhookEvent)
+
+	return seq
 }
 
 func (mock *mockStorage) Close() error {
@@ -70,15 +805,520 @@ func (mock *mockStorage) Close() error {
 
 // UpdatePassword -
 func (mock *mockStorage) UpdatePassword(username, newPassword string) error {
-	data, ok := mock.users[username]
+	data, ok := mock.users[common.CanonicalUsername(username)]
 	if !ok {
-		return errors.New("user not found")
+		return common.ErrUserNotFound
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hash, err := mock.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 	data.Hash = hash
 	return nil
 }
+
+// CreateGroup -
+func (mock *mockStorage) CreateGroup(name string, roles []string) error {
+	_, exists := mock.groups[name]
+	if exists {
+		return common.ErrGroupAlreadyExists
+	}
+
+	mock.groups[name] = &common.Group{
+		Name:    name,
+		Roles:   append(make([]string, 0), roles...),
+		Members: make([]string, 0),
+	}
+
+	return nil
+}
+
+// GetGroup -
+func (mock *mockStorage) GetGroup(name string) (*common.Group, error) {
+	group, ok := mock.groups[name]
+	if !ok {
+		return nil, common.ErrGroupNotFound
+	}
+
+	groupCopy := *group
+	return &groupCopy, nil
+}
+
+// ListGroups -
+func (mock *mockStorage) ListGroups() ([]common.Group, error) {
+	groups := make([]common.Group, 0, len(mock.groups))
+	for _, group := range mock.groups {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+// UpdateGroupRoles -
+func (mock *mockStorage) UpdateGroupRoles(name string, roles []string) error {
+	group, ok := mock.groups[name]
+	if !ok {
+		return common.ErrGroupNotFound
+	}
+
+	group.Roles = append(make([]string, 0), roles...)
+	return nil
+}
+
+// DeleteGroup -
+func (mock *mockStorage) DeleteGroup(name string) error {
+	_, ok := mock.groups[name]
+	if !ok {
+		return common.ErrGroupNotFound
+	}
+
+	delete(mock.groups, name)
+	return nil
+}
+
+// AddGroupMember -
+func (mock *mockStorage) AddGroupMember(name string, username string) error {
+	group, ok := mock.groups[name]
+	if !ok {
+		return common.ErrGroupNotFound
+	}
+	user, err := mock.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range group.Members {
+		if member == user.Username {
+			return nil
+		}
+	}
+	group.Members = append(group.Members, user.Username)
+
+	return nil
+}
+
+// RemoveGroupMember -
+func (mock *mockStorage) RemoveGroupMember(name string, username string) error {
+	group, ok := mock.groups[name]
+	if !ok {
+		return common.ErrGroupNotFound
+	}
+
+	members := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		if common.CanonicalUsername(member) != common.CanonicalUsername(username) {
+			members = append(members, member)
+		}
+	}
+	group.Members = members
+
+	return nil
+}
+
+// GetUserGroups -
+func (mock *mockStorage) GetUserGroups(username string) ([]common.Group, error) {
+	groups := make([]common.Group, 0)
+	for _, group := range mock.groups {
+		for _, member := range group.Members {
+			if common.CanonicalUsername(member) == common.CanonicalUsername(username) {
+				groups = append(groups, *group)
+				break
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// CreateTenant -
+func (mock *mockStorage) CreateTenant(tenantID string, name string, adminUsername string, adminPassword string) error {
+	_, exists := mock.tenants.entries[tenantID]
+	if exists || tenantID == common.DefaultTenantID {
+		return common.ErrTenantAlreadyExists
+	}
+
+	mock.tenants.entries[tenantID] = common.Tenant{
+		ID:        tenantID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	return mock.ForTenant(tenantID).SaveUser(adminUsername, adminPassword, "admin")
+}
+
+// GetTenant -
+func (mock *mockStorage) GetTenant(tenantID string) (*common.Tenant, error) {
+	if tenantID == common.DefaultTenantID {
+		return &common.Tenant{ID: common.DefaultTenantID, Name: common.DefaultTenantID}, nil
+	}
+
+	tenant, ok := mock.tenants.entries[tenantID]
+	if !ok {
+		return nil, common.ErrTenantNotFound
+	}
+
+	return &tenant, nil
+}
+
+// ListTenants -
+func (mock *mockStorage) ListTenants() ([]common.Tenant, error) {
+	tenants := []common.Tenant{{ID: common.DefaultTenantID, Name: common.DefaultTenantID}}
+	for _, tenant := range mock.tenants.entries {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants[1:], func(i, j int) bool {
+		return tenants[i+1].ID < tenants[j+1].ID
+	})
+
+	return tenants, nil
+}
+
+// BootstrapAdmin -
+func (mock *mockStorage) BootstrapAdmin(username string, password string, resetPassword bool) (bool, error) {
+	user, err := mock.GetUser(username)
+	if err != nil {
+		return true, mock.SaveUser(username, password, "admin")
+	}
+	if user.Role != "admin" {
+		return false, errors.New("the user exists but is not an admin")
+	}
+	if !resetPassword {
+		return false, nil
+	}
+
+	return false, mock.UpdatePassword(username, password)
+}
+
+// HasAdmin -
+func (mock *mockStorage) HasAdmin() (bool, error) {
+	for _, user := range mock.users {
+		if user.Role == "admin" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// BeginIdempotentRequest -
+func (mock *mockStorage) BeginIdempotentRequest(username string, key string, fingerprint string, lockTTL time.Duration) (*common.IdempotencyRecord, error) {
+	recordKey := common.CanonicalUsername(username) + "\x00" + key
+	existing, ok := mock.idempotency[recordKey]
+	if ok && time.Now().Before(existing.ExpiresAt) {
+		return &existing, nil
+	}
+
+	mock.idempotency[recordKey] = common.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(lockTTL),
+	}
+	return nil, nil
+}
+
+// CompleteIdempotentRequest -
+func (mock *mockStorage) CompleteIdempotentRequest(username string, key string, record common.IdempotencyRecord) error {
+	record.Completed = true
+	mock.idempotency[common.CanonicalUsername(username)+"\x00"+key] = record
+
+	return nil
+}
+
+// ReleaseIdempotentRequest -
+func (mock *mockStorage) ReleaseIdempotentRequest(username string, key string) error {
+	delete(mock.idempotency, common.CanonicalUsername(username)+"\x00"+key)
+
+	return nil
+}
+
+// CreateWebhook -
+func (mock *mockStorage) CreateWebhook(hook common.Webhook) (*common.Webhook, error) {
+	err := hook.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	mock.webhookSeq++
+	hook.ID = fmt.Sprintf("webhook-%d", mock.webhookSeq)
+	hook.CreatedAt = time.Now().UTC()
+	mock.webhooks[hook.ID] = &hook
+
+	result := hook
+	return &result, nil
+}
+
+// GetWebhook -
+func (mock *mockStorage) GetWebhook(id string) (*common.Webhook, error) {
+	hook, ok := mock.webhooks[id]
+	if !ok {
+		return nil, common.ErrWebhookNotFound
+	}
+
+	result := *hook
+	return &result, nil
+}
+
+// ListWebhooks -
+func (mock *mockStorage) ListWebhooks() ([]common.Webhook, error) {
+	hooks := make([]common.Webhook, 0, len(mock.webhooks))
+	for _, hook := range mock.webhooks {
+		hooks = append(hooks, *hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID < hooks[j].ID
+	})
+
+	return hooks, nil
+}
+
+// DeleteWebhook -
+func (mock *mockStorage) DeleteWebhook(id string) error {
+	_, ok := mock.webhooks[id]
+	if !ok {
+		return common.ErrWebhookNotFound
+	}
+
+	delete(mock.webhooks, id)
+	delete(mock.deliveries, id)
+	return nil
+}
+
+// EnqueueWebhookEvent -
+func (mock *mockStorage) EnqueueWebhookEvent(event common.WebhookEvent) (int, error) {
+	hooks, _ := mock.ListWebhooks()
+
+	queued := 0
+	for _, hook := range hooks {
+		for _, match := range hook.Match(event) {
+			mock.webhookSeq++
+			now := time.Now().UTC()
+			mock.deliveries[hook.ID] = append(mock.deliveries[hook.ID], &common.WebhookDelivery{
+				ID:          fmt.Sprintf("%016x", mock.webhookSeq),
+				WebhookID:   hook.ID,
+				Event:       match,
+				Status:      common.WebhookDeliveryPending,
+				Attempts:    make([]common.WebhookAttempt, 0),
+				NextAttempt: &now,
+				CreatedAt:   now,
+			})
+			queued++
+		}
+	}
+
+	return queued, nil
+}
+
+// GetWebhookDeliveries -
+func (mock *mockStorage) GetWebhookDeliveries(id string, after string, limit int) ([]common.WebhookDelivery, error) {
+	_, ok := mock.webhooks[id]
+	if !ok {
+		return nil, common.ErrWebhookNotFound
+	}
+
+	deliveries := make([]common.WebhookDelivery, 0)
+	for _, delivery := range mock.deliveries[id] {
+		if delivery.ID <= after {
+			continue
+		}
+		deliveries = append(deliveries, *delivery)
+		if limit > 0 && len(deliveries) >= limit {
+			break
+		}
+	}
+
+	return deliveries, nil
+}
+
+// DueWebhookDeliveries -
+func (mock *mockStorage) DueWebhookDeliveries(now time.Time, limit int) ([]common.WebhookDelivery, error) {
+	deliveries := make([]common.WebhookDelivery, 0)
+	for _, hookDeliveries := range mock.deliveries {
+		for _, delivery := range hookDeliveries {
+			if delivery.NextAttempt != nil && !delivery.NextAttempt.After(now) {
+				deliveries = append(deliveries, *delivery)
+			}
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt.Before(*deliveries[j].NextAttempt)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// CompleteWebhookAttempt -
+func (mock *mockStorage) CompleteWebhookAttempt(hookID string, deliveryID string, attempt common.WebhookAttempt, retryAt time.Time) error {
+	for _, delivery := range mock.deliveries[hookID] {
+		if delivery.ID != deliveryID || delivery.Status != common.WebhookDeliveryPending {
+			continue
+		}
+
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.NextAttempt = nil
+		switch {
+		case attempt.Succeeded():
+			delivery.Status = common.WebhookDeliveryDelivered
+		case retryAt.IsZero():
+			delivery.Status = common.WebhookDeliveryFailed
+		default:
+			delivery.NextAttempt = &retryAt
+		}
+	}
+
+	return nil
+}
+
+// SetRoleQuota -
+func (mock *mockStorage) SetRoleQuota(role string, quota *common.Quota) error {
+	if quota == nil {
+		delete(mock.roleQuotas, role)
+		return nil
+	}
+	err := quota.Validate()
+	if err != nil {
+		return err
+	}
+
+	mock.roleQuotas[role] = *quota
+	return nil
+}
+
+// ListRoleQuotas -
+func (mock *mockStorage) ListRoleQuotas() (map[string]common.Quota, error) {
+	quotas := make(map[string]common.Quota, len(mock.roleQuotas))
+	for role, quota := range mock.roleQuotas {
+		quotas[role] = quota
+	}
+
+	return quotas, nil
+}
+
+// SetUserQuota -
+func (mock *mockStorage) SetUserQuota(username string, quota *common.Quota) error {
+	_, err := mock.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		delete(mock.userQuotas, common.CanonicalUsername(username))
+		return nil
+	}
+	err = quota.Validate()
+	if err != nil {
+		return err
+	}
+
+	mock.userQuotas[common.CanonicalUsername(username)] = *quota
+	return nil
+}
+
+// GetQuotaStatus -
+func (mock *mockStorage) GetQuotaStatus(username string) (*common.QuotaStatus, error) {
+	user, err := mock.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &common.QuotaStatus{Username: user.Username}
+	status.Override, status.Quota, status.Source = mock.effectiveQuota(user)
+	if status.Quota == nil {
+		return status, nil
+	}
+
+	now := time.Now()
+	status.Used = mock.quotaUsage[mock.quotaUsageKey(username, status.Quota, now)]
+	if status.Used < status.Quota.Limit {
+		status.Remaining = status.Quota.Limit - status.Used
+	}
+	status.ResetAt = mock.quotaResetAt(status.Quota, now)
+
+	return status, nil
+}
+
+// chargeQuota adds the increase of the change to the usage of the user quota, or fails with a QuotaExceededError
+func (mock *mockStorage) chargeQuota(username string, oldValue uint64, newValue uint64) error {
+	if len(username) == 0 || newValue <= oldValue {
+		return nil
+	}
+	user, err := mock.GetUser(username)
+	if err != nil {
+		return nil
+	}
+	_, quota, _ := mock.effectiveQuota(user)
+	if quota == nil {
+		return nil
+	}
+
+	now := time.Now()
+	key := mock.quotaUsageKey(username, quota, now)
+	used, increment := mock.quotaUsage[key], newValue-oldValue
+	if used > quota.Limit || increment > quota.Limit-used {
+		quotaErr := &common.QuotaExceededError{Limit: quota.Limit, ResetAt: mock.quotaResetAt(quota, now)}
+		if used < quota.Limit {
+			quotaErr.Remaining = quota.Limit - used
+		}
+		return quotaErr
+	}
+
+	mock.quotaUsage[key] = used + increment
+	return nil
+}
+
+func (mock *mockStorage) effectiveQuota(user *common.User) (*common.Quota, *common.Quota, string) {
+	override, ok := mock.userQuotas[common.CanonicalUsername(user.Username)]
+	if ok {
+		return &override, &override, "user"
+	}
+
+	roles := []string{user.Role}
+	groups, _ := mock.GetUserGroups(user.Username)
+	for _, group := range groups {
+		roles = append(roles, group.Roles...)
+	}
+
+	var best *common.Quota
+	source := ""
+	for _, role := range roles {
+		quota, found := mock.roleQuotas[role]
+		if found && (best == nil || mock.quotaRate(&quota) > mock.quotaRate(best)) {
+			best = &quota
+			source = "role:" + role
+		}
+	}
+
+	return nil, best, source
+}
+
+func (mock *mockStorage) quotaUsageKey(username string, quota *common.Quota, now time.Time) string {
+	start, _ := common.BucketStart(now, quota.Period)
+	return fmt.Sprintf("%s\x00%s\x00%d", common.CanonicalUsername(username), quota.Period, start.Unix())
+}
+
+func (mock *mockStorage) quotaResetAt(quota *common.Quota, now time.Time) time.Time {
+	start, _ := common.BucketStart(now, quota.Period)
+	size, _ := common.BucketSize(quota.Period)
+
+	return start.Add(size)
+}
+
+func (mock *mockStorage) quotaRate(quota *common.Quota) float64 {
+	size, _ := common.BucketSize(quota.Period)
+	return float64(quota.Limit) / size.Seconds()
+}
+
+// UseChallenge -
+func (mock *mockStorage) UseChallenge(id string, expiresAt time.Time) error {
+	_, used := mock.usedChallenges[id]
+	if used {
+		return common.ErrChallengeUsed
+	}
+
+	mock.usedChallenges[id] = expiresAt
+	return nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const counterACLKeyPrefix = "counteracl:"
+
+// GetCounterACL returns the access control list of the counter. A counter without one is owned by its
+// creator and has the default entries
+func (s *store) GetCounterACL(name string) (*common.CounterACL, error) {
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.db.Get(s.counterACLKey(name), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return &common.CounterACL{
+			Counter: name,
+			Owner:   info.CreatedBy,
+			Entries: common.DefaultACLEntries(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var acl common.CounterACL
+	err = json.Unmarshal(data, &acl)
+	if err != nil {
+		return nil, err
+	}
+	acl.Counter = name
+
+	return &acl, nil
+}
+
+// SetCounterACL replaces the owner and the entries of the counter access control list. The owner, if any,
+// must be an existing user
+func (s *store) SetCounterACL(acl common.CounterACL) error {
+	err := acl.Validate()
+	if err != nil {
+		return err
+	}
+	if acl.Entries == nil {
+		acl.Entries = make([]common.ACLEntry, 0)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.checkCounterExists(acl.Counter)
+	if err != nil {
+		return err
+	}
+	if len(acl.Owner) > 0 {
+		exists, err := s.db.Has(s.userKey(acl.Owner), nil)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return common.ErrUserNotFound
+		}
+	}
+
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Put(s.counterACLKey(acl.Counter), data, nil)
+}
+
+func (s *store) counterACLKey(name string) []byte {
+	return s.key(counterACLKeyPrefix + name)
+}
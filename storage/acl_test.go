@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_CounterACL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should default to the creator and the default entries", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		err := instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "alice"})
+		require.Nil(t, err)
+
+		acl, err := instance.GetCounterACL("visits")
+		require.Nil(t, err)
+		assert.Equal(t, &common.CounterACL{Counter: "visits", Owner: "alice", Entries: common.DefaultACLEntries()}, acl)
+
+		_, err = instance.GetCounterACL("missing")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should replace the access control list", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("bob", "pass", "user")
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "alice"})
+
+		acl := common.CounterACL{
+			Counter: "visits",
+			Owner:   "bob",
+			Entries: []common.ACLEntry{{Type: common.PrincipalRole, Name: "editor", Permissions: []string{common.PermissionReset}}},
+		}
+		err := instance.SetCounterACL(acl)
+		require.Nil(t, err)
+
+		stored, err := instance.GetCounterACL("visits")
+		require.Nil(t, err)
+		assert.Equal(t, &acl, stored)
+
+		// no entries at all is a valid, closed, list
+		err = instance.SetCounterACL(common.CounterACL{Counter: "visits", Owner: "bob"})
+		require.Nil(t, err)
+		stored, _ = instance.GetCounterACL("visits")
+		assert.Empty(t, stored.Entries)
+		assert.NotNil(t, stored.Entries)
+	})
+	t.Run("should reject an invalid access control list", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "alice"})
+
+		err := instance.SetCounterACL(common.CounterACL{
+			Counter: "visits",
+			Entries: []common.ACLEntry{{Type: common.PrincipalUser, Permissions: []string{common.PermissionRead}}},
+		})
+		assert.True(t, errors.Is(err, common.ErrInvalidACL))
+
+		err = instance.SetCounterACL(common.CounterACL{Counter: "visits", Owner: "nobody"})
+		assert.Equal(t, common.ErrUserNotFound, err)
+
+		err = instance.SetCounterACL(common.CounterACL{Counter: "missing"})
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should be deleted with the counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("bob", "pass", "user")
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "alice"})
+		_ = instance.SetCounterACL(common.CounterACL{Counter: "visits", Owner: "bob"})
+
+		err := instance.DeleteCounter("visits")
+		require.Nil(t, err)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "carol"})
+
+		acl, err := instance.GetCounterACL("visits")
+		require.Nil(t, err)
+		assert.Equal(t, "carol", acl.Owner)
+		assert.Equal(t, common.DefaultACLEntries(), acl.Entries)
+	})
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrNotAnAdmin is returned when bootstrapping an admin over an existing user that is not an admin
+var ErrNotAnAdmin = errors.New("the user exists but is not an admin")
+
+// BootstrapAdmin creates the admin user if it does not exist yet and returns true if it was created.
+// An existing admin is left untouched unless resetPassword is set, making the call idempotent
+func (s *store) BootstrapAdmin(username string, password string, resetPassword bool) (bool, error) {
+	// avoid the slow hashing when there is nothing to do
+	existing, err := s.GetUser(username)
+	if err == nil && existing.Role == "admin" && !resetPassword {
+		return false, nil
+	}
+
+	// the hashing is slow, do it before acquiring the lock
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	unlock := s.userLocks.lock(s.userKey(username))
+	defer unlock()
+
+	user, err := s.GetUser(username)
+	switch {
+	case errors.Is(err, common.ErrUserNotFound):
+		user = &common.User{
+			Username: common.DisplayUsername(username),
+			Role:     "admin",
+		}
+	case err != nil:
+		return false, err
+	case user.Role != "admin":
+		return false, fmt.Errorf("%w: %s", ErrNotAnAdmin, username)
+	case !resetPassword:
+		return false, nil
+	}
+
+	created := len(user.Hash) == 0
+	user.Hash = hash
+	data, err := json.Marshal(user)
+	if err != nil {
+		return false, err
+	}
+
+	return created, s.db.Put(s.userKey(username), data, nil)
+}
+
+// HasAdmin returns true if the tenant has at least one user with the admin role
+func (s *store) HasAdmin() (bool, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(userKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var user common.User
+		err := json.Unmarshal(iter.Value(), &user)
+		if err != nil {
+			return false, err
+		}
+		if user.Role == "admin" {
+			return true, nil
+		}
+	}
+
+	return false, iter.Error()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestStore_BootstrapAdmin(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should error if the DB is closed", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		_ = instance.Close()
+
+		created, err := instance.BootstrapAdmin("admin", "pass", false)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "leveldb: closed")
+		assert.False(t, created)
+	})
+	t.Run("should not promote an existing user", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		created, err := instance.BootstrapAdmin("alice", "pass", false)
+		assert.ErrorIs(t, err, ErrNotAnAdmin)
+		assert.False(t, created)
+	})
+	t.Run("should be idempotent", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		hasAdmin, err := instance.HasAdmin()
+		assert.Nil(t, err)
+		assert.False(t, hasAdmin)
+
+		created, err := instance.BootstrapAdmin("admin", "first", false)
+		assert.Nil(t, err)
+		assert.True(t, created)
+
+		created, err = instance.BootstrapAdmin("admin", "second", false)
+		assert.Nil(t, err)
+		assert.False(t, created)
+
+		user, _ := instance.GetUser("admin")
+		assert.Equal(t, "admin", user.Role)
+		assert.Nil(t, bcrypt.CompareHashAndPassword(user.Hash, []byte("first")))
+
+		hasAdmin, err = instance.HasAdmin()
+		assert.Nil(t, err)
+		assert.True(t, hasAdmin)
+	})
+	t.Run("should reset the password on request", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.BootstrapAdmin("admin", "first", false)
+		created, err := instance.BootstrapAdmin("admin", "second", true)
+		assert.Nil(t, err)
+		assert.False(t, created)
+
+		user, _ := instance.GetUser("admin")
+		assert.Nil(t, bcrypt.CompareHashAndPassword(user.Hash, []byte("second")))
+	})
+}
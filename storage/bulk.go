@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ConflictPolicy defines what happens when an imported user already exists
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing user untouched
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing user
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail aborts the whole import
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ErrImportConflict is returned when the ConflictFail policy is used and some users already exist
+var ErrImportConflict = errors.New("users already exist")
+
+// ImportReport holds the outcome of a bulk import
+type ImportReport struct {
+	Created     []string
+	Overwritten []string
+	Skipped     []string
+}
+
+// ParseConflictPolicy converts the provided string to a ConflictPolicy
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	policy := ConflictPolicy(strings.ToLower(value))
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %s", value)
+	}
+}
+
+// ImportUsers saves the already hashed users in a single batch, applying the conflict policy for the existing ones.
+// If dryRun is set, nothing is written
+func (s *store) ImportUsers(users []common.User, policy ConflictPolicy, dryRun bool) (*ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock := s.userLocks.lockAll()
+	defer unlock()
+
+	report := &ImportReport{}
+	conflicts := make([]string, 0)
+	batch := new(leveldb.Batch)
+	for _, user := range users {
+		key := s.userKey(user.Username)
+		exists, err := s.db.Has(key, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			switch policy {
+			case ConflictSkip:
+				report.Skipped = append(report.Skipped, user.Username)
+				continue
+			case ConflictFail:
+				conflicts = append(conflicts, user.Username)
+				continue
+			case ConflictOverwrite:
+				report.Overwritten = append(report.Overwritten, user.Username)
+			default:
+				return nil, fmt.Errorf("unknown conflict policy %s", policy)
+			}
+		} else {
+			report.Created = append(report.Created, user.Username)
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(key, data)
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrImportConflict, strings.Join(conflicts, ", "))
+	}
+	if dryRun || batch.Len() == 0 {
+		return report, nil
+	}
+
+	err := s.db.Write(batch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ListUsers returns all the users of the tenant, ordered by their canonical username
+func (s *store) ListUsers() ([]common.User, error) {
+	users := make([]common.User, 0)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(userKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var user common.User
+		err := json.Unmarshal(iter.Value(), &user)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, iter.Error()
+}
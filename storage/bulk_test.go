@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := ParseConflictPolicy("Overwrite")
+	assert.Nil(t, err)
+	assert.Equal(t, ConflictOverwrite, policy)
+
+	policy, err = ParseConflictPolicy("merge")
+	assert.NotNil(t, err)
+	assert.Empty(t, policy)
+}
+
+func TestStore_ImportUsers(t *testing.T) {
+	t.Parallel()
+
+	users := []common.User{
+		{Username: "Alice", Role: "user", Hash: []byte("hash1")},
+		{Username: "bob", Role: "admin", Hash: []byte("hash2")},
+	}
+
+	t.Run("should error if the DB is closed", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		_ = instance.Close()
+
+		report, err := instance.ImportUsers(users, ConflictFail, false)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "leveldb: closed")
+		assert.Nil(t, report)
+	})
+	t.Run("dry run should not write", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		report, err := instance.ImportUsers(users, ConflictFail, true)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Alice", "bob"}, report.Created)
+
+		allUsers, err := instance.ListUsers()
+		assert.Nil(t, err)
+		assert.Empty(t, allUsers)
+	})
+	t.Run("conflict policies", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+
+		report, err := instance.ImportUsers(users, ConflictFail, false)
+		assert.ErrorIs(t, err, ErrImportConflict)
+		assert.Contains(t, err.Error(), "Alice")
+		assert.Nil(t, report)
+		_, err = instance.GetUser("bob")
+		assert.NotNil(t, err)
+
+		report, err = instance.ImportUsers(users, ConflictSkip, false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bob"}, report.Created)
+		assert.Equal(t, []string{"Alice"}, report.Skipped)
+		user, _ := instance.GetUser("alice")
+		assert.Equal(t, "alice", user.Username)
+
+		report, err = instance.ImportUsers(users, ConflictOverwrite, false)
+		assert.Nil(t, err)
+		assert.Empty(t, report.Created)
+		assert.Equal(t, []string{"Alice", "bob"}, report.Overwritten)
+		user, _ = instance.GetUser("alice")
+		assert.Equal(t, "Alice", user.Username)
+		assert.Equal(t, []byte("hash1"), user.Hash)
+
+		allUsers, err := instance.ListUsers()
+		assert.Nil(t, err)
+		assert.Len(t, allUsers, 2)
+	})
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const contributionKeyPrefix = "contrib:"
+const contributionRankKeyPrefix = "contribrank:"
+
+// GetLeaderboard returns the top contributors of the counter in the current period, at most limit of them.
+// The users with the same increments share the rank. Only the ranking index is read, not the users
+func (s *store) GetLeaderboard(name string, period string, limit int) ([]common.Contribution, error) {
+	periodKey, err := common.PeriodKey(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkCounterExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := s.contributionRankPrefix(name, periodKey)
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	contributions := make([]common.Contribution, 0)
+	for iter.Next() && len(contributions) < limit {
+		key := iter.Key()
+		if len(key) < len(prefix)+8 {
+			continue
+		}
+
+		contribution := common.Contribution{
+			Rank:       len(contributions) + 1,
+			Username:   string(iter.Value()),
+			Increments: math.MaxUint64 - binary.BigEndian.Uint64(key[len(prefix):len(prefix)+8]),
+		}
+		last := len(contributions) - 1
+		if last >= 0 && contributions[last].Increments == contribution.Increments {
+			contribution.Rank = contributions[last].Rank
+		}
+		contributions = append(contributions, contribution)
+	}
+
+	return contributions, iter.Error()
+}
+
+// GetUserContributions returns the contributions of the user to each counter in the current periods
+func (s *store) GetUserContributions(username string) ([]common.UserContributions, error) {
+	counters, err := s.ListCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]common.UserContributions, 0, len(counters))
+	for _, counter := range counters {
+		contributions := common.UserContributions{Counter: counter.Name}
+		for _, period := range common.Periods {
+			periodKey, _ := common.PeriodKey(period, now)
+			contribution, errRead := s.readContribution(counter.Name, periodKey, username)
+			if errRead != nil {
+				return nil, errRead
+			}
+
+			switch period {
+			case common.PeriodDay:
+				contributions.Day = contribution.Increments
+			case common.PeriodWeek:
+				contributions.Week = contribution.Increments
+			default:
+				contributions.All = contribution.Increments
+			}
+		}
+		result = append(result, contributions)
+	}
+
+	return result, nil
+}
+
+// PurgeContributions removes the daily and weekly contributions older than the previous day and week
+// and returns how many were removed
+func (s *store) PurgeContributions() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	kept := make(map[string]struct{})
+	for period, previous := range map[string]time.Time{
+		common.PeriodDay:  now.Add(-24 * time.Hour),
+		common.PeriodWeek: now.Add(-7 * 24 * time.Hour),
+		common.PeriodAll:  now,
+	} {
+		for _, timestamp := range []time.Time{now, previous} {
+			periodKey, _ := common.PeriodKey(period, timestamp)
+			kept[periodKey] = struct{}{}
+		}
+	}
+
+	prefix := s.key(contributionKeyPrefix)
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	removed := 0
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		// the key ends with <counter>\x00<period>\x00<canonical username>
+		parts := bytes.Split(iter.Key()[len(prefix):], []byte{0})
+		if len(parts) != 3 {
+			continue
+		}
+		_, found := kept[string(parts[1])]
+		if found {
+			continue
+		}
+
+		var contribution common.Contribution
+		err := json.Unmarshal(iter.Value(), &contribution)
+		if err == nil {
+			batch.Delete(s.contributionRankKey(string(parts[0]), string(parts[1]), contribution))
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+		removed++
+	}
+	err := iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, s.db.Write(batch, nil)
+}
+
+// addContributions adds the increment to the user contributions of all the periods containing the timestamp,
+// keeping the ranking index in sync. The caller must hold the lock
+func (s *store) addContributions(batch *leveldb.Batch, name string, username string, timestamp time.Time, increment uint64) error {
+	for _, period := range common.Periods {
+		periodKey, _ := common.PeriodKey(period, timestamp)
+		contribution, err := s.readContribution(name, periodKey, username)
+		if err != nil {
+			return err
+		}
+		if contribution.Increments > 0 {
+			batch.Delete(s.contributionRankKey(name, periodKey, *contribution))
+		}
+
+		if contribution.Increments > math.MaxUint64-increment {
+			contribution.Increments = math.MaxUint64
+		} else {
+			contribution.Increments += increment
+		}
+
+		data, err := json.Marshal(contribution)
+		if err != nil {
+			return err
+		}
+		batch.Put(s.contributionKey(name, periodKey, username), data)
+		batch.Put(s.contributionRankKey(name, periodKey, *contribution), []byte(contribution.Username))
+	}
+
+	return nil
+}
+
+// deleteContributions adds the removal of all the counter contributions to the batch
+func (s *store) deleteContributions(batch *leveldb.Batch, name string) error {
+	for _, prefix := range []string{contributionKeyPrefix, contributionRankKeyPrefix} {
+		iter := s.db.NewIterator(util.BytesPrefix(s.key(prefix+name+"\x00")), nil)
+		for iter.Next() {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+		iter.Release()
+
+		err := iter.Error()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *store) readContribution(name string, periodKey string, username string) (*common.Contribution, error) {
+	data, err := s.get(s.contributionKey(name, periodKey, username))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return &common.Contribution{Username: common.DisplayUsername(username)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contribution common.Contribution
+	err = json.Unmarshal(data, &contribution)
+	if err != nil {
+		return nil, err
+	}
+	return &contribution, nil
+}
+
+func (s *store) contributionKey(name string, periodKey string, username string) []byte {
+	return s.key(contributionKeyPrefix + name + "\x00" + periodKey + "\x00" + common.CanonicalUsername(username))
+}
+
+func (s *store) contributionRankPrefix(name string, periodKey string) []byte {
+	return s.key(contributionRankKeyPrefix + name + "\x00" + periodKey + "\x00")
+}
+
+// contributionRankKey returns the ranking index key. The increments are inverted and big endian so the
+// iteration starts with the top contributor
+func (s *store) contributionRankKey(name string, periodKey string, contribution common.Contribution) []byte {
+	key := append(s.contributionRankPrefix(name, periodKey), encodeCounterValue(math.MaxUint64-contribution.Increments)...)
+
+	return append(key, common.CanonicalUsername(contribution.Username)...)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestStore_Contributions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should rank the contributors", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "Alice")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 3, "bob")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 2, "carol")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "bob")
+		// only the increments count
+		_, _ = instance.AddToCounter(common.DefaultCounterName, -4, "carol")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+
+		for _, period := range common.Periods {
+			leaderboard, err := instance.GetLeaderboard(common.DefaultCounterName, period, 10)
+			require.Nil(t, err)
+			assert.Equal(t, []common.Contribution{
+				{Rank: 1, Username: "Alice", Increments: 6},
+				{Rank: 2, Username: "bob", Increments: 4},
+				{Rank: 3, Username: "carol", Increments: 2},
+			}, leaderboard, period)
+		}
+
+		leaderboard, _ := instance.GetLeaderboard(common.DefaultCounterName, common.PeriodAll, 2)
+		assert.Len(t, leaderboard, 2)
+
+		_, err := instance.GetLeaderboard(common.DefaultCounterName, "month", 2)
+		assert.ErrorIs(t, err, common.ErrInvalidPeriod)
+		_, err = instance.GetLeaderboard("missing", common.PeriodAll, 2)
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("equal contributions should share the rank", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 2, "alice")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 2, "bob")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "carol")
+
+		leaderboard, err := instance.GetLeaderboard(common.DefaultCounterName, common.PeriodAll, 10)
+		require.Nil(t, err)
+		require.Len(t, leaderboard, 3)
+		assert.Equal(t, []int{1, 1, 3}, []int{leaderboard[0].Rank, leaderboard[1].Rank, leaderboard[2].Rank})
+	})
+	t.Run("should return the user contributions per counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 2, "alice")
+		_, _ = instance.AddToCounter("visits", 7, "alice")
+		_, _ = instance.AddToCounter("visits", 1, "bob")
+
+		contributions, err := instance.GetUserContributions("ALICE")
+		require.Nil(t, err)
+		assert.Equal(t, []common.UserContributions{
+			{Counter: common.DefaultCounterName, Day: 2, Week: 2, All: 2},
+			{Counter: "visits", Day: 7, Week: 7, All: 7},
+		}, contributions)
+
+		_ = instance.DeleteCounter("visits")
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		leaderboard, _ := instance.GetLeaderboard("visits", common.PeriodAll, 10)
+		assert.Empty(t, leaderboard)
+	})
+	t.Run("should purge the old periods", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		batch := new(leveldb.Batch)
+		require.Nil(t, instance.addContributions(batch, common.DefaultCounterName, "alice", time.Now().Add(-30*24*time.Hour), 3))
+		require.Nil(t, instance.db.Write(batch, nil))
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+
+		removed, err := instance.PurgeContributions()
+		require.Nil(t, err)
+		assert.Equal(t, 2, removed)
+
+		leaderboard, _ := instance.GetLeaderboard(common.DefaultCounterName, common.PeriodAll, 10)
+		require.Len(t, leaderboard, 1)
+		assert.Equal(t, uint64(4), leaderboard[0].Increments)
+		leaderboard, _ = instance.GetLeaderboard(common.DefaultCounterName, common.PeriodDay, 10)
+		require.Len(t, leaderboard, 1)
+		assert.Equal(t, uint64(1), leaderboard[0].Increments)
+	})
+}
@@ -0,0 +1,586 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const counterKey = "counter"
+const counterKeyPrefix = "counter:"
+const counterMetaKeyPrefix = "countermeta:"
+
+// GetCounter retrieves the current value of the counter
+func (s *store) GetCounter(name string) (uint64, error) {
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.readCounterValue(name)
+}
+
+// IncrementCounter increments the counter safely on behalf of the user and returns the new value
+func (s *store) IncrementCounter(name string, username string) (uint64, error) {
+	change, err := s.AddToCounter(name, 1, username)
+	if err != nil {
+		return 0, err
+	}
+
+	return change.New, nil
+}
+
+// AddToCounter atomically adds the signed delta to the counter on behalf of the user, enforcing its bounds,
+// and returns the values before and after the update. With the group commit enabled, the update is written
+// with the next flush
+func (s *store) AddToCounter(name string, delta int64, username string) (common.CounterChange, error) {
+	visitor := ""
+	if len(username) > 0 {
+		visitor = common.UserVisitorKey(username)
+	}
+
+	return s.addToCounter(name, delta, username, visitor)
+}
+
+// AddToCounterAsVisitor is AddToCounter for an anonymous caller. The visitor id, if any, identifies the caller
+// in the unique visitors sketches
+func (s *store) AddToCounterAsVisitor(name string, delta int64, visitorID string) (common.CounterChange, error) {
+	visitor := ""
+	if len(visitorID) > 0 {
+		visitor = common.AnonymousVisitorKey(visitorID)
+	}
+
+	return s.addToCounter(name, delta, "", visitor)
+}
+
+func (s *store) addToCounter(name string, delta int64, username string, visitor string) (common.CounterChange, error) {
+	if s.mu.committer != nil {
+		return s.addToCounterCoalesced(name, delta, username, visitor)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	change, err := s.stageCounterAdd(batch, name, delta, username, visitor)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return change, nil
+}
+
+// stageCounterAdd adds the delta to the counter in the batch, enforcing its bounds, and returns the change.
+// An increase is counted for the visitor in the unique visitors sketches and, for a sliding window counter,
+// in its current bucket. The caller must hold the lock
+func (s *store) stageCounterAdd(batch *leveldb.Batch, name string, delta int64, username string, visitor string) (common.CounterChange, error) {
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	oldValue, err := s.readCounterValue(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	newValue, err := common.ApplyDelta(oldValue, delta)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	err = info.CheckBounds(newValue)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	change := common.CounterChange{Old: oldValue, New: newValue}
+	event, err := s.stageCounterChange(batch, name, common.CounterOperationAdd, username, change)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	change.Seq = event.Seq
+
+	if newValue > oldValue && len(visitor) > 0 {
+		err = s.stageUniqueVisitor(batch, name, visitor, event.Timestamp)
+		if err != nil {
+			return common.CounterChange{}, err
+		}
+	}
+	if newValue > oldValue && info.Window != nil {
+		err = s.stageWindowIncrement(batch, info, event.Timestamp, newValue-oldValue)
+		if err != nil {
+			return common.CounterChange{}, err
+		}
+	}
+
+	return change, nil
+}
+
+// CompareAndSwapCounter atomically sets the counter to value on behalf of the user if it still holds the
+// expected value. It returns ErrCounterValueMismatch otherwise
+func (s *store) CompareAndSwapCounter(name string, expected uint64, value uint64, username string) (common.CounterChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	current, err := s.readCounterValue(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	if current != expected {
+		return common.CounterChange{}, fmt.Errorf("%w: expected %d, found %d", common.ErrCounterValueMismatch, expected, current)
+	}
+	err = info.CheckBounds(value)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	change := common.CounterChange{Old: current, New: value}
+	change.Seq, err = s.commitCounterChange(name, common.CounterOperationSet, username, change)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return change, nil
+}
+
+// ResetCounter resets the counter to 0 on behalf of the user, archiving the closing period, and returns the values
+// before and after the reset. A counter with a minimum bound higher than 0 can not be reset
+func (s *store) ResetCounter(name string, username string) (common.CounterChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	change, _, err := s.stageCounterReset(batch, name, username, "")
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return change, nil
+}
+
+// CompareAndResetCounter resets the counter like ResetCounter if it still holds the expected value.
+// It returns ErrCounterValueMismatch otherwise
+func (s *store) CompareAndResetCounter(name string, expected uint64, username string) (common.CounterChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.readCounterMeta(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	current, err := s.readCounterValue(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	if current != expected {
+		return common.CounterChange{}, fmt.Errorf("%w: expected %d, found %d", common.ErrCounterValueMismatch, expected, current)
+	}
+
+	batch := new(leveldb.Batch)
+	change, _, err := s.stageCounterReset(batch, name, username, "")
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return change, nil
+}
+
+// stageCounterReset adds the counter reset, the archived period and the undo slot to the batch and returns them.
+// The caller must hold the lock
+func (s *store) stageCounterReset(batch *leveldb.Batch, name string, username string, scheduleID string) (common.CounterChange, *common.CounterPeriod, error) {
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+	err = info.CheckBounds(0)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+
+	oldValue, err := s.readCounterValue(name)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+
+	change := common.CounterChange{Old: oldValue, New: 0}
+	event, err := s.stageCounterChange(batch, name, common.CounterOperationReset, username, change)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+	change.Seq = event.Seq
+
+	period, err := s.archiveCounterPeriod(batch, info, event, scheduleID)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+	err = s.stageResetUndo(batch, name, event)
+	if err != nil {
+		return common.CounterChange{}, nil, err
+	}
+
+	return change, period, nil
+}
+
+// CreateCounter creates a new named counter from the provided name, description, creator and bounds.
+// The counter starts at 0 or, if set, at its minimum bound
+func (s *store) CreateCounter(counter common.CounterInfo) error {
+	if counter.Name == common.DefaultCounterName {
+		return common.ErrCounterAlreadyExists
+	}
+	err := checkBoundsOrder(counter.Min, counter.Max)
+	if err != nil {
+		return err
+	}
+	if counter.Window != nil {
+		_, _, err = counter.Window.Durations()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.db.Has(s.counterMetaKey(counter.Name), nil)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return common.ErrCounterAlreadyExists
+	}
+
+	initialValue := uint64(0)
+	if counter.Min != nil {
+		initialValue = *counter.Min
+	}
+
+	counter.Value = 0
+	counter.CreatedAt = time.Now().UTC()
+	data, err := json.Marshal(counter)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(s.counterMetaKey(counter.Name), data)
+	batch.Put(s.counterValueKey(counter.Name), encodeCounterValue(initialValue))
+
+	return s.db.Write(batch, nil)
+}
+
+// SetCounterBounds replaces the bounds of the counter. A nil bound means unbounded.
+// The current value has to be within the new bounds
+func (s *store) SetCounterBounds(name string, minValue *uint64, maxValue *uint64) error {
+	err := checkBoundsOrder(minValue, maxValue)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return err
+	}
+	value, err := s.readCounterValue(name)
+	if err != nil {
+		return err
+	}
+
+	info.Min = minValue
+	info.Max = maxValue
+	err = info.CheckBounds(value)
+	if err != nil {
+		return err
+	}
+
+	return s.putCounterMeta(nil, info)
+}
+
+// GetCounterInfo retrieves the counter metadata together with its current value
+func (s *store) GetCounterInfo(name string) (*common.CounterInfo, error) {
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Value, err = s.readCounterValue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ListCounters returns all the counters, the default one first and the others ordered by name
+func (s *store) ListCounters() ([]common.CounterInfo, error) {
+	defaultCounter, err := s.GetCounterInfo(common.DefaultCounterName)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := []common.CounterInfo{*defaultCounter}
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(counterMetaKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var info common.CounterInfo
+		err = json.Unmarshal(iter.Value(), &info)
+		if err != nil {
+			return nil, err
+		}
+		if info.Name == common.DefaultCounterName {
+			// the default counter only has metadata once its bounds are set
+			continue
+		}
+
+		info.Value, err = s.readCounterValue(info.Name)
+		if err != nil {
+			return nil, err
+		}
+		counters = append(counters, info)
+	}
+
+	return counters, iter.Error()
+}
+
+// DeleteCounter removes a named counter. The default counter can not be deleted
+func (s *store) DeleteCounter(name string) error {
+	if name == common.DefaultCounterName {
+		return common.ErrDefaultCounter
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(s.counterMetaKey(name))
+	batch.Delete(s.counterValueKey(name))
+	err = s.deleteCounterHistory(batch, name)
+	if err != nil {
+		return err
+	}
+	err = s.deleteCounterStats(batch, name)
+	if err != nil {
+		return err
+	}
+	err = s.deleteContributions(batch, name)
+	if err != nil {
+		return err
+	}
+	err = s.deleteCounterPeriods(batch, name)
+	if err != nil {
+		return err
+	}
+	err = s.deleteResetSchedules(batch, name)
+	if err != nil {
+		return err
+	}
+	batch.Delete(s.resetUndoKey(name))
+	batch.Delete(s.counterACLKey(name))
+	err = s.deleteUniqueVisitors(batch, name)
+	if err != nil {
+		return err
+	}
+	err = s.deleteCounterWindow(batch, name)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Write(batch, nil)
+}
+
+func (s *store) checkCounterExists(name string) error {
+	if name == common.DefaultCounterName {
+		return nil
+	}
+
+	exists, err := s.db.Has(s.counterMetaKey(name), nil)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return common.ErrCounterNotFound
+	}
+
+	return nil
+}
+
+func (s *store) readCounterMeta(name string) (*common.CounterInfo, error) {
+	data, err := s.db.Get(s.counterMetaKey(name), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		if name == common.DefaultCounterName {
+			// the default counter predates the metadata
+			return &common.CounterInfo{Name: common.DefaultCounterName}, nil
+		}
+		return nil, common.ErrCounterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info common.CounterInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// commitCounterChange writes the new counter value together with everything staged by stageCounterChange
+// in a single batch. It returns the event sequence
+func (s *store) commitCounterChange(name string, operation string, username string, change common.CounterChange) (uint64, error) {
+	batch := new(leveldb.Batch)
+	event, err := s.stageCounterChange(batch, name, operation, username, change)
+	if err != nil {
+		return 0, err
+	}
+
+	return event.Seq, s.db.Write(batch, nil)
+}
+
+// stageCounterChange checks the user quota and adds the new counter value, the event recording the change,
+// for the increments, the statistics and the user contributions, and the webhook deliveries to the batch.
+// It returns the event
+func (s *store) stageCounterChange(batch *leveldb.Batch, name string, operation string, username string, change common.CounterChange) (*common.CounterEvent, error) {
+	if len(username) > 0 && change.New > change.Old && operation != common.CounterOperationRestore {
+		// every increase counts against the user quota, the conditional increments and the sets included,
+		// but not the restore of a reset
+		err := s.stageQuotaUsage(batch, username, change.New-change.Old, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	batch.Put(s.counterValueKey(name), encodeCounterValue(change.New))
+
+	event := &common.CounterEvent{
+		Username:  username,
+		Operation: operation,
+		Old:       change.Old,
+		New:       change.New,
+	}
+	err := s.appendCounterEvent(batch, name, event)
+	if err != nil {
+		return nil, err
+	}
+
+	if operation == common.CounterOperationAdd && change.New > change.Old {
+		err = s.addCounterStats(batch, name, event.Timestamp, change.New-change.Old)
+		if err != nil {
+			return nil, err
+		}
+		if len(username) > 0 {
+			err = s.addContributions(batch, name, username, event.Timestamp, change.New-change.Old)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = s.stageCounterWebhooks(batch, name, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// putCounterMeta writes the counter metadata together with the operations already present in the batch
+func (s *store) putCounterMeta(batch *leveldb.Batch, info *common.CounterInfo) error {
+	if batch == nil {
+		batch = new(leveldb.Batch)
+	}
+
+	// the value lives under its own key
+	infoCopy := *info
+	infoCopy.Value = 0
+	data, err := json.Marshal(infoCopy)
+	if err != nil {
+		return err
+	}
+	batch.Put(s.counterMetaKey(info.Name), data)
+
+	return s.db.Write(batch, nil)
+}
+
+func (s *store) readCounterValue(name string) (uint64, error) {
+	data, err := s.get(s.counterValueKey(name))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounterValue(data)
+}
+
+// counterValueKey returns the key holding the counter value. The default counter keeps
+// the key used before named counters existed
+func (s *store) counterValueKey(name string) []byte {
+	if name == common.DefaultCounterName {
+		return s.key(counterKey)
+	}
+
+	return s.key(counterKeyPrefix + name)
+}
+
+func (s *store) counterMetaKey(name string) []byte {
+	return s.key(counterMetaKeyPrefix + name)
+}
+
+func checkBoundsOrder(minValue *uint64, maxValue *uint64) error {
+	if minValue != nil && maxValue != nil && *minValue > *maxValue {
+		return fmt.Errorf("%w: minimum %d is higher than maximum %d", common.ErrInvalidBounds, *minValue, *maxValue)
+	}
+
+	return nil
+}
+
+func decodeCounterValue(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, errors.New("invalid counter data")
+	}
+
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func encodeCounterValue(value uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, value)
+
+	return buf
+}
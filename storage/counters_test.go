@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_NamedCounters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missing counter should error", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		val, err := instance.GetCounter("missing")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		assert.Zero(t, val)
+
+		val, err = instance.IncrementCounter("missing", "")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		assert.Zero(t, val)
+
+		_, err = instance.ResetCounter("missing", "")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		assert.Equal(t, common.ErrCounterNotFound, instance.DeleteCounter("missing"))
+
+		info, err := instance.GetCounterInfo("missing")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		assert.Nil(t, info)
+	})
+	t.Run("default counter always exists and can not be deleted", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		info, err := instance.GetCounterInfo(common.DefaultCounterName)
+		assert.Nil(t, err)
+		assert.Equal(t, common.DefaultCounterName, info.Name)
+
+		assert.Equal(t, common.ErrCounterAlreadyExists, instance.CreateCounter(common.CounterInfo{Name: common.DefaultCounterName}))
+		assert.Equal(t, common.ErrDefaultCounter, instance.DeleteCounter(common.DefaultCounterName))
+	})
+	t.Run("default counter keeps the legacy key", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.db.Put([]byte(counterKey), encodeCounterValue(41), nil)
+		val, err := instance.IncrementCounter(common.DefaultCounterName, "")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(42), val)
+	})
+	t.Run("should manage named counters", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		err := instance.CreateCounter(common.CounterInfo{Name: "visits", Description: "page visits", CreatedBy: "alice"})
+		assert.Nil(t, err)
+		err = instance.CreateCounter(common.CounterInfo{Name: "visits", CreatedBy: "bob"})
+		assert.Equal(t, common.ErrCounterAlreadyExists, err)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "builds", CreatedBy: "bob"})
+
+		_, _ = instance.IncrementCounter("visits", "")
+		val, err := instance.IncrementCounter("visits", "")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), val)
+
+		val, _ = instance.GetCounter(common.DefaultCounterName)
+		assert.Zero(t, val)
+
+		info, err := instance.GetCounterInfo("visits")
+		assert.Nil(t, err)
+		assert.Equal(t, "page visits", info.Description)
+		assert.Equal(t, "alice", info.CreatedBy)
+		assert.False(t, info.CreatedAt.IsZero())
+		assert.Equal(t, uint64(2), info.Value)
+
+		counters, err := instance.ListCounters()
+		assert.Nil(t, err)
+		assert.Len(t, counters, 3)
+		assert.Equal(t, common.DefaultCounterName, counters[0].Name)
+		assert.Equal(t, "builds", counters[1].Name)
+		assert.Equal(t, "visits", counters[2].Name)
+		assert.Equal(t, uint64(2), counters[2].Value)
+
+		_, err = instance.ResetCounter("visits", "")
+		assert.Nil(t, err)
+		val, _ = instance.GetCounter("visits")
+		assert.Zero(t, val)
+
+		assert.Nil(t, instance.DeleteCounter("visits"))
+		_, err = instance.GetCounter("visits")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should add signed deltas and detect the underflow", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		change, err := instance.AddToCounter(common.DefaultCounterName, 10, "")
+		assert.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 0, New: 10, Seq: 1}, change)
+
+		change, err = instance.AddToCounter(common.DefaultCounterName, -4, "")
+		assert.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 10, New: 6, Seq: 2}, change)
+
+		_, err = instance.AddToCounter(common.DefaultCounterName, -7, "")
+		assert.True(t, errors.Is(err, common.ErrCounterUnderflow))
+		val, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(6), val)
+	})
+	t.Run("should enforce the counter bounds", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		minValue, maxValue := uint64(5), uint64(10)
+		err := instance.CreateCounter(common.CounterInfo{Name: "seats", Min: &maxValue, Max: &minValue})
+		assert.True(t, errors.Is(err, common.ErrInvalidBounds))
+
+		err = instance.CreateCounter(common.CounterInfo{Name: "seats", Min: &minValue, Max: &maxValue})
+		assert.Nil(t, err)
+		val, _ := instance.GetCounter("seats")
+		assert.Equal(t, minValue, val)
+
+		change, err := instance.AddToCounter("seats", 5, "")
+		assert.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 5, New: 10, Seq: 1}, change)
+		_, err = instance.AddToCounter("seats", 1, "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+		_, err = instance.AddToCounter("seats", -6, "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+		_, err = instance.ResetCounter("seats", "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+
+		info, err := instance.GetCounterInfo("seats")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(10), info.Value)
+		assert.Equal(t, &minValue, info.Min)
+		assert.Equal(t, &maxValue, info.Max)
+	})
+	t.Run("should set the bounds of the default counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 3, "")
+		low := uint64(4)
+		err := instance.SetCounterBounds(common.DefaultCounterName, &low, nil)
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+
+		high := uint64(3)
+		err = instance.SetCounterBounds(common.DefaultCounterName, nil, &high)
+		assert.Nil(t, err)
+		_, err = instance.IncrementCounter(common.DefaultCounterName, "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+
+		counters, err := instance.ListCounters()
+		assert.Nil(t, err)
+		assert.Len(t, counters, 1)
+		assert.Equal(t, &high, counters[0].Max)
+
+		err = instance.SetCounterBounds(common.DefaultCounterName, nil, nil)
+		assert.Nil(t, err)
+		val, err := instance.IncrementCounter(common.DefaultCounterName, "")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(4), val)
+	})
+	t.Run("should compare and swap the counter value", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "")
+
+		_, err := instance.CompareAndSwapCounter(common.DefaultCounterName, 4, 10, "")
+		assert.True(t, errors.Is(err, common.ErrCounterValueMismatch))
+
+		change, err := instance.CompareAndSwapCounter(common.DefaultCounterName, 5, 10, "")
+		assert.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 5, New: 10, Seq: 2}, change)
+
+		high := uint64(10)
+		_ = instance.SetCounterBounds(common.DefaultCounterName, nil, &high)
+		_, err = instance.CompareAndSwapCounter(common.DefaultCounterName, 10, 11, "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+
+		_, err = instance.CompareAndSwapCounter("missing", 0, 1, "")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+
+		val, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(10), val)
+	})
+}
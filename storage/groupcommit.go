@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"FullStackApp01/common"
+
+	logger "github.com/multiversx/mx-chain-logger-go"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Durability modes of the group commit
+const (
+	// DurabilityFlush acknowledges an increment once the batch holding it is written and synced to the disk
+	DurabilityFlush = "flush"
+	// DurabilityImmediate acknowledges an increment as soon as it is queued. A crash loses the increments
+	// of the last interval at most
+	DurabilityImmediate = "immediate"
+)
+
+// DefaultGroupCommitMaxPending is the number of queued increments that triggers a flush before the interval ends
+const DefaultGroupCommitMaxPending = 1000
+
+var log = logger.GetOrCreate("storage")
+
+// GroupCommitConfig configures the write coalescing of the counter increments
+type GroupCommitConfig struct {
+	// Interval is the maximum time an increment waits in memory before being flushed
+	Interval time.Duration
+	// MaxPending is the number of queued increments that triggers an early flush, DefaultGroupCommitMaxPending if 0
+	MaxPending int
+	// Durability is DurabilityFlush or DurabilityImmediate
+	Durability string
+}
+
+// Validate checks the interval is positive and the durability is known
+func (config *GroupCommitConfig) Validate() error {
+	if config.Interval <= 0 {
+		return errors.New("the group commit interval must be positive")
+	}
+	if config.MaxPending < 0 {
+		return errors.New("the group commit max pending must not be negative")
+	}
+	if config.Durability != DurabilityFlush && config.Durability != DurabilityImmediate {
+		return fmt.Errorf("unknown group commit durability %q, expected %s or %s", config.Durability, DurabilityFlush, DurabilityImmediate)
+	}
+
+	return nil
+}
+
+// writeLock serializes the writers of all the tenant views. When the group commit is enabled, acquiring it
+// flushes the queued increments first, so every other writer sees and keeps them
+type writeLock struct {
+	mu        sync.Mutex
+	committer *groupCommitter
+}
+
+// Lock acquires the lock and flushes the queued increments
+func (lock *writeLock) Lock() {
+	lock.mu.Lock()
+	if lock.committer != nil {
+		// the error reaches the increments waiting for the flush, the caller goes on with the database as it is
+		_ = lock.committer.flush()
+	}
+}
+
+// Unlock releases the lock
+func (lock *writeLock) Unlock() {
+	lock.mu.Unlock()
+}
+
+// pendingValue is a value written by a queued increment. A deleted value reads as not found
+type pendingValue struct {
+	value   []byte
+	deleted bool
+}
+
+// pendingBatch holds the increments queued since the last flush. The values overlay the database for
+// the reads of the next increments and of GetCounter
+type pendingBatch struct {
+	batch  *leveldb.Batch
+	values map[string]pendingValue
+	count  int
+	done   chan struct{}
+	err    error
+}
+
+// Put records a value written by a queued batch
+func (pending *pendingBatch) Put(key []byte, value []byte) {
+	pending.batch.Put(key, value)
+	pending.values[string(key)] = pendingValue{value: append([]byte{}, value...)}
+}
+
+// Delete records a key removed by a queued batch
+func (pending *pendingBatch) Delete(key []byte) {
+	pending.batch.Delete(key)
+	pending.values[string(key)] = pendingValue{deleted: true}
+}
+
+// groupCommitter accumulates the staged increments in one batch written every interval. Its methods, except
+// read, must be called with the write lock held
+type groupCommitter struct {
+	db     *leveldb.DB
+	config GroupCommitConfig
+	// overlayMu guards pending for the reads made without the write lock
+	overlayMu sync.RWMutex
+	pending   *pendingBatch
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// EnableGroupCommit turns on the write coalescing of AddToCounter for all the tenant views: the increments are
+// staged in memory and flushed together every interval. It must be called before the store is used concurrently.
+// The events, statistics, contributions and daily unique visitors of the queued increments are listed once they
+// are flushed
+func (s *store) EnableGroupCommit(config GroupCommitConfig) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+	if config.MaxPending == 0 {
+		config.MaxPending = DefaultGroupCommitMaxPending
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mu.committer != nil {
+		return errors.New("the group commit is already enabled")
+	}
+
+	committer := &groupCommitter{
+		db:      s.db,
+		config:  config,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.mu.committer = committer
+	go committer.run(s.mu)
+
+	return nil
+}
+
+// run flushes the queued increments every interval until the committer is stopped
+func (committer *groupCommitter) run(lock *writeLock) {
+	defer close(committer.stopped)
+
+	ticker := time.NewTicker(committer.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-committer.stop:
+			return
+		case <-ticker.C:
+			lock.mu.Lock()
+			err := committer.flush()
+			lock.mu.Unlock()
+			if err != nil {
+				log.Warn("could not flush the queued counter increments", "error", err)
+			}
+		}
+	}
+}
+
+// queue adds the staged batch to the pending one and returns the latter. It flushes right away when
+// the pending batch is full
+func (committer *groupCommitter) queue(batch *leveldb.Batch) (*pendingBatch, error) {
+	committer.overlayMu.Lock()
+	if committer.pending == nil {
+		committer.pending = &pendingBatch{
+			batch:  new(leveldb.Batch),
+			values: make(map[string]pendingValue),
+			done:   make(chan struct{}),
+		}
+	}
+	pending := committer.pending
+	err := batch.Replay(pending)
+	pending.count++
+	committer.overlayMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if pending.count >= committer.config.MaxPending {
+		// the error is reported through the pending batch
+		_ = committer.flush()
+	}
+
+	return pending, nil
+}
+
+// flush writes the pending batch and wakes up the increments waiting for it. With DurabilityFlush the write is
+// synced, one sync for all the queued increments. On failure the queued increments are dropped and the error
+// is returned to their waiters
+func (committer *groupCommitter) flush() error {
+	committer.overlayMu.RLock()
+	pending := committer.pending
+	committer.overlayMu.RUnlock()
+	if pending == nil {
+		return nil
+	}
+
+	writeOptions := &opt.WriteOptions{Sync: committer.config.Durability == DurabilityFlush}
+	pending.err = committer.db.Write(pending.batch, writeOptions)
+
+	committer.overlayMu.Lock()
+	committer.pending = nil
+	committer.overlayMu.Unlock()
+	close(pending.done)
+
+	return pending.err
+}
+
+// read returns the value of the key written by a queued increment. The found flag is false if no
+// queued increment wrote it
+func (committer *groupCommitter) read(key []byte) ([]byte, bool, error) {
+	committer.overlayMu.RLock()
+	defer committer.overlayMu.RUnlock()
+
+	if committer.pending == nil {
+		return nil, false, nil
+	}
+	value, found := committer.pending.values[string(key)]
+	if !found {
+		return nil, false, nil
+	}
+	if value.deleted {
+		return nil, true, leveldb.ErrNotFound
+	}
+
+	return value.value, true, nil
+}
+
+// close flushes the queued increments and stops the periodic flush
+func (committer *groupCommitter) close() error {
+	close(committer.stop)
+	<-committer.stopped
+
+	return committer.flush()
+}
+
+// get reads the key, including the values written by the queued increments
+func (s *store) get(key []byte) ([]byte, error) {
+	committer := s.mu.committer
+	if committer != nil {
+		value, found, err := committer.read(key)
+		if found {
+			return value, err
+		}
+	}
+
+	return s.db.Get(key, nil)
+}
+
+// addToCounterCoalesced stages the increment under the write lock, without flushing the queued ones, and
+// queues it for the next flush. With DurabilityFlush it waits for the flush before returning
+func (s *store) addToCounterCoalesced(name string, delta int64, username string, visitor string) (common.CounterChange, error) {
+	committer := s.mu.committer
+
+	s.mu.mu.Lock()
+	batch := new(leveldb.Batch)
+	change, err := s.stageCounterAdd(batch, name, delta, username, visitor)
+	var pending *pendingBatch
+	if err == nil {
+		pending, err = committer.queue(batch)
+	}
+	s.mu.mu.Unlock()
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	if committer.config.Durability == DurabilityImmediate {
+		return change, nil
+	}
+
+	<-pending.done
+	if pending.err != nil {
+		return common.CounterChange{}, pending.err
+	}
+
+	return change, nil
+}
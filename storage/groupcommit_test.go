@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupCommitConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should accept the known durabilities", func(t *testing.T) {
+		for _, durability := range []string{DurabilityFlush, DurabilityImmediate} {
+			config := GroupCommitConfig{Interval: time.Millisecond, Durability: durability}
+			assert.Nil(t, config.Validate())
+		}
+	})
+	t.Run("should reject an invalid configuration", func(t *testing.T) {
+		config := GroupCommitConfig{Interval: 0, Durability: DurabilityFlush}
+		assert.NotNil(t, config.Validate())
+		config = GroupCommitConfig{Interval: time.Millisecond, Durability: "eventually"}
+		assert.NotNil(t, config.Validate())
+		config = GroupCommitConfig{Interval: time.Millisecond, MaxPending: -1, Durability: DurabilityFlush}
+		assert.NotNil(t, config.Validate())
+	})
+}
+
+func TestStore_GroupCommit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should acknowledge after the flush", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: 5 * time.Millisecond, Durability: DurabilityFlush}))
+
+		change, err := instance.AddToCounter(common.DefaultCounterName, 3, "alice")
+		require.Nil(t, err)
+		assert.Equal(t, uint64(3), change.New)
+		assert.Equal(t, uint64(1), change.Seq)
+
+		// the increment is already in the database, not only in the queue
+		data, err := instance.db.Get(instance.counterValueKey(common.DefaultCounterName), nil)
+		require.Nil(t, err)
+		value, _ := decodeCounterValue(data)
+		assert.Equal(t, uint64(3), value)
+	})
+	t.Run("should read the queued increments before the flush", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: time.Hour, Durability: DurabilityImmediate}))
+
+		for i := 0; i < 5; i++ {
+			_, err := instance.AddToCounter(common.DefaultCounterName, 2, "alice")
+			require.Nil(t, err)
+		}
+
+		value, err := instance.GetCounter(common.DefaultCounterName)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(10), value)
+		_, err = instance.db.Get(instance.counterValueKey(common.DefaultCounterName), nil)
+		assert.NotNil(t, err)
+
+		// any other writer flushes the queue first and sees the queued increments
+		change, err := instance.ResetCounter(common.DefaultCounterName, "admin")
+		require.Nil(t, err)
+		assert.Equal(t, uint64(10), change.Old)
+		assert.Equal(t, uint64(6), change.Seq)
+
+		events, _ := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{})
+		require.Len(t, events, 6)
+		for i, event := range events {
+			assert.Equal(t, uint64(i+1), event.Seq)
+		}
+		board, _ := instance.GetLeaderboard(common.DefaultCounterName, common.PeriodAll, 10)
+		require.Len(t, board, 1)
+		assert.Equal(t, uint64(10), board[0].Increments)
+	})
+	t.Run("should flush the queue when it is full and on close", func(t *testing.T) {
+		dir := t.TempDir()
+		instance, _ := NewStore(dir)
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: time.Hour, MaxPending: 3, Durability: DurabilityImmediate}))
+
+		for i := 0; i < 4; i++ {
+			_, _ = instance.IncrementCounter(common.DefaultCounterName, "")
+		}
+		data, err := instance.db.Get(instance.counterValueKey(common.DefaultCounterName), nil)
+		require.Nil(t, err)
+		value, _ := decodeCounterValue(data)
+		assert.Equal(t, uint64(3), value)
+
+		require.Nil(t, instance.Close())
+		instance, _ = NewStore(dir)
+		defer func() {
+			_ = instance.Close()
+		}()
+		value, _ = instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(4), value)
+	})
+	t.Run("should keep the checks of the direct path", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: time.Hour, Durability: DurabilityImmediate}))
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		_ = instance.SetRoleQuota("user", &common.Quota{Limit: 5, Period: common.GranularityDay})
+		maxValue := uint64(8)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "bounded", Max: &maxValue})
+
+		_, err := instance.AddToCounter("bounded", 4, "alice")
+		require.Nil(t, err)
+		// the quota usage of the queued increment is seen
+		_, err = instance.AddToCounter("bounded", 2, "alice")
+		assert.True(t, errors.Is(err, common.ErrQuotaExceeded))
+		_, err = instance.AddToCounter("bounded", 5, "")
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+		_, err = instance.AddToCounter("missing", 1, "")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("concurrent increments should all be counted", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: time.Millisecond, Durability: DurabilityFlush}))
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 10; j++ {
+					_, err := instance.IncrementCounter(common.DefaultCounterName, "alice")
+					assert.Nil(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(200), value)
+		events, _ := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{Limit: 500})
+		assert.Len(t, events, 200)
+	})
+}
+
+func benchmarkIncrements(b *testing.B, config *GroupCommitConfig) {
+	instance, _ := NewStore(b.TempDir())
+	defer func() {
+		_ = instance.Close()
+	}()
+	if config != nil {
+		require.Nil(b, instance.EnableGroupCommit(*config))
+	}
+
+	// the concurrent requests of a busy server
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := instance.IncrementCounter(common.DefaultCounterName, "alice")
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkStore_ConcurrentIncrements compares the group commit with writing each increment on its own, under
+// concurrent increments. A group of one is the synced write per increment the flush durability would need otherwise
+func BenchmarkStore_ConcurrentIncrements(b *testing.B) {
+	b.Run("direct", func(b *testing.B) {
+		benchmarkIncrements(b, nil)
+	})
+	b.Run("synced write per increment", func(b *testing.B) {
+		benchmarkIncrements(b, &GroupCommitConfig{Interval: time.Hour, MaxPending: 1, Durability: DurabilityFlush})
+	})
+	b.Run("group commit, ack after flush", func(b *testing.B) {
+		benchmarkIncrements(b, &GroupCommitConfig{Interval: 2 * time.Millisecond, Durability: DurabilityFlush})
+	})
+	b.Run("group commit, ack immediately", func(b *testing.B) {
+		benchmarkIncrements(b, &GroupCommitConfig{Interval: 2 * time.Millisecond, Durability: DurabilityImmediate})
+	})
+}
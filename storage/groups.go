@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const groupKeyPrefix = "group:"
+const groupMemberKeyPrefix = "groupmember:"
+
+// CreateGroup creates a new group with the provided roles and no members
+func (s *store) CreateGroup(name string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.db.Has(s.groupKey(name), nil)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return common.ErrGroupAlreadyExists
+	}
+
+	return s.putGroup(nil, &common.Group{
+		Name:    name,
+		Roles:   uniqueSorted(roles),
+		Members: make([]string, 0),
+	})
+}
+
+// GetGroup retrieves a group by name
+func (s *store) GetGroup(name string) (*common.Group, error) {
+	data, err := s.db.Get(s.groupKey(name), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, common.ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var group common.Group
+	err = json.Unmarshal(data, &group)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListGroups returns all the groups, ordered by name
+func (s *store) ListGroups() ([]common.Group, error) {
+	groups := make([]common.Group, 0)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(groupKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var group common.Group
+		err := json.Unmarshal(iter.Value(), &group)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, iter.Error()
+}
+
+// UpdateGroupRoles replaces the roles of an existing group
+func (s *store) UpdateGroupRoles(name string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return err
+	}
+
+	group.Roles = uniqueSorted(roles)
+
+	return s.putGroup(nil, group)
+}
+
+// DeleteGroup removes a group together with its membership entries
+func (s *store) DeleteGroup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, member := range group.Members {
+		batch.Delete(s.groupMemberKey(member, name))
+	}
+	batch.Delete(s.groupKey(name))
+
+	return s.db.Write(batch, nil)
+}
+
+// AddGroupMember adds an existing user to an existing group. Adding a member twice is a no-op
+func (s *store) AddGroupMember(name string, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return err
+	}
+	user, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	if memberIndex(group, user.Username) >= 0 {
+		return nil
+	}
+
+	group.Members = append(group.Members, user.Username)
+	sort.Strings(group.Members)
+
+	batch := new(leveldb.Batch)
+	batch.Put(s.groupMemberKey(user.Username, name), []byte{})
+
+	return s.putGroup(batch, group)
+}
+
+// RemoveGroupMember removes a user from a group. Removing a user that is not a member is a no-op
+func (s *store) RemoveGroupMember(name string, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return err
+	}
+
+	idx := memberIndex(group, username)
+	if idx < 0 {
+		return nil
+	}
+
+	group.Members = append(group.Members[:idx], group.Members[idx+1:]...)
+
+	batch := new(leveldb.Batch)
+	batch.Delete(s.groupMemberKey(username, name))
+
+	return s.putGroup(batch, group)
+}
+
+// GetUserGroups returns the groups the user is a member of
+func (s *store) GetUserGroups(username string) ([]common.Group, error) {
+	prefix := s.groupMemberKey(username, "")
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	groups := make([]common.Group, 0)
+	for iter.Next() {
+		name := string(iter.Key()[len(prefix):])
+		group, err := s.GetGroup(name)
+		if errors.Is(err, common.ErrGroupNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+
+	return groups, iter.Error()
+}
+
+// putGroup writes the group together with the operations already present in the batch
+func (s *store) putGroup(batch *leveldb.Batch, group *common.Group) error {
+	if batch == nil {
+		batch = new(leveldb.Batch)
+	}
+
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	batch.Put(s.groupKey(group.Name), data)
+
+	return s.db.Write(batch, nil)
+}
+
+func memberIndex(group *common.Group, username string) int {
+	canonical := common.CanonicalUsername(username)
+	for i, member := range group.Members {
+		if common.CanonicalUsername(member) == canonical {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *store) groupKey(name string) []byte {
+	return s.key(groupKeyPrefix + name)
+}
+
+// groupMemberKey returns the index key marking the user as a member of the group.
+// The username is canonical and ends with a separator so the prefix of one user never matches another one
+func (s *store) groupMemberKey(username string, group string) []byte {
+	return s.key(groupMemberKeyPrefix + common.CanonicalUsername(username) + "\x00" + group)
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]struct{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		_, found := seen[value]
+		if found || len(value) == 0 {
+			continue
+		}
+		seen[value] = struct{}{}
+		result = append(result, value)
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Groups(t *testing.T) {
+	t.Parallel()
+
+	instance, _ := NewStore(t.TempDir())
+	defer func() {
+		_ = instance.Close()
+	}()
+
+	_ = instance.SaveUser("Alice", "pass", "user")
+	_ = instance.SaveUser("bob", "pass", "user")
+
+	t.Run("should create a group", func(t *testing.T) {
+		err := instance.CreateGroup("ops", []string{"user", "admin", "admin"})
+		assert.Nil(t, err)
+
+		err = instance.CreateGroup("ops", nil)
+		assert.Equal(t, common.ErrGroupAlreadyExists, err)
+
+		group, err := instance.GetGroup("ops")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"admin", "user"}, group.Roles)
+		assert.Empty(t, group.Members)
+	})
+	t.Run("missing group should error", func(t *testing.T) {
+		group, err := instance.GetGroup("missing")
+		assert.Equal(t, common.ErrGroupNotFound, err)
+		assert.Nil(t, group)
+
+		assert.Equal(t, common.ErrGroupNotFound, instance.UpdateGroupRoles("missing", nil))
+		assert.Equal(t, common.ErrGroupNotFound, instance.DeleteGroup("missing"))
+		assert.Equal(t, common.ErrGroupNotFound, instance.AddGroupMember("missing", "alice"))
+		assert.Equal(t, common.ErrGroupNotFound, instance.RemoveGroupMember("missing", "alice"))
+	})
+	t.Run("should manage the members", func(t *testing.T) {
+		_ = instance.CreateGroup("auditors", []string{"auditor"})
+
+		assert.Equal(t, common.ErrUserNotFound, instance.AddGroupMember("ops", "ghost"))
+		assert.Nil(t, instance.AddGroupMember("ops", "alice"))
+		assert.Nil(t, instance.AddGroupMember("ops", "ALICE"))
+		assert.Nil(t, instance.AddGroupMember("ops", "bob"))
+		assert.Nil(t, instance.AddGroupMember("auditors", "alice"))
+
+		group, _ := instance.GetGroup("ops")
+		assert.Equal(t, []string{"Alice", "bob"}, group.Members)
+
+		groups, err := instance.GetUserGroups("alice")
+		assert.Nil(t, err)
+		assert.Len(t, groups, 2)
+
+		assert.Nil(t, instance.RemoveGroupMember("ops", "alice"))
+		group, _ = instance.GetGroup("ops")
+		assert.Equal(t, []string{"bob"}, group.Members)
+
+		groups, _ = instance.GetUserGroups("alice")
+		assert.Len(t, groups, 1)
+		assert.Equal(t, "auditors", groups[0].Name)
+	})
+	t.Run("should delete a group and its memberships", func(t *testing.T) {
+		assert.Nil(t, instance.UpdateGroupRoles("auditors", []string{"reader"}))
+		groups, _ := instance.GetUserGroups("alice")
+		assert.Equal(t, []string{"reader"}, groups[0].Roles)
+
+		assert.Nil(t, instance.DeleteGroup("auditors"))
+		groups, err := instance.GetUserGroups("alice")
+		assert.Nil(t, err)
+		assert.Empty(t, groups)
+
+		all, err := instance.ListGroups()
+		assert.Nil(t, err)
+		assert.Len(t, all, 1)
+	})
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const counterSeqKeyPrefix = "counterseq:"
+const counterEventKeyPrefix = "counterevent:"
+
+// GetCounterHistory returns the events of the counter matching the query, ordered by sequence
+func (s *store) GetCounterHistory(name string, query common.CounterHistoryQuery) ([]common.CounterEvent, error) {
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]common.CounterEvent, 0)
+	if query.After == math.MaxUint64 {
+		return events, nil
+	}
+
+	iter := s.db.NewIterator(&util.Range{
+		Start: s.counterEventKey(name, query.After+1),
+		Limit: util.BytesPrefix(s.counterEventPrefix(name)).Limit,
+	}, nil)
+	defer iter.Release()
+
+	start := query.After + 1
+	if !query.From.IsZero() {
+		start, err = s.firstEventFrom(iter, name, start, query.From)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ok := iter.Seek(s.counterEventKey(name, start)); ok; ok = iter.Next() {
+		var event common.CounterEvent
+		err = json.Unmarshal(iter.Value(), &event)
+		if err != nil {
+			return nil, err
+		}
+		if !query.To.IsZero() && !event.Timestamp.Before(query.To) {
+			// the events are appended in time order
+			break
+		}
+
+		events = append(events, event)
+		if query.Limit > 0 && len(events) >= query.Limit {
+			break
+		}
+	}
+
+	return events, iter.Error()
+}
+
+// firstEventFrom returns the sequence of the first event of the iterator range, starting at start, that happened
+// at or after from. The events are appended in time order, so the sequences are binary searched instead of scanned
+func (s *store) firstEventFrom(iter iterator.Iterator, name string, start uint64, from time.Time) (uint64, error) {
+	if !iter.Last() {
+		return start, iter.Error()
+	}
+	low, high := start, binary.BigEndian.Uint64(iter.Key()[len(iter.Key())-8:])+1
+
+	var event common.CounterEvent
+	for low < high {
+		middle := low + (high-low)/2
+		if !iter.Seek(s.counterEventKey(name, middle)) {
+			high = middle
+			continue
+		}
+		err := json.Unmarshal(iter.Value(), &event)
+		if err != nil {
+			return 0, err
+		}
+		if event.Timestamp.Before(from) {
+			// the sequences missing before the event found, if any, do not need to be searched
+			low = binary.BigEndian.Uint64(iter.Key()[len(iter.Key())-8:]) + 1
+			continue
+		}
+		high = middle
+	}
+
+	return low, iter.Error()
+}
+
+// appendCounterEvent adds the event to the batch, assigning it the next sequence of the counter.
+// The caller must hold the lock
+func (s *store) appendCounterEvent(batch *leveldb.Batch, name string, event *common.CounterEvent) error {
+	seq, err := s.readCounterSeq(name)
+	if err != nil {
+		return err
+	}
+
+	event.Seq = seq + 1
+	event.Timestamp = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	batch.Put(s.counterSeqKey(name), encodeCounterValue(event.Seq))
+	batch.Put(s.counterEventKey(name, event.Seq), data)
+
+	return nil
+}
+
+// deleteCounterHistory adds the removal of all the counter events to the batch
+func (s *store) deleteCounterHistory(batch *leveldb.Batch, name string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.counterEventPrefix(name)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	batch.Delete(s.counterSeqKey(name))
+
+	return iter.Error()
+}
+
+func (s *store) readCounterSeq(name string) (uint64, error) {
+	data, err := s.get(s.counterSeqKey(name))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounterValue(data)
+}
+
+func (s *store) counterSeqKey(name string) []byte {
+	return s.key(counterSeqKeyPrefix + name)
+}
+
+// counterEventPrefix returns the prefix of the counter events. The name ends with a separator so the
+// prefix of one counter never matches another one
+func (s *store) counterEventPrefix(name string) []byte {
+	return s.key(counterEventKeyPrefix + name + "\x00")
+}
+
+// counterEventKey returns the key of the event. The sequence is big endian so the events are iterated in order
+func (s *store) counterEventKey(name string, seq uint64) []byte {
+	return append(s.counterEventPrefix(name), encodeCounterValue(seq)...)
+}
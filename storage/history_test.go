@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_CounterHistory(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should record every mutation", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "alice")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, -2, "bob")
+		_, _ = instance.CompareAndSwapCounter(common.DefaultCounterName, 3, 10, "admin")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		// failed mutations are not recorded
+		_, _ = instance.AddToCounter(common.DefaultCounterName, -1, "bob")
+
+		events, err := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{})
+		require.Nil(t, err)
+		require.Len(t, events, 4)
+
+		expected := []common.CounterEvent{
+			{Seq: 1, Username: "alice", Operation: common.CounterOperationAdd, Old: 0, New: 5},
+			{Seq: 2, Username: "bob", Operation: common.CounterOperationAdd, Old: 5, New: 3},
+			{Seq: 3, Username: "admin", Operation: common.CounterOperationSet, Old: 3, New: 10},
+			{Seq: 4, Username: "admin", Operation: common.CounterOperationReset, Old: 10, New: 0},
+		}
+		for i := range events {
+			assert.False(t, events[i].Timestamp.IsZero())
+			events[i].Timestamp = time.Time{}
+		}
+		assert.Equal(t, expected, events)
+	})
+	t.Run("should paginate and filter by time", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits2"})
+		for i := 0; i < 5; i++ {
+			_, _ = instance.IncrementCounter("visits", "alice")
+			_, _ = instance.IncrementCounter("visits2", "alice")
+		}
+
+		events, err := instance.GetCounterHistory("visits", common.CounterHistoryQuery{After: 2, Limit: 2})
+		require.Nil(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, uint64(3), events[0].Seq)
+		assert.Equal(t, uint64(4), events[1].Seq)
+
+		events, _ = instance.GetCounterHistory("visits", common.CounterHistoryQuery{After: 4})
+		require.Len(t, events, 1)
+		assert.Equal(t, uint64(5), events[0].New)
+
+		all, _ := instance.GetCounterHistory("visits", common.CounterHistoryQuery{})
+		events, _ = instance.GetCounterHistory("visits", common.CounterHistoryQuery{From: all[1].Timestamp, To: all[4].Timestamp})
+		for _, event := range events {
+			assert.False(t, event.Timestamp.Before(all[1].Timestamp))
+			assert.True(t, event.Timestamp.Before(all[4].Timestamp))
+		}
+
+		events, _ = instance.GetCounterHistory("visits", common.CounterHistoryQuery{To: all[0].Timestamp})
+		assert.Empty(t, events)
+	})
+	t.Run("should seek the first event from the time", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		for i := 0; i < 40; i++ {
+			_, _ = instance.IncrementCounter("visits", "alice")
+		}
+
+		all, _ := instance.GetCounterHistory("visits", common.CounterHistoryQuery{})
+		require.Len(t, all, 40)
+		for _, from := range []int{0, 1, 17, 39} {
+			expected := make([]common.CounterEvent, 0)
+			for _, event := range all[10:] {
+				if !event.Timestamp.Before(all[from].Timestamp) {
+					expected = append(expected, event)
+				}
+			}
+
+			events, err := instance.GetCounterHistory("visits", common.CounterHistoryQuery{After: 10, From: all[from].Timestamp})
+			require.Nil(t, err)
+			assert.Equal(t, expected, events, "from event %d", from)
+		}
+
+		events, _ := instance.GetCounterHistory("visits", common.CounterHistoryQuery{From: all[39].Timestamp.Add(time.Second)})
+		assert.Empty(t, events)
+	})
+	t.Run("deleting a counter should remove its history", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		_, _ = instance.IncrementCounter("visits", "alice")
+		_ = instance.DeleteCounter("visits")
+
+		_, err := instance.GetCounterHistory("visits", common.CounterHistoryQuery{})
+		assert.Equal(t, common.ErrCounterNotFound, err)
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		events, err := instance.GetCounterHistory("visits", common.CounterHistoryQuery{})
+		assert.Nil(t, err)
+		assert.Empty(t, events)
+
+		_, _ = instance.IncrementCounter("visits", "alice")
+		events, _ = instance.GetCounterHistory("visits", common.CounterHistoryQuery{})
+		require.Len(t, events, 1)
+		assert.Equal(t, uint64(1), events[0].Seq)
+	})
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const idempotencyKeyPrefix = "idempotency:"
+
+// BeginIdempotentRequest reserves the idempotency key of the user for a request with the provided fingerprint.
+// If the key is already reserved or completed and not expired, the existing record is returned and nothing
+// is written. Otherwise, an in-progress record expiring after lockTTL is written and nil is returned
+func (s *store) BeginIdempotentRequest(username string, key string, fingerprint string, lockTTL time.Duration) (*common.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.readIdempotencyRecord(username, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && time.Now().Before(existing.ExpiresAt) {
+		return existing, nil
+	}
+
+	return nil, s.putIdempotencyRecord(username, key, &common.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(lockTTL).UTC(),
+	})
+}
+
+// CompleteIdempotentRequest stores the outcome of the request that reserved the idempotency key
+func (s *store) CompleteIdempotentRequest(username string, key string, record common.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Completed = true
+
+	return s.putIdempotencyRecord(username, key, &record)
+}
+
+// ReleaseIdempotentRequest removes the idempotency key so the request can be retried
+func (s *store) ReleaseIdempotentRequest(username string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Delete(s.idempotencyKey(username, key), nil)
+}
+
+// PurgeIdempotencyRecords removes the expired idempotency records and returns how many were removed
+func (s *store) PurgeIdempotencyRecords() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(idempotencyKeyPrefix)), nil)
+	defer iter.Release()
+
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		var record common.IdempotencyRecord
+		err := json.Unmarshal(iter.Value(), &record)
+		if err == nil && now.Before(record.ExpiresAt) {
+			continue
+		}
+		// unreadable records are dropped as well
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	err := iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+func (s *store) readIdempotencyRecord(username string, key string) (*common.IdempotencyRecord, error) {
+	data, err := s.db.Get(s.idempotencyKey(username, key), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record common.IdempotencyRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *store) putIdempotencyRecord(username string, key string, record *common.IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Put(s.idempotencyKey(username, key), data, nil)
+}
+
+// idempotencyKey returns the key of the record, scoped to the canonical username
+func (s *store) idempotencyKey(username string, key string) []byte {
+	return s.key(idempotencyKeyPrefix + common.CanonicalUsername(username) + "\x00" + key)
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_IdempotentRequests(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should reserve, complete and replay a key", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		existing, err := instance.BeginIdempotentRequest("Alice", "key-1", "fp", time.Minute)
+		assert.Nil(t, err)
+		assert.Nil(t, existing)
+
+		existing, err = instance.BeginIdempotentRequest("alice", "key-1", "fp", time.Minute)
+		assert.Nil(t, err)
+		require.NotNil(t, existing)
+		assert.False(t, existing.Completed)
+
+		err = instance.CompleteIdempotentRequest("alice", "key-1", common.IdempotencyRecord{
+			Fingerprint: "fp",
+			Status:      200,
+			Body:        []byte(`{"value":1}`),
+			ExpiresAt:   time.Now().Add(time.Hour),
+		})
+		assert.Nil(t, err)
+
+		existing, err = instance.BeginIdempotentRequest("alice", "key-1", "fp", time.Minute)
+		assert.Nil(t, err)
+		require.NotNil(t, existing)
+		assert.True(t, existing.Completed)
+		assert.Equal(t, 200, existing.Status)
+		assert.Equal(t, []byte(`{"value":1}`), existing.Body)
+
+		// the keys are scoped per user and per tenant
+		existing, err = instance.BeginIdempotentRequest("bob", "key-1", "fp", time.Minute)
+		assert.Nil(t, err)
+		assert.Nil(t, existing)
+		existing, err = instance.ForTenant("acme").BeginIdempotentRequest("alice", "key-1", "fp", time.Minute)
+		assert.Nil(t, err)
+		assert.Nil(t, existing)
+	})
+	t.Run("released and expired keys can be reused", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.BeginIdempotentRequest("alice", "key-1", "fp", time.Minute)
+		assert.Nil(t, instance.ReleaseIdempotentRequest("alice", "key-1"))
+		existing, err := instance.BeginIdempotentRequest("alice", "key-1", "fp", -time.Second)
+		assert.Nil(t, err)
+		assert.Nil(t, existing)
+
+		existing, err = instance.BeginIdempotentRequest("alice", "key-1", "other", time.Minute)
+		assert.Nil(t, err)
+		assert.Nil(t, existing)
+	})
+	t.Run("should purge the expired records", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.BeginIdempotentRequest("alice", "expired", "fp", -time.Second)
+		_, _ = instance.BeginIdempotentRequest("alice", "live", "fp", time.Minute)
+		_, _ = instance.ForTenant("acme").BeginIdempotentRequest("alice", "expired", "fp", -time.Second)
+
+		removed, err := instance.PurgeIdempotencyRecords()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, removed)
+
+		existing, _ := instance.BeginIdempotentRequest("alice", "live", "fp", time.Minute)
+		assert.NotNil(t, existing)
+	})
+	t.Run("concurrent duplicates should reserve the key once", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		var mut sync.Mutex
+		reserved := 0
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				existing, err := instance.BeginIdempotentRequest("alice", "key-1", "fp", time.Minute)
+				assert.Nil(t, err)
+				if existing == nil {
+					mut.Lock()
+					reserved++
+					mut.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, reserved)
+	})
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// userLockStripes is the number of stripes of the user locks
+const userLockStripes = 64
+
+// keyLocks serializes the writers of the same key without blocking the writers of the other keys. The keys are
+// spread over a fixed set of stripes, two keys sharing a stripe wait for each other.
+// When both are needed, the write lock must be acquired before the key locks
+type keyLocks struct {
+	stripes [userLockStripes]sync.Mutex
+}
+
+// lock acquires the stripe of the key and returns the function releasing it
+func (locks *keyLocks) lock(key []byte) func() {
+	hash := fnv.New32a()
+	_, _ = hash.Write(key)
+	stripe := &locks.stripes[hash.Sum32()%userLockStripes]
+
+	stripe.Lock()
+	return stripe.Unlock
+}
+
+// lockAll acquires all the stripes, in order, and returns the function releasing them
+func (locks *keyLocks) lockAll() func() {
+	for i := range locks.stripes {
+		locks.stripes[i].Lock()
+	}
+
+	return func() {
+		for i := range locks.stripes {
+			locks.stripes[i].Unlock()
+		}
+	}
+}
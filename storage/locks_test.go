@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func stripeOf(key string) uint32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return hash.Sum32() % userLockStripes
+}
+
+func TestKeyLocks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should only block the writers of the same stripe", func(t *testing.T) {
+		locks := &keyLocks{}
+		other := "bob"
+		for stripeOf(other) == stripeOf("alice") {
+			other += "x"
+		}
+
+		unlock := locks.lock([]byte("alice"))
+		unlockOther := locks.lock([]byte(other))
+		unlockOther()
+
+		acquired := make(chan struct{})
+		go func() {
+			release := locks.lock([]byte("alice"))
+			close(acquired)
+			release()
+		}()
+
+		select {
+		case <-acquired:
+			assert.Fail(t, "the same key should wait for the lock")
+		case <-time.After(20 * time.Millisecond):
+		}
+		unlock()
+		<-acquired
+	})
+	t.Run("lock all should wait for every stripe", func(t *testing.T) {
+		locks := &keyLocks{}
+		unlock := locks.lock([]byte("alice"))
+
+		acquired := make(chan struct{})
+		go func() {
+			release := locks.lockAll()
+			close(acquired)
+			release()
+		}()
+
+		select {
+		case <-acquired:
+			assert.Fail(t, "lock all should wait for the held stripe")
+		case <-time.After(20 * time.Millisecond):
+		}
+		unlock()
+		<-acquired
+	})
+}
+
+// fastHasher returns a pool with the cheapest bcrypt cost and a timeout no slow machine reaches, so the concurrent
+// hashing of the tests can not fail with common.ErrHasherBusy, even under the race detector on a single CPU
+func fastHasher(t *testing.T) *common.PasswordHasher {
+	hasher, err := common.NewPasswordHasher(common.PasswordHasherConfig{
+		Cost:       bcrypt.MinCost,
+		Workers:    1,
+		QueueLimit: common.DefaultHasherQueueLimit,
+		Timeout:    time.Minute,
+	})
+	require.Nil(t, err)
+
+	return hasher
+}
+
+func TestStore_UserLocks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("concurrent registrations of the same user should create it once", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		instance.SetPasswordHasher(fastHasher(t))
+
+		var created atomic.Int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				err := instance.SaveUser("Alice", fmt.Sprintf("pass-%d", i), "user")
+				if err == nil {
+					created.Add(1)
+					return
+				}
+				assert.Equal(t, ErrUserAlreadyExists, err)
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), created.Load())
+	})
+	t.Run("concurrent password changes, registrations and increments should not interfere", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		instance.SetPasswordHasher(fastHasher(t))
+		require.Nil(t, instance.SaveUser("alice", "initial", "user"))
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			wg.Add(3)
+			go func(i int) {
+				defer wg.Done()
+				assert.Nil(t, instance.UpdatePassword("alice", fmt.Sprintf("pass-%d", i)))
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				assert.Nil(t, instance.SaveUser(fmt.Sprintf("user-%d", i), "pass", "user"))
+			}(i)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					_, err := instance.IncrementCounter(common.DefaultCounterName, "alice")
+					assert.Nil(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(60), value)
+		user, err := instance.GetUser("alice")
+		require.Nil(t, err)
+		assert.Equal(t, "user", user.Role)
+		matches := 0
+		for i := 0; i < 3; i++ {
+			if bcrypt.CompareHashAndPassword(user.Hash, []byte(fmt.Sprintf("pass-%d", i))) == nil {
+				matches++
+			}
+		}
+		assert.Equal(t, 1, matches)
+	})
+	t.Run("counter writes should not wait for the password hashing", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.SaveUser("alice", "initial", "user"))
+
+		hasher := &blockingHasher{started: make(chan struct{}, 2), release: make(chan struct{})}
+		instance.SetPasswordHasher(hasher)
+
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, instance.SaveUser("bob", "password", "user"))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, instance.UpdatePassword("alice", "changed"))
+		}()
+		<-hasher.started
+		<-hasher.started
+
+		// with the hashing under the counter lock, the increment would wait for the release
+		incremented := make(chan error, 1)
+		go func() {
+			_, err := instance.IncrementCounter(common.DefaultCounterName, "alice")
+			incremented <- err
+		}()
+		select {
+		case err := <-incremented:
+			assert.Nil(t, err)
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "the increment waited for the password hashing")
+		}
+
+		close(hasher.release)
+		wg.Wait()
+		_, err := instance.GetUser("bob")
+		assert.Nil(t, err)
+	})
+}
+
+// blockingHasher signals every hash started and holds it until released
+type blockingHasher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (hasher *blockingHasher) Hash(password string) ([]byte, error) {
+	hasher.started <- struct{}{}
+	<-hasher.release
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+}
+
+func benchmarkIncrementsWithRegistrations(b *testing.B, registrations bool) {
+	instance, _ := NewStore(b.TempDir())
+	defer func() {
+		_ = instance.Close()
+	}()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; registrations; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = instance.SaveUser(fmt.Sprintf("user-%d", i), "password", "user")
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := instance.IncrementCounter(common.DefaultCounterName, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	close(stop)
+	<-stopped
+}
+
+// BenchmarkStore_IncrementDuringRegistrations compares the increment latency with and without registrations
+// running in the background
+func BenchmarkStore_IncrementDuringRegistrations(b *testing.B) {
+	b.Run("idle", func(b *testing.B) {
+		benchmarkIncrementsWithRegistrations(b, false)
+	})
+	b.Run("registrations", func(b *testing.B) {
+		benchmarkIncrementsWithRegistrations(b, true)
+	})
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// UsernameMigrationReport holds the outcome of a username canonicalization migration
+type UsernameMigrationReport struct {
+	// Migrated contains the users that were (or, on a dry run, would be) moved under their canonical key
+	Migrated []string
+	// Collisions maps a canonical username to all the stored users that share it. These users are not touched
+	Collisions map[string][]string
+}
+
+// MigrateUsernames moves the tenant's users stored under a raw (non-canonical) key to their canonical key.
+// Users whose canonical forms collide are only reported and have to be resolved manually.
+// If dryRun is set, nothing is written.
+func (s *store) MigrateUsernames(dryRun bool) (*UsernameMigrationReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock := s.userLocks.lockAll()
+	defer unlock()
+
+	type storedUser struct {
+		key  string
+		user common.User
+	}
+
+	byCanonical := make(map[string][]storedUser)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(userKeyPrefix)), nil)
+	for iter.Next() {
+		var user common.User
+		err := json.Unmarshal(iter.Value(), &user)
+		if err != nil {
+			iter.Release()
+			return nil, err
+		}
+
+		rawName := strings.TrimPrefix(string(iter.Key()), s.prefix+userKeyPrefix)
+		canonical := common.CanonicalUsername(rawName)
+		byCanonical[canonical] = append(byCanonical[canonical], storedUser{
+			key:  string(iter.Key()),
+			user: user,
+		})
+	}
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UsernameMigrationReport{
+		Collisions: make(map[string][]string),
+	}
+	batch := new(leveldb.Batch)
+	for canonical, users := range byCanonical {
+		if len(users) > 1 {
+			for _, u := range users {
+				report.Collisions[canonical] = append(report.Collisions[canonical], u.user.Username)
+			}
+			sort.Strings(report.Collisions[canonical])
+			continue
+		}
+
+		u := users[0]
+		newKey := s.prefix + userKeyPrefix + canonical
+		if u.key == newKey {
+			continue
+		}
+
+		u.user.Username = common.DisplayUsername(u.user.Username)
+		data, errMarshal := json.Marshal(u.user)
+		if errMarshal != nil {
+			return nil, errMarshal
+		}
+
+		batch.Delete([]byte(u.key))
+		batch.Put([]byte(newKey), data)
+		report.Migrated = append(report.Migrated, u.user.Username)
+	}
+	sort.Strings(report.Migrated)
+
+	if dryRun || batch.Len() == 0 {
+		return report, nil
+	}
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
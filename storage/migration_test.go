@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putRawUser(t *testing.T, instance *store, key string, username string) {
+	data, err := json.Marshal(common.User{Username: username, Role: "user"})
+	assert.Nil(t, err)
+	err = instance.db.Put([]byte(userKeyPrefix+key), data, nil)
+	assert.Nil(t, err)
+}
+
+func TestStore_MigrateUsernames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should error if the DB is closed", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		_ = instance.Close()
+
+		report, err := instance.MigrateUsernames(false)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "leveldb: closed")
+		assert.Nil(t, report)
+	})
+	t.Run("dry run should only report", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		putRawUser(t, instance, "Alice", "Alice")
+
+		report, err := instance.MigrateUsernames(true)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Alice"}, report.Migrated)
+		assert.Empty(t, report.Collisions)
+
+		has, _ := instance.db.Has([]byte(userKeyPrefix+"Alice"), nil)
+		assert.True(t, has)
+	})
+	t.Run("should migrate and report collisions", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		putRawUser(t, instance, "Alice", "Alice")
+		putRawUser(t, instance, "Bob", "Bob")
+		putRawUser(t, instance, "BOB", "BOB")
+		_ = instance.SaveUser("carol", "pass", "user")
+
+		report, err := instance.MigrateUsernames(false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Alice"}, report.Migrated)
+		assert.Equal(t, map[string][]string{"bob": {"BOB", "Bob"}}, report.Collisions)
+
+		user, err := instance.GetUser("alice")
+		assert.Nil(t, err)
+		assert.Equal(t, "Alice", user.Username)
+
+		has, _ := instance.db.Has([]byte(userKeyPrefix+"Alice"), nil)
+		assert.False(t, has)
+		has, _ = instance.db.Has([]byte(userKeyPrefix+"Bob"), nil)
+		assert.True(t, has)
+
+		// running again is a no-op
+		report, err = instance.MigrateUsernames(false)
+		assert.Nil(t, err)
+		assert.Empty(t, report.Migrated)
+		assert.Len(t, report.Collisions, 1)
+	})
+}
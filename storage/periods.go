@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const counterPeriodKeyPrefix = "counterperiod:"
+
+// GetCounterPeriods returns the archived periods of the counter matching the query, oldest first.
+// The time range applies to the end of the periods and the cursor is the sequence of the last period returned
+func (s *store) GetCounterPeriods(name string, query common.CounterHistoryQuery) ([]common.CounterPeriod, error) {
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	periods := make([]common.CounterPeriod, 0)
+	if query.After == math.MaxUint64 {
+		return periods, nil
+	}
+
+	iter := s.db.NewIterator(&util.Range{
+		Start: s.counterPeriodKey(name, query.After+1),
+		Limit: util.BytesPrefix(s.counterPeriodPrefix(name)).Limit,
+	}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var period common.CounterPeriod
+		err = json.Unmarshal(iter.Value(), &period)
+		if err != nil {
+			return nil, err
+		}
+		if !query.From.IsZero() && period.End.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !period.End.Before(query.To) {
+			break
+		}
+
+		periods = append(periods, period)
+		if query.Limit > 0 && len(periods) >= query.Limit {
+			break
+		}
+	}
+
+	return periods, iter.Error()
+}
+
+// archiveCounterPeriod adds to the batch the period closed by the reset event and returns it.
+// The caller must hold the lock
+func (s *store) archiveCounterPeriod(batch *leveldb.Batch, info *common.CounterInfo, event *common.CounterEvent, scheduleID string) (*common.CounterPeriod, error) {
+	period := &common.CounterPeriod{
+		Seq:        event.Seq,
+		End:        event.Timestamp,
+		Value:      event.Old,
+		ScheduleID: scheduleID,
+	}
+
+	start, err := s.lastCounterPeriodEnd(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	if start.IsZero() {
+		start = info.CreatedAt
+	}
+	if !start.IsZero() {
+		period.Start = &start
+	}
+
+	data, err := json.Marshal(period)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(s.counterPeriodKey(info.Name, period.Seq), data)
+
+	return period, nil
+}
+
+// lastCounterPeriodEnd returns the end of the last archived period of the counter, or the zero time if there is none
+func (s *store) lastCounterPeriodEnd(name string) (time.Time, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(s.counterPeriodPrefix(name)), nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		return time.Time{}, iter.Error()
+	}
+
+	var period common.CounterPeriod
+	err := json.Unmarshal(iter.Value(), &period)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return period.End, nil
+}
+
+// deleteCounterPeriods adds the removal of all the archived periods of the counter to the batch
+func (s *store) deleteCounterPeriods(batch *leveldb.Batch, name string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.counterPeriodPrefix(name)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+
+	return iter.Error()
+}
+
+func (s *store) counterPeriodPrefix(name string) []byte {
+	return s.key(counterPeriodKeyPrefix + name + "\x00")
+}
+
+// counterPeriodKey returns the key of the period closed by the reset event with the sequence
+func (s *store) counterPeriodKey(name string, seq uint64) []byte {
+	return append(s.counterPeriodPrefix(name), encodeCounterValue(seq)...)
+}
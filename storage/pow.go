@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding/binary"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const usedChallengeKeyPrefix = "powused:"
+
+// UseChallenge marks the proof of work challenge as used until it expires. It fails with common.ErrChallengeUsed
+// if the challenge was already used
+func (s *store) UseChallenge(id string, expiresAt time.Time) error {
+	key := s.usedChallengeKey(id)
+	// only the uses of the same challenge need to wait for each other, the keys never clash with the user ones
+	unlock := s.userLocks.lock(key)
+	defer unlock()
+
+	used, err := s.db.Has(key, nil)
+	if err != nil {
+		return err
+	}
+	if used {
+		return common.ErrChallengeUsed
+	}
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(expiresAt.Unix()))
+
+	return s.db.Put(key, data, nil)
+}
+
+// PurgeUsedChallenges removes the used challenges that expired, they can not be replayed anymore,
+// and returns how many were removed. It takes no lock: an expired challenge is never used again
+func (s *store) PurgeUsedChallenges() (int, error) {
+	now := time.Now().Unix()
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(usedChallengeKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		value := iter.Value()
+		// unreadable entries are dropped as well
+		if len(value) != 8 || int64(binary.BigEndian.Uint64(value)) <= now {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	err := iter.Error()
+	if err != nil || batch.Len() == 0 {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+func (s *store) usedChallengeKey(id string) []byte {
+	return s.key(usedChallengeKeyPrefix + id)
+}
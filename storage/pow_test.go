@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_UsedChallenges(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should use a challenge only once", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		expiresAt := time.Now().Add(time.Minute)
+		err := instance.UseChallenge("first", expiresAt)
+		require.Nil(t, err)
+		err = instance.UseChallenge("first", expiresAt)
+		assert.Equal(t, common.ErrChallengeUsed, err)
+		err = instance.UseChallenge("second", expiresAt)
+		assert.Nil(t, err)
+	})
+	t.Run("concurrent uses of a challenge should let one through", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		expiresAt := time.Now().Add(time.Minute)
+		var accepted atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if instance.UseChallenge("shared", expiresAt) == nil {
+					accepted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), accepted.Load())
+	})
+	t.Run("should purge the expired challenges", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.UseChallenge("expired", time.Now().Add(-time.Second))
+		_ = instance.UseChallenge("live", time.Now().Add(time.Minute))
+
+		removed, err := instance.PurgeUsedChallenges()
+		require.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, common.ErrChallengeUsed, instance.UseChallenge("live", time.Now().Add(time.Minute)))
+	})
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const quotaRoleKeyPrefix = "quota:role:"
+const quotaUserKeyPrefix = "quota:user:"
+const quotaUsageKeyPrefix = "quotausage:"
+
+// SetRoleQuota sets the increment quota of the users with the role. A nil quota removes it
+func (s *store) SetRoleQuota(role string, quota *common.Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.putQuota(s.key(quotaRoleKeyPrefix+role), quota)
+}
+
+// ListRoleQuotas returns the increment quotas by role
+func (s *store) ListRoleQuotas() (map[string]common.Quota, error) {
+	prefix := s.key(quotaRoleKeyPrefix)
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	quotas := make(map[string]common.Quota)
+	for iter.Next() {
+		var quota common.Quota
+		err := json.Unmarshal(iter.Value(), &quota)
+		if err != nil {
+			return nil, err
+		}
+		quotas[string(iter.Key()[len(prefix):])] = quota
+	}
+
+	return quotas, iter.Error()
+}
+
+// SetUserQuota overrides the increment quota of the user, whatever its roles. A nil quota removes the override
+func (s *store) SetUserQuota(username string, quota *common.Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	return s.putQuota(s.quotaUserKey(username), quota)
+}
+
+// GetQuotaStatus returns the quota applying to the user and its usage in the current window
+func (s *store) GetQuotaStatus(username string) (*common.QuotaStatus, error) {
+	user, err := s.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	override, quota, source, err := s.effectiveQuota(user)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &common.QuotaStatus{
+		Username: user.Username,
+		Override: override,
+		Quota:    quota,
+		Source:   source,
+	}
+	if quota == nil {
+		return status, nil
+	}
+
+	now := time.Now()
+	status.Used, err = s.readQuotaUsage(username, quota, now)
+	if err != nil {
+		return nil, err
+	}
+	if status.Used < quota.Limit {
+		status.Remaining = quota.Limit - status.Used
+	}
+	status.ResetAt = quotaResetAt(quota, now)
+
+	return status, nil
+}
+
+// PurgeQuotaUsage removes the usage of the ended quota windows and returns how many were removed
+func (s *store) PurgeQuotaUsage() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(quotaUsageKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		period, start, ok := parseQuotaUsageKey(iter.Key())
+		if !ok {
+			continue
+		}
+		size, err := common.BucketSize(period)
+		if err != nil || !start.Add(size).After(now) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	err := iter.Error()
+	if err != nil || batch.Len() == 0 {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// stageQuotaUsage adds the increment to the usage of the user quota in the batch. It returns a QuotaExceededError,
+// without changing the batch, if the increment does not fit in the current window. The caller must hold the lock
+func (s *store) stageQuotaUsage(batch *leveldb.Batch, username string, increment uint64, now time.Time) error {
+	user, err := s.GetUser(username)
+	if errors.Is(err, common.ErrUserNotFound) {
+		// the quotas only apply to the registered users
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, quota, _, err := s.effectiveQuota(user)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	used, err := s.readQuotaUsage(username, quota, now)
+	if err != nil {
+		return err
+	}
+	if used > quota.Limit || increment > quota.Limit-used {
+		quotaErr := &common.QuotaExceededError{Limit: quota.Limit, ResetAt: quotaResetAt(quota, now)}
+		if used < quota.Limit {
+			quotaErr.Remaining = quota.Limit - used
+		}
+		return quotaErr
+	}
+
+	batch.Put(s.quotaUsageKey(username, quota, now), encodeCounterValue(used+increment))
+	return nil
+}
+
+// effectiveQuota returns the user override, if any, and the quota applying to the user: the override or else the
+// most permissive quota of the roles of the user, its own and the ones of its groups. A user without any is unlimited
+func (s *store) effectiveQuota(user *common.User) (*common.Quota, *common.Quota, string, error) {
+	override, err := s.readQuota(s.quotaUserKey(user.Username))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if override != nil {
+		return override, override, "user", nil
+	}
+
+	roles := []string{user.Role}
+	groups, err := s.GetUserGroups(user.Username)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	for _, group := range groups {
+		roles = append(roles, group.Roles...)
+	}
+
+	var best *common.Quota
+	source := ""
+	for _, role := range roles {
+		quota, errRead := s.readQuota(s.key(quotaRoleKeyPrefix + role))
+		if errRead != nil {
+			return nil, nil, "", errRead
+		}
+		if quota != nil && (best == nil || quotaRate(quota) > quotaRate(best)) {
+			best = quota
+			source = "role:" + role
+		}
+	}
+
+	return nil, best, source, nil
+}
+
+func (s *store) readQuota(key []byte) (*common.Quota, error) {
+	data, err := s.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var quota common.Quota
+	err = json.Unmarshal(data, &quota)
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (s *store) putQuota(key []byte, quota *common.Quota) error {
+	if quota == nil {
+		return s.db.Delete(key, nil)
+	}
+
+	err := quota.Validate()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Put(key, data, nil)
+}
+
+func (s *store) readQuotaUsage(username string, quota *common.Quota, now time.Time) (uint64, error) {
+	data, err := s.get(s.quotaUsageKey(username, quota, now))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounterValue(data)
+}
+
+func (s *store) quotaUserKey(username string) []byte {
+	return s.key(quotaUserKeyPrefix + common.CanonicalUsername(username))
+}
+
+// quotaUsageKey returns the key of the user usage in the quota window holding now. The period is part
+// of the key so a quota changing its period starts a fresh window
+func (s *store) quotaUsageKey(username string, quota *common.Quota, now time.Time) []byte {
+	start, _ := common.BucketStart(now, quota.Period)
+	key := s.key(quotaUsageKeyPrefix + common.CanonicalUsername(username) + "\x00" + quota.Period + "\x00")
+
+	return append(key, encodeCounterValue(uint64(start.Unix()))...)
+}
+
+// parseQuotaUsageKey returns the period and the window start from a quota usage key
+func parseQuotaUsageKey(key []byte) (string, time.Time, bool) {
+	if len(key) < 10 || key[len(key)-9] != 0 {
+		return "", time.Time{}, false
+	}
+
+	head := key[:len(key)-9]
+	separator := bytes.LastIndexByte(head, 0)
+	if separator < 0 {
+		return "", time.Time{}, false
+	}
+	start := int64(binary.BigEndian.Uint64(key[len(key)-8:]))
+
+	return string(head[separator+1:]), time.Unix(start, 0).UTC(), true
+}
+
+func quotaResetAt(quota *common.Quota, now time.Time) time.Time {
+	start, _ := common.BucketStart(now, quota.Period)
+	size, _ := common.BucketSize(quota.Period)
+
+	return start.Add(size)
+}
+
+// quotaRate returns the quota limit per second, to compare quotas with different periods
+func quotaRate(quota *common.Quota) float64 {
+	size, err := common.BucketSize(quota.Period)
+	if err != nil {
+		return 0
+	}
+
+	return float64(quota.Limit) / size.Seconds()
+}
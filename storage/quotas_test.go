@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Quotas(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should enforce the role quota atomically", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		require.Nil(t, instance.SetRoleQuota("user", &common.Quota{Limit: 5, Period: common.GranularityDay}))
+
+		_, err := instance.AddToCounter(common.DefaultCounterName, 3, "alice")
+		require.Nil(t, err)
+		_, err = instance.AddToCounter(common.DefaultCounterName, 3, "alice")
+		require.True(t, errors.Is(err, common.ErrQuotaExceeded))
+
+		var quotaErr *common.QuotaExceededError
+		require.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, uint64(5), quotaErr.Limit)
+		assert.Equal(t, uint64(2), quotaErr.Remaining)
+		start, _ := common.BucketStart(time.Now(), common.GranularityDay)
+		assert.Equal(t, start.Add(24*time.Hour), quotaErr.ResetAt)
+
+		// the failed increment left no trace
+		val, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(3), val)
+		events, _ := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{})
+		assert.Len(t, events, 1)
+
+		// the decrements and the anonymous changes are not counted
+		_, err = instance.AddToCounter(common.DefaultCounterName, -3, "alice")
+		require.Nil(t, err)
+		_, err = instance.AddToCounter(common.DefaultCounterName, 10, "")
+		require.Nil(t, err)
+		_, err = instance.CompareAndSwapCounter(common.DefaultCounterName, 10, 12, "alice")
+		require.Nil(t, err)
+		_, err = instance.IncrementCounter(common.DefaultCounterName, "alice")
+		assert.True(t, errors.Is(err, common.ErrQuotaExceeded))
+
+		status, err := instance.GetQuotaStatus("Alice")
+		require.Nil(t, err)
+		assert.Equal(t, "role:user", status.Source)
+		assert.Equal(t, uint64(5), status.Used)
+		assert.Zero(t, status.Remaining)
+	})
+	t.Run("should prefer the user override and the most permissive role", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		_ = instance.CreateGroup("kiosks", []string{"kiosk"})
+		_ = instance.AddGroupMember("kiosks", "alice")
+		_ = instance.SetRoleQuota("user", &common.Quota{Limit: 100, Period: common.GranularityDay})
+		_ = instance.SetRoleQuota("kiosk", &common.Quota{Limit: 10, Period: common.GranularityMinute})
+
+		status, err := instance.GetQuotaStatus("alice")
+		require.Nil(t, err)
+		assert.Equal(t, "role:kiosk", status.Source)
+		assert.Nil(t, status.Override)
+
+		override := &common.Quota{Limit: 1, Period: common.GranularityHour}
+		require.Nil(t, instance.SetUserQuota("alice", override))
+		status, _ = instance.GetQuotaStatus("alice")
+		assert.Equal(t, "user", status.Source)
+		assert.Equal(t, override, status.Quota)
+
+		_, err = instance.IncrementCounter(common.DefaultCounterName, "alice")
+		require.Nil(t, err)
+		_, err = instance.IncrementCounter(common.DefaultCounterName, "alice")
+		assert.True(t, errors.Is(err, common.ErrQuotaExceeded))
+
+		require.Nil(t, instance.SetUserQuota("alice", nil))
+		_, err = instance.IncrementCounter(common.DefaultCounterName, "alice")
+		assert.Nil(t, err)
+
+		quotas, err := instance.ListRoleQuotas()
+		require.Nil(t, err)
+		assert.Len(t, quotas, 2)
+		assert.Equal(t, uint64(100), quotas["user"].Limit)
+	})
+	t.Run("should validate the quotas", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		err := instance.SetRoleQuota("user", &common.Quota{Limit: 1, Period: "fortnight"})
+		assert.True(t, errors.Is(err, common.ErrInvalidQuota))
+		assert.Equal(t, common.ErrUserNotFound, instance.SetUserQuota("missing", &common.Quota{Limit: 1, Period: common.GranularityDay}))
+		_, err = instance.GetQuotaStatus("missing")
+		assert.Equal(t, common.ErrUserNotFound, err)
+
+		_ = instance.SaveUser("bob", "pass", "user")
+		status, err := instance.GetQuotaStatus("bob")
+		require.Nil(t, err)
+		assert.Nil(t, status.Quota)
+	})
+	t.Run("should purge the ended windows", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		_ = instance.SetRoleQuota("user", &common.Quota{Limit: 10, Period: common.GranularityMinute})
+		_, _ = instance.IncrementCounter(common.DefaultCounterName, "alice")
+		old := &common.Quota{Limit: 10, Period: common.GranularityMinute}
+		_ = instance.db.Put(instance.quotaUsageKey("alice", old, time.Now().Add(-time.Hour)), encodeCounterValue(3), nil)
+
+		removed, err := instance.PurgeQuotaUsage()
+		require.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		status, _ := instance.GetQuotaStatus("alice")
+		assert.Equal(t, uint64(1), status.Used)
+	})
+}
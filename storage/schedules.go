@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const resetScheduleKeyPrefix = "resetschedule:"
+
+// CreateResetSchedule validates and stores a new reset schedule of an existing counter. The ID, the creation
+// time and the next run are assigned here
+func (s *store) CreateResetSchedule(schedule common.ResetSchedule) (*common.ResetSchedule, error) {
+	now := time.Now().UTC()
+	nextRun, err := schedule.Next(now)
+	if err != nil {
+		return nil, err
+	}
+
+	buff := make([]byte, 8)
+	_, err = rand.Read(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.checkCounterExists(schedule.Counter)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.ID = hex.EncodeToString(buff)
+	schedule.CreatedAt = now
+	schedule.NextRun = nextRun
+	schedule.LastRun = nil
+	schedule.LastError = ""
+
+	err = s.putResetSchedule(nil, &schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// ListResetSchedules returns all the reset schedules
+func (s *store) ListResetSchedules() ([]common.ResetSchedule, error) {
+	schedules := make([]common.ResetSchedule, 0)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(resetScheduleKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var schedule common.ResetSchedule
+		err := json.Unmarshal(iter.Value(), &schedule)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, iter.Error()
+}
+
+// DeleteResetSchedule removes the reset schedule
+func (s *store) DeleteResetSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.db.Has(s.resetScheduleKey(id), nil)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return common.ErrScheduleNotFound
+	}
+
+	return s.db.Delete(s.resetScheduleKey(id), nil)
+}
+
+// RunResetSchedule resets the counter of the schedule if the schedule is due at now and returns the archived period,
+// or nil if it is not due. The reset and the advance of the next run are written in a single batch, so a schedule
+// never fires twice for the same due time, even after a crash. The runs missed while the server was down are
+// coalesced into one. If the counter can not be reset, the schedule still advances and the reason is recorded
+func (s *store) RunResetSchedule(id string, now time.Time) (*common.CounterPeriod, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.readResetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(schedule.NextRun) {
+		return nil, nil
+	}
+
+	nextRun, err := schedule.Next(now)
+	if err != nil {
+		return nil, err
+	}
+	lastRun := schedule.NextRun
+	schedule.LastRun = &lastRun
+	schedule.NextRun = nextRun
+	schedule.LastError = ""
+
+	batch := new(leveldb.Batch)
+	_, period, errReset := s.stageCounterReset(batch, schedule.Counter, "", schedule.ID)
+	if errReset != nil {
+		// skip this run only, the counter may become resettable again
+		batch.Reset()
+		schedule.LastError = errReset.Error()
+	}
+
+	err = s.putResetSchedule(batch, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return period, errReset
+}
+
+// deleteResetSchedules adds the removal of the reset schedules of the counter to the batch
+func (s *store) deleteResetSchedules(batch *leveldb.Batch, name string) error {
+	schedules, err := s.ListResetSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if schedule.Counter == name {
+			batch.Delete(s.resetScheduleKey(schedule.ID))
+		}
+	}
+
+	return nil
+}
+
+func (s *store) readResetSchedule(id string) (*common.ResetSchedule, error) {
+	data, err := s.db.Get(s.resetScheduleKey(id), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, common.ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule common.ResetSchedule
+	err = json.Unmarshal(data, &schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// putResetSchedule writes the schedule together with the operations already present in the batch
+func (s *store) putResetSchedule(batch *leveldb.Batch, schedule *common.ResetSchedule) error {
+	if batch == nil {
+		batch = new(leveldb.Batch)
+	}
+
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	batch.Put(s.resetScheduleKey(schedule.ID), data)
+
+	return s.db.Write(batch, nil)
+}
+
+func (s *store) resetScheduleKey(id string) []byte {
+	return s.key(resetScheduleKeyPrefix + id)
+}
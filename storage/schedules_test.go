@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_CounterPeriods(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should archive every reset", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		_, _ = instance.AddToCounter("visits", 5, "alice")
+		_, _ = instance.ResetCounter("visits", "admin")
+		_, _ = instance.AddToCounter("visits", 3, "alice")
+		_, _ = instance.ResetCounter("visits", "admin")
+
+		periods, err := instance.GetCounterPeriods("visits", common.CounterHistoryQuery{})
+		require.Nil(t, err)
+		require.Len(t, periods, 2)
+
+		info, _ := instance.GetCounterInfo("visits")
+		assert.Equal(t, uint64(2), periods[0].Seq)
+		assert.Equal(t, uint64(5), periods[0].Value)
+		assert.Equal(t, info.CreatedAt, *periods[0].Start)
+		assert.Equal(t, uint64(4), periods[1].Seq)
+		assert.Equal(t, uint64(3), periods[1].Value)
+		assert.Equal(t, periods[0].End, *periods[1].Start)
+
+		periods, err = instance.GetCounterPeriods("visits", common.CounterHistoryQuery{After: 2})
+		require.Nil(t, err)
+		require.Len(t, periods, 1)
+		assert.Equal(t, uint64(4), periods[0].Seq)
+
+		// the default counter has no creation time
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		periods, err = instance.GetCounterPeriods(common.DefaultCounterName, common.CounterHistoryQuery{})
+		require.Nil(t, err)
+		require.Len(t, periods, 1)
+		assert.Nil(t, periods[0].Start)
+
+		_, err = instance.GetCounterPeriods("missing", common.CounterHistoryQuery{})
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+}
+
+func TestStore_ResetSchedules(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should validate the schedules", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, err := instance.CreateResetSchedule(common.ResetSchedule{Counter: common.DefaultCounterName, Cron: "weekly", Timezone: "UTC"})
+		assert.True(t, errors.Is(err, common.ErrInvalidSchedule))
+		_, err = instance.CreateResetSchedule(common.ResetSchedule{Counter: "missing", Cron: "@weekly", Timezone: "UTC"})
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		assert.Equal(t, common.ErrScheduleNotFound, instance.DeleteResetSchedule("missing"))
+		_, err = instance.RunResetSchedule("missing", time.Now())
+		assert.Equal(t, common.ErrScheduleNotFound, err)
+	})
+	t.Run("should fire once per due time and survive restarts", func(t *testing.T) {
+		dir := t.TempDir()
+		instance, _ := NewStore(dir)
+
+		schedule, err := instance.CreateResetSchedule(common.ResetSchedule{Counter: common.DefaultCounterName, Cron: "0 0 * * MON", Timezone: "Europe/Bucharest", CreatedBy: "admin"})
+		require.Nil(t, err)
+		assert.NotEmpty(t, schedule.ID)
+		assert.True(t, schedule.NextRun.After(time.Now()))
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 7, "alice")
+
+		period, err := instance.RunResetSchedule(schedule.ID, time.Now())
+		assert.Nil(t, err)
+		assert.Nil(t, period)
+		_ = instance.Close()
+
+		// the runs missed while the server was down are coalesced
+		instance, _ = NewStore(dir)
+		defer func() {
+			_ = instance.Close()
+		}()
+		now := schedule.NextRun.Add(15 * 24 * time.Hour)
+		period, err = instance.RunResetSchedule(schedule.ID, now)
+		require.Nil(t, err)
+		require.NotNil(t, period)
+		assert.Equal(t, uint64(7), period.Value)
+		assert.Equal(t, schedule.ID, period.ScheduleID)
+		val, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Zero(t, val)
+
+		period, err = instance.RunResetSchedule(schedule.ID, now)
+		assert.Nil(t, err)
+		assert.Nil(t, period)
+
+		schedules, err := instance.ListResetSchedules()
+		require.Nil(t, err)
+		require.Len(t, schedules, 1)
+		assert.Equal(t, schedule.NextRun, *schedules[0].LastRun)
+		assert.True(t, schedules[0].NextRun.After(now))
+		assert.Equal(t, time.Monday, schedules[0].NextRun.Add(3*time.Hour).Weekday())
+	})
+	t.Run("should skip the runs of a counter that can not be reset", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		low := uint64(1)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "seats", Min: &low})
+		schedule, _ := instance.CreateResetSchedule(common.ResetSchedule{Counter: "seats", Cron: "@daily", Timezone: "UTC"})
+
+		period, err := instance.RunResetSchedule(schedule.ID, schedule.NextRun)
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+		assert.Nil(t, period)
+
+		schedules, _ := instance.ListResetSchedules()
+		assert.Equal(t, schedule.NextRun.Add(24*time.Hour), schedules[0].NextRun)
+		assert.NotEmpty(t, schedules[0].LastError)
+	})
+	t.Run("should be deleted with the schedule or the counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		first, _ := instance.CreateResetSchedule(common.ResetSchedule{Counter: "visits", Cron: "@daily"})
+		_, _ = instance.CreateResetSchedule(common.ResetSchedule{Counter: "visits", Cron: "@weekly"})
+		_, _ = instance.CreateResetSchedule(common.ResetSchedule{Counter: common.DefaultCounterName, Cron: "@weekly"})
+
+		assert.Nil(t, instance.DeleteResetSchedule(first.ID))
+		schedules, _ := instance.ListResetSchedules()
+		assert.Len(t, schedules, 2)
+
+		_, _ = instance.ResetCounter("visits", "admin")
+		assert.Nil(t, instance.DeleteCounter("visits"))
+		schedules, _ = instance.ListResetSchedules()
+		require.Len(t, schedules, 1)
+		assert.Equal(t, common.DefaultCounterName, schedules[0].Counter)
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		periods, _ := instance.GetCounterPeriods("visits", common.CounterHistoryQuery{})
+		assert.Empty(t, periods)
+	})
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const counterStatKeyPrefix = "counterstat:"
+
+// GetCounterStats returns the zero-filled series of the counter increments with the provided granularity,
+// for the buckets starting in [from, to)
+func (s *store) GetCounterStats(name string, granularity string, from time.Time, to time.Time) ([]common.CounterStat, error) {
+	size, err := common.BucketSize(granularity)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkCounterExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := common.BucketStart(from, granularity)
+	iter := s.db.NewIterator(&util.Range{
+		Start: s.counterStatKey(name, granularity, start),
+		Limit: s.counterStatKey(name, granularity, to),
+	}, nil)
+	defer iter.Release()
+
+	recorded := make(map[int64]uint64)
+	for iter.Next() {
+		key := iter.Key()
+		bucket := int64(binary.BigEndian.Uint64(key[len(key)-8:]))
+		recorded[bucket], err = decodeCounterValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]common.CounterStat, 0)
+	for bucket := start; bucket.Before(to); bucket = bucket.Add(size) {
+		stats = append(stats, common.CounterStat{
+			Start:      bucket,
+			Increments: recorded[bucket.Unix()],
+		})
+	}
+
+	return stats, nil
+}
+
+// PurgeCounterStats removes the statistics buckets that ended before their granularity retention
+// and returns how many were removed
+func (s *store) PurgeCounterStats(retention common.StatsRetention) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := s.key(counterStatKeyPrefix)
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) < len(prefix)+9 {
+			continue
+		}
+
+		// the key ends with <name>\x00<granularity>\x00<bucket start>
+		parts := bytes.Split(key[len(prefix):len(key)-9], []byte{0})
+		granularity := string(parts[len(parts)-1])
+		size, err := common.BucketSize(granularity)
+		if err != nil || retention[granularity] <= 0 {
+			continue
+		}
+
+		bucketEnd := time.Unix(int64(binary.BigEndian.Uint64(key[len(key)-8:])), 0).Add(size)
+		if bucketEnd.Add(retention[granularity]).Before(now) {
+			batch.Delete(append([]byte{}, key...))
+		}
+	}
+	err := iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// addCounterStats adds the increment to the buckets of all the granularities containing the timestamp.
+// The caller must hold the lock
+func (s *store) addCounterStats(batch *leveldb.Batch, name string, timestamp time.Time, increment uint64) error {
+	for _, granularity := range common.Granularities {
+		bucket, _ := common.BucketStart(timestamp, granularity)
+		key := s.counterStatKey(name, granularity, bucket)
+
+		data, err := s.get(key)
+		if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			return err
+		}
+		value := uint64(0)
+		if err == nil {
+			value, err = decodeCounterValue(data)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the statistics saturate instead of failing the increment
+		if value > math.MaxUint64-increment {
+			value = math.MaxUint64
+		} else {
+			value += increment
+		}
+		batch.Put(key, encodeCounterValue(value))
+	}
+
+	return nil
+}
+
+// deleteCounterStats adds the removal of all the counter statistics to the batch
+func (s *store) deleteCounterStats(batch *leveldb.Batch, name string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(counterStatKeyPrefix+name+"\x00")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+
+	return iter.Error()
+}
+
+// counterStatKey returns the key of the bucket. The bucket start is big endian so the buckets are iterated in order
+func (s *store) counterStatKey(name string, granularity string, bucket time.Time) []byte {
+	return append(s.key(counterStatKeyPrefix+name+"\x00"+granularity+"\x00"), encodeCounterValue(uint64(bucket.Unix()))...)
+}
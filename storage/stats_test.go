@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestStore_CounterStats(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should roll up the increments", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "alice")
+		_, _ = instance.IncrementCounter(common.DefaultCounterName, "bob")
+		// only the increments are counted
+		_, _ = instance.AddToCounter(common.DefaultCounterName, -2, "bob")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+
+		now := time.Now().UTC()
+		for _, granularity := range common.Granularities {
+			size, _ := common.BucketSize(granularity)
+			stats, err := instance.GetCounterStats(common.DefaultCounterName, granularity, now.Add(-2*size), now.Add(time.Second))
+			require.Nil(t, err)
+			require.Len(t, stats, 3)
+
+			total := uint64(0)
+			for _, stat := range stats {
+				total += stat.Increments
+			}
+			assert.Equal(t, uint64(6), total, granularity)
+			assert.Equal(t, uint64(6), stats[2].Increments+stats[1].Increments, granularity)
+		}
+	})
+	t.Run("should return a zero-filled series", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		from := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+		batch := new(leveldb.Batch)
+		require.Nil(t, instance.addCounterStats(batch, common.DefaultCounterName, from.Add(time.Hour), 3))
+		require.Nil(t, instance.db.Write(batch, nil))
+
+		stats, err := instance.GetCounterStats(common.DefaultCounterName, common.GranularityHour, from, from.Add(3*time.Hour))
+		require.Nil(t, err)
+		require.Len(t, stats, 4)
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), stats[0].Start)
+		assert.Equal(t, []uint64{0, 3, 0, 0}, []uint64{stats[0].Increments, stats[1].Increments, stats[2].Increments, stats[3].Increments})
+
+		stats, err = instance.GetCounterStats(common.DefaultCounterName, common.GranularityDay, from, from.Add(time.Hour))
+		require.Nil(t, err)
+		require.Len(t, stats, 1)
+		assert.Equal(t, uint64(3), stats[0].Increments)
+
+		_, err = instance.GetCounterStats(common.DefaultCounterName, "week", from, from.Add(time.Hour))
+		assert.ErrorIs(t, err, common.ErrInvalidGranularity)
+		_, err = instance.GetCounterStats("missing", common.GranularityDay, from, from.Add(time.Hour))
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should purge the buckets older than the retention", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		old := time.Now().Add(-72 * time.Hour)
+		batch := new(leveldb.Batch)
+		require.Nil(t, instance.addCounterStats(batch, common.DefaultCounterName, old, 1))
+		require.Nil(t, instance.db.Write(batch, nil))
+		_, _ = instance.IncrementCounter(common.DefaultCounterName, "alice")
+
+		removed, err := instance.PurgeCounterStats(common.DefaultStatsRetention())
+		require.Nil(t, err)
+		// only the old minute bucket is beyond its retention
+		assert.Equal(t, 1, removed)
+
+		stats, _ := instance.GetCounterStats(common.DefaultCounterName, common.GranularityHour, old, old.Add(time.Hour))
+		assert.Equal(t, uint64(1), stats[0].Increments)
+	})
+}
+
+func BenchmarkStore_AddToCounter(b *testing.B) {
+	instance, _ := NewStore(b.TempDir())
+	defer func() {
+		_ = instance.Close()
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
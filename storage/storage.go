@@ -1,86 +1,103 @@
 package storage
 
 import (
-	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"sync"
+	"time"
 
 	"FullStackApp01/common"
 
 	"github.com/syndtr/goleveldb/leveldb"
-	"golang.org/x/crypto/bcrypt"
 )
 
-const counterKey = "counter"
 const userKeyPrefix = "user:"
 
-// Store handles the persistence layer using LevelDB
+// PasswordHasher hashes the passwords of the new and updated users, common.PasswordHasher bounds the concurrent calls
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+}
+
+// Store handles the persistence layer using LevelDB.
+// A store instance is scoped to one tenant; all the tenant views share the same database and locks.
+// The user records have their own per-key locks, so the slow password hashing never holds back the counters
 type store struct {
-	db *leveldb.DB
-	mu sync.Mutex
+	db        *leveldb.DB
+	mu        *writeLock
+	userLocks *keyLocks
+	webhooks  *webhookIndex
+	// hasher bounds the concurrent bcrypt calls
+	hasher PasswordHasher
+	// dailyUnique keeps a unique visitors sketch per counter and day besides the all time one
+	dailyUnique bool
+	tenant      string
+	// prefix namespaces the keys of the tenant, it is empty for the default tenant
+	prefix string
 }
 
-// NewStore creates or opens a database at the given path
+// NewStore creates or opens a database at the given path. The returned store is scoped to the default tenant
 func NewStore(path string) (*store, error) {
-	db, err := leveldb.OpenFile(path, nil)
+	hasher, err := common.NewPasswordHasher(common.DefaultPasswordHasherConfig())
 	if err != nil {
 		return nil, err
 	}
-	return &store{db: db}, nil
-}
-
-// Close closes the underlying database
-func (s *store) Close() error {
-	return s.db.Close()
-}
 
-// GetCounter retrieves the current value of the counter
-func (s *store) GetCounter() (uint64, error) {
-	data, err := s.db.Get([]byte(counterKey), nil)
-	if errors.Is(err, leveldb.ErrNotFound) {
-		return 0, nil
-	}
+	db, err := leveldb.OpenFile(path, nil)
 	if err != nil {
-		return 0, err
-	}
-	if len(data) != 8 {
-		return 0, errors.New("invalid counter data")
+		return nil, err
 	}
-	return binary.BigEndian.Uint64(data), nil
+	return &store{
+		db:          db,
+		mu:          &writeLock{},
+		userLocks:   &keyLocks{},
+		webhooks:    &webhookIndex{tenants: make(map[string][]common.Webhook)},
+		hasher:      hasher,
+		dailyUnique: true,
+		tenant:      common.DefaultTenantID,
+	}, nil
 }
 
-// IncrementCounter increments the counter safely and returns the new value
-func (s *store) IncrementCounter() (uint64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	val, err := s.GetCounter()
-	if err != nil {
-		return 0, err
-	}
+// SetPasswordHasher replaces the pool hashing the passwords. The tenant views created afterward share it
+func (s *store) SetPasswordHasher(hasher PasswordHasher) {
+	s.hasher = hasher
+}
 
-	val++
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, val)
+// Close flushes the queued increments, if the group commit is enabled, and closes the underlying database
+func (s *store) Close() error {
+	s.mu.mu.Lock()
+	committer := s.mu.committer
+	s.mu.committer = nil
+	s.mu.mu.Unlock()
 
-	err = s.db.Put([]byte(counterKey), buf, nil)
-	if err != nil {
-		return 0, err
+	if committer != nil {
+		err := committer.close()
+		if err != nil {
+			_ = s.db.Close()
+			return err
+		}
 	}
-	return val, nil
+
+	return s.db.Close()
 }
 
 // ErrUserAlreadyExists is returned when trying to create a user that already exists
 var ErrUserAlreadyExists = errors.New("user already exists")
 
-// SaveUser creates or updates a user with a hashed password
+// SaveUser creates a user with a hashed password. The hashing happens before locking the user
 func (s *store) SaveUser(username, password, role string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.saveUser(username, password, role, false)
+}
+
+// RegisterUser creates a user like SaveUser and queues the user.registered webhook deliveries in the same write,
+// so the event can not be lost
+func (s *store) RegisterUser(username, password, role string) error {
+	return s.saveUser(username, password, role, true)
+}
+
+func (s *store) saveUser(username, password, role string, registered bool) error {
+	key := s.userKey(username)
 
-	// Check if user already exists
-	exists, err := s.db.Has([]byte(userKeyPrefix+username), nil)
+	// avoid the slow hashing when the user already exists
+	exists, err := s.db.Has(key, nil)
 	if err != nil {
 		return err
 	}
@@ -88,13 +105,30 @@ func (s *store) SaveUser(username, password, role string) error {
 		return ErrUserAlreadyExists
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if registered {
+		// the webhook delivery sequence is guarded by the write lock, which comes before the user lock
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	unlock := s.userLocks.lock(key)
+	defer unlock()
+
+	// the user might have been created while hashing
+	exists, err = s.db.Has(key, nil)
 	if err != nil {
 		return err
 	}
+	if exists {
+		return ErrUserAlreadyExists
+	}
 
 	user := common.User{
-		Username: username,
+		Username: common.DisplayUsername(username),
 		Role:     role,
 		Hash:     hash,
 	}
@@ -104,14 +138,27 @@ func (s *store) SaveUser(username, password, role string) error {
 		return err
 	}
 
-	return s.db.Put([]byte(userKeyPrefix+username), data, nil)
+	batch := new(leveldb.Batch)
+	batch.Put(key, data)
+	if registered {
+		_, err = s.stageWebhookDeliveries(batch, common.WebhookEvent{
+			Type:      common.WebhookEventUserRegistered,
+			Timestamp: time.Now().UTC(),
+			Username:  user.Username,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.db.Write(batch, nil)
 }
 
 // GetUser retrieves a user by username
 func (s *store) GetUser(username string) (*common.User, error) {
-	data, err := s.db.Get([]byte(userKeyPrefix+username), nil)
+	data, err := s.db.Get(s.userKey(username), nil)
 	if errors.Is(err, leveldb.ErrNotFound) {
-		return nil, errors.New("user not found")
+		return nil, common.ErrUserNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -125,15 +172,20 @@ func (s *store) GetUser(username string) (*common.User, error) {
 	return &user, nil
 }
 
-// UpdatePassword updates the password for an existing user
+// UpdatePassword updates the password for an existing user. The hashing happens before locking the user
 func (s *store) UpdatePassword(username, newPassword string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	key := s.userKey(username)
+	unlock := s.userLocks.lock(key)
+	defer unlock()
 
-	key := []byte(userKeyPrefix + username)
 	data, err := s.db.Get(key, nil)
 	if errors.Is(err, leveldb.ErrNotFound) {
-		return errors.New("user not found")
+		return common.ErrUserNotFound
 	}
 	if err != nil {
 		return err
@@ -145,11 +197,6 @@ func (s *store) UpdatePassword(username, newPassword string) error {
 		return err
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-
 	user.Hash = hash
 
 	newData, err := json.Marshal(user)
@@ -160,13 +207,12 @@ func (s *store) UpdatePassword(username, newPassword string) error {
 	return s.db.Put(key, newData, nil)
 }
 
-// ResetCounter resets the counter to 0
-func (s *store) ResetCounter() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, 0)
+// key returns the provided key in the tenant namespace
+func (s *store) key(key string) []byte {
+	return []byte(s.prefix + key)
+}
 
-	return s.db.Put([]byte(counterKey), buf, nil)
+// userKey returns the key under which the user is stored, built from the canonical form of the username
+func (s *store) userKey(username string) []byte {
+	return s.key(userKeyPrefix + common.CanonicalUsername(username))
 }
@@ -3,8 +3,13 @@ package storage
 import (
 	"sync"
 	"testing"
+	"time"
+
+	"FullStackApp01/common"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestNewStore(t *testing.T) {
@@ -42,7 +47,7 @@ func TestStore_GetCounter(t *testing.T) {
 		instance, _ := NewStore(testPath)
 		_ = instance.Close()
 
-		val, err := instance.GetCounter()
+		val, err := instance.GetCounter(common.DefaultCounterName)
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "leveldb: closed")
 		assert.Zero(t, val)
@@ -53,7 +58,7 @@ func TestStore_GetCounter(t *testing.T) {
 		instance, _ := NewStore(testPath)
 
 		_ = instance.db.Put([]byte(counterKey), []byte("this is not a valid uint64 data"), nil)
-		val, err := instance.GetCounter()
+		val, err := instance.GetCounter(common.DefaultCounterName)
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "invalid counter data")
 		assert.Zero(t, val)
@@ -65,7 +70,7 @@ func TestStore_GetCounter(t *testing.T) {
 
 		instance, _ := NewStore(testPath)
 
-		val, err := instance.GetCounter()
+		val, err := instance.GetCounter(common.DefaultCounterName)
 		assert.Nil(t, err)
 		assert.Zero(t, val)
 
@@ -125,7 +130,7 @@ func TestStore_IncrementCounter(t *testing.T) {
 		instance, _ := NewStore(testPath)
 		_ = instance.Close()
 
-		val, err := instance.IncrementCounter()
+		val, err := instance.IncrementCounter(common.DefaultCounterName, "")
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "leveldb: closed")
 		assert.Zero(t, val)
@@ -135,7 +140,7 @@ func TestStore_IncrementCounter(t *testing.T) {
 
 		instance, _ := NewStore(testPath)
 
-		val, err := instance.IncrementCounter()
+		val, err := instance.IncrementCounter(common.DefaultCounterName, "")
 		assert.Nil(t, err)
 		assert.Equal(t, uint64(1), val)
 
@@ -152,7 +157,7 @@ func TestStore_ResetCounter(t *testing.T) {
 		instance, _ := NewStore(testPath)
 		_ = instance.Close()
 
-		err := instance.ResetCounter()
+		_, err := instance.ResetCounter(common.DefaultCounterName, "")
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "leveldb: closed")
 	})
@@ -161,7 +166,7 @@ func TestStore_ResetCounter(t *testing.T) {
 
 		instance, _ := NewStore(testPath)
 
-		err := instance.ResetCounter()
+		_, err := instance.ResetCounter(common.DefaultCounterName, "")
 		assert.Nil(t, err)
 
 		_ = instance.Close()
@@ -177,12 +182,12 @@ func TestStore_Lifecycle(t *testing.T) {
 	instance, _ := NewStore(testPath)
 
 	// Test Initial GetCounter
-	val, err := instance.GetCounter()
+	val, err := instance.GetCounter(common.DefaultCounterName)
 	assert.Nil(t, err)
 	assert.Zero(t, val)
 
 	// Test IncrementCounter
-	newVal, err := instance.IncrementCounter()
+	newVal, err := instance.IncrementCounter(common.DefaultCounterName, "")
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(1), newVal)
 
@@ -193,15 +198,15 @@ func TestStore_Lifecycle(t *testing.T) {
 	instance, err = NewStore(testPath)
 	assert.Nil(t, err)
 
-	val, err = instance.GetCounter()
+	val, err = instance.GetCounter(common.DefaultCounterName)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(1), val)
 
 	// Test ResetCounter
-	err = instance.ResetCounter()
+	_, err = instance.ResetCounter(common.DefaultCounterName, "")
 	assert.Nil(t, err)
 
-	val, err = instance.GetCounter()
+	val, err = instance.GetCounter(common.DefaultCounterName)
 	assert.Nil(t, err)
 	assert.Zero(t, val)
 
@@ -220,14 +225,14 @@ func TestStore_Concurrency(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, err := instance.IncrementCounter()
+			_, err := instance.IncrementCounter(common.DefaultCounterName, "")
 			assert.Nil(t, err)
 		}()
 	}
 
 	wg.Wait()
 
-	val, err := instance.GetCounter()
+	val, err := instance.GetCounter(common.DefaultCounterName)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(iterations), val)
 
@@ -285,6 +290,39 @@ func TestStore_Users(t *testing.T) {
 		assert.Contains(t, err.Error(), "user already exists")
 	})
 
+	t.Run("should use the canonical username as key", func(t *testing.T) {
+		err := instance.SaveUser("CaseUser", "password123", "user")
+		assert.Nil(t, err)
+
+		user, err := instance.GetUser("caseuser")
+		assert.Nil(t, err)
+		assert.Equal(t, "CaseUser", user.Username)
+
+		err = instance.SaveUser("ＣＡＳＥＵＳＥＲ", "aaa", "user")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "user already exists")
+	})
+
+	t.Run("should hash with the configured pool", func(t *testing.T) {
+		instance2, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance2.Close()
+		}()
+		hasher, err := common.NewPasswordHasher(common.PasswordHasherConfig{Cost: bcrypt.MinCost, Workers: 1, Timeout: time.Second})
+		require.Nil(t, err)
+		instance2.SetPasswordHasher(hasher)
+
+		// the tenant views share the pool
+		for _, tenantStore := range []*store{instance2, instance2.ForTenant("acme")} {
+			require.Nil(t, tenantStore.SaveUser("alice", "password123", "user"))
+			stored, errGet := tenantStore.GetUser("alice")
+			require.Nil(t, errGet)
+			cost, _ := bcrypt.Cost(stored.Hash)
+			assert.Equal(t, bcrypt.MinCost, cost)
+			assert.Nil(t, hasher.Compare(stored.Hash, "password123"))
+		}
+	})
+
 	t.Run("duplication check error if db is closed", func(t *testing.T) {
 		instance2, _ := NewStore(t.TempDir())
 		_ = instance2.Close()
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const tenantKeyPrefix = "tenant:"
+const tenantNamespacePrefix = "t/"
+
+// ForTenant returns a view of the store scoped to the provided tenant. The view shares the database
+// with its parent so it must not be closed separately. The tenant existence is not checked
+func (s *store) ForTenant(tenantID string) *store {
+	if len(tenantID) == 0 || tenantID == common.DefaultTenantID {
+		return &store{
+			db:          s.db,
+			mu:          s.mu,
+			userLocks:   s.userLocks,
+			webhooks:    s.webhooks,
+			hasher:      s.hasher,
+			dailyUnique: s.dailyUnique,
+			tenant:      common.DefaultTenantID,
+		}
+	}
+
+	return &store{
+		db:          s.db,
+		mu:          s.mu,
+		userLocks:   s.userLocks,
+		webhooks:    s.webhooks,
+		hasher:      s.hasher,
+		dailyUnique: s.dailyUnique,
+		tenant:      tenantID,
+		prefix:      tenantNamespacePrefix + tenantID + "/",
+	}
+}
+
+// TenantID returns the tenant the store is scoped to
+func (s *store) TenantID() string {
+	return s.tenant
+}
+
+// CreateTenant registers a new tenant together with its first admin, in a single batch
+func (s *store) CreateTenant(tenantID string, name string, adminUsername string, adminPassword string) error {
+	if tenantID == common.DefaultTenantID {
+		return common.ErrTenantAlreadyExists
+	}
+
+	// the hashing is slow, do it before acquiring the lock
+	hash, err := s.hasher.Hash(adminPassword)
+	if err != nil {
+		return err
+	}
+
+	adminKey := s.ForTenant(tenantID).userKey(adminUsername)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock := s.userLocks.lock(adminKey)
+	defer unlock()
+
+	exists, err := s.db.Has(tenantKey(tenantID), nil)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return common.ErrTenantAlreadyExists
+	}
+
+	tenantData, err := json.Marshal(common.Tenant{
+		ID:        tenantID,
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	userData, err := json.Marshal(common.User{
+		Username: common.DisplayUsername(adminUsername),
+		Role:     "admin",
+		Hash:     hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(tenantKey(tenantID), tenantData)
+	batch.Put(adminKey, userData)
+
+	return s.db.Write(batch, nil)
+}
+
+// GetTenant retrieves a tenant by id. The default tenant always exists
+func (s *store) GetTenant(tenantID string) (*common.Tenant, error) {
+	if tenantID == common.DefaultTenantID {
+		return &common.Tenant{ID: common.DefaultTenantID, Name: common.DefaultTenantID}, nil
+	}
+
+	data, err := s.db.Get(tenantKey(tenantID), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, common.ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tenant common.Tenant
+	err = json.Unmarshal(data, &tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// ListTenants returns all the tenants, the default one first
+func (s *store) ListTenants() ([]common.Tenant, error) {
+	tenants := []common.Tenant{{ID: common.DefaultTenantID, Name: common.DefaultTenantID}}
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(tenantKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var tenant common.Tenant
+		err := json.Unmarshal(iter.Value(), &tenant)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, iter.Error()
+}
+
+// tenantKey returns the registry key of the tenant, it is not namespaced
+func tenantKey(tenantID string) []byte {
+	return []byte(tenantKeyPrefix + tenantID)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestStore_ForTenant(t *testing.T) {
+	t.Parallel()
+
+	instance, _ := NewStore(t.TempDir())
+	defer func() {
+		_ = instance.Close()
+	}()
+
+	assert.Equal(t, common.DefaultTenantID, instance.TenantID())
+	assert.Equal(t, common.DefaultTenantID, instance.ForTenant("").TenantID())
+	assert.Empty(t, instance.ForTenant(common.DefaultTenantID).prefix)
+
+	tenantA := instance.ForTenant("a")
+	tenantB := instance.ForTenant("b")
+	assert.Equal(t, "a", tenantA.TenantID())
+
+	_, _ = tenantA.IncrementCounter(common.DefaultCounterName, "")
+	_, _ = tenantA.IncrementCounter(common.DefaultCounterName, "")
+	_, _ = tenantB.IncrementCounter(common.DefaultCounterName, "")
+	_ = tenantA.SaveUser("alice", "pass", "user")
+
+	val, _ := instance.GetCounter(common.DefaultCounterName)
+	assert.Zero(t, val)
+	val, _ = tenantA.GetCounter(common.DefaultCounterName)
+	assert.Equal(t, uint64(2), val)
+	val, _ = tenantB.GetCounter(common.DefaultCounterName)
+	assert.Equal(t, uint64(1), val)
+
+	_, err := tenantB.GetUser("alice")
+	assert.Equal(t, common.ErrUserNotFound, err)
+	_, err = instance.GetUser("alice")
+	assert.Equal(t, common.ErrUserNotFound, err)
+
+	users, _ := instance.ListUsers()
+	assert.Empty(t, users)
+	users, _ = tenantA.ListUsers()
+	assert.Len(t, users, 1)
+}
+
+func TestStore_Tenants(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should error if the DB is closed", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		_ = instance.Close()
+
+		err := instance.CreateTenant("acme", "Acme", "boss", "pass")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "leveldb: closed")
+	})
+	t.Run("should create a tenant with its admin", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		tenant, err := instance.GetTenant("acme")
+		assert.Equal(t, common.ErrTenantNotFound, err)
+		assert.Nil(t, tenant)
+
+		err = instance.CreateTenant("acme", "Acme", "Boss", "pass")
+		assert.Nil(t, err)
+		err = instance.CreateTenant("acme", "Acme", "boss", "pass")
+		assert.Equal(t, common.ErrTenantAlreadyExists, err)
+		err = instance.CreateTenant(common.DefaultTenantID, "", "boss", "pass")
+		assert.Equal(t, common.ErrTenantAlreadyExists, err)
+
+		tenant, err = instance.GetTenant("acme")
+		assert.Nil(t, err)
+		assert.Equal(t, "Acme", tenant.Name)
+		assert.False(t, tenant.CreatedAt.IsZero())
+
+		admin, err := instance.ForTenant("acme").GetUser("boss")
+		assert.Nil(t, err)
+		assert.Equal(t, "Boss", admin.Username)
+		assert.Equal(t, "admin", admin.Role)
+		assert.Nil(t, bcrypt.CompareHashAndPassword(admin.Hash, []byte("pass")))
+
+		_, err = instance.GetUser("boss")
+		assert.Equal(t, common.ErrUserNotFound, err)
+
+		tenants, err := instance.ListTenants()
+		assert.Nil(t, err)
+		assert.Len(t, tenants, 2)
+		assert.Equal(t, common.DefaultTenantID, tenants[0].ID)
+		assert.Equal(t, "acme", tenants[1].ID)
+	})
+}
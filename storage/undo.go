@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const resetUndoKeyPrefix = "resetundo:"
+
+// GetResetUndo returns the value cleared by the last reset of the counter, if the reset happened within the window.
+// It returns ErrNothingToRestore otherwise
+func (s *store) GetResetUndo(name string, window time.Duration) (*common.ResetUndo, error) {
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readResetUndo(name, window, time.Now())
+}
+
+// RestoreCounter undoes the last reset of the counter on behalf of the user, if it happened within the window.
+// Without any change since the reset, the counter gets its prior value back. Otherwise the prior value is added
+// to the current one. The period archived by the reset is removed and the slot can only be restored once
+func (s *store) RestoreCounter(name string, username string, window time.Duration) (common.CounterChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	undo, err := s.readResetUndo(name, window, time.Now())
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	current, err := s.readCounterValue(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	seq, err := s.readCounterSeq(name)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	newValue := undo.Value
+	if seq != undo.Seq {
+		if current > math.MaxUint64-undo.Value {
+			return common.CounterChange{}, common.ErrCounterOverflow
+		}
+		newValue = current + undo.Value
+	}
+	err = info.CheckBounds(newValue)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	batch := new(leveldb.Batch)
+	change := common.CounterChange{Old: current, New: newValue}
+	event, err := s.stageCounterChange(batch, name, common.CounterOperationRestore, username, change)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+	change.Seq = event.Seq
+	batch.Delete(s.resetUndoKey(name))
+	batch.Delete(s.counterPeriodKey(name, undo.Seq))
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return common.CounterChange{}, err
+	}
+
+	return change, nil
+}
+
+// PurgeResetUndos removes the reset slots older than the window and returns how many were removed
+func (s *store) PurgeResetUndos(window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-window)
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(resetUndoKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var undo common.ResetUndo
+		err := json.Unmarshal(iter.Value(), &undo)
+		if err != nil || !undo.ResetAt.After(cutoff) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	err := iter.Error()
+	if err != nil || batch.Len() == 0 {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// stageResetUndo adds to the batch the slot keeping the value cleared by the reset event. A reset of a counter
+// already at 0 clears the slot, so an older reset can not be restored over it
+func (s *store) stageResetUndo(batch *leveldb.Batch, name string, event *common.CounterEvent) error {
+	if event.Old == 0 {
+		batch.Delete(s.resetUndoKey(name))
+		return nil
+	}
+
+	data, err := json.Marshal(common.ResetUndo{
+		Counter: name,
+		Value:   event.Old,
+		Seq:     event.Seq,
+		ResetBy: event.Username,
+		ResetAt: event.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	batch.Put(s.resetUndoKey(name), data)
+
+	return nil
+}
+
+func (s *store) readResetUndo(name string, window time.Duration, now time.Time) (*common.ResetUndo, error) {
+	data, err := s.db.Get(s.resetUndoKey(name), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, common.ErrNothingToRestore
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var undo common.ResetUndo
+	err = json.Unmarshal(data, &undo)
+	if err != nil {
+		return nil, err
+	}
+	undo.ExpiresAt = undo.ResetAt.Add(window)
+	if !undo.ExpiresAt.After(now) {
+		return nil, common.ErrNothingToRestore
+	}
+
+	return &undo, nil
+}
+
+func (s *store) resetUndoKey(name string) []byte {
+	return s.key(resetUndoKeyPrefix + name)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_ResetUndo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should restore the value when nothing changed since the reset", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 42, "alice")
+		_, err := instance.ResetCounter(common.DefaultCounterName, "admin")
+		require.Nil(t, err)
+
+		undo, err := instance.GetResetUndo(common.DefaultCounterName, time.Minute)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(42), undo.Value)
+		assert.Equal(t, uint64(2), undo.Seq)
+		assert.Equal(t, "admin", undo.ResetBy)
+		assert.Equal(t, undo.ResetAt.Add(time.Minute), undo.ExpiresAt)
+
+		change, err := instance.RestoreCounter(common.DefaultCounterName, "admin", time.Minute)
+		require.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 0, New: 42, Seq: 3}, change)
+		val, _ := instance.GetCounter(common.DefaultCounterName)
+		assert.Equal(t, uint64(42), val)
+
+		// the period closed by the reset is gone and the slot can only be used once
+		periods, _ := instance.GetCounterPeriods(common.DefaultCounterName, common.CounterHistoryQuery{})
+		assert.Empty(t, periods)
+		events, _ := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{})
+		require.Len(t, events, 3)
+		assert.Equal(t, common.CounterOperationRestore, events[2].Operation)
+		_, err = instance.RestoreCounter(common.DefaultCounterName, "admin", time.Minute)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+	})
+	t.Run("should add the value to the increments made since the reset", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.SaveUser("alice", "pass", "user")
+		_ = instance.SetRoleQuota("user", &common.Quota{Limit: 15, Period: common.GranularityDay})
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 10, "alice")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 3, "alice")
+
+		// the restore is not charged to the quota of the restoring user
+		change, err := instance.RestoreCounter(common.DefaultCounterName, "alice", time.Minute)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(3), change.Old)
+		assert.Equal(t, uint64(13), change.New)
+		status, _ := instance.GetQuotaStatus("alice")
+		assert.Equal(t, uint64(13), status.Used)
+	})
+	t.Run("should keep the checks of the counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		maxValue := uint64(10)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "bounded", Max: &maxValue})
+		_, _ = instance.AddToCounter("bounded", 8, "")
+		_, _ = instance.ResetCounter("bounded", "admin")
+		_, _ = instance.AddToCounter("bounded", 5, "")
+
+		_, err := instance.RestoreCounter("bounded", "admin", time.Minute)
+		assert.True(t, errors.Is(err, common.ErrCounterOutOfBounds))
+		val, _ := instance.GetCounter("bounded")
+		assert.Equal(t, uint64(5), val)
+
+		_, err = instance.RestoreCounter("missing", "admin", time.Minute)
+		assert.Equal(t, common.ErrCounterNotFound, err)
+		_, err = instance.GetResetUndo("missing", time.Minute)
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should expire the slot after the window", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		time.Sleep(5 * time.Millisecond)
+
+		_, err := instance.GetResetUndo(common.DefaultCounterName, time.Millisecond)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+		_, err = instance.RestoreCounter(common.DefaultCounterName, "admin", time.Millisecond)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+
+		removed, err := instance.PurgeResetUndos(time.Hour)
+		require.Nil(t, err)
+		assert.Zero(t, removed)
+		removed, err = instance.PurgeResetUndos(time.Millisecond)
+		require.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		_, err = instance.GetResetUndo(common.DefaultCounterName, time.Hour)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+	})
+	t.Run("a reset of a zero counter should not restore an older reset", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+		_, _ = instance.ResetCounter(common.DefaultCounterName, "admin")
+
+		_, err := instance.RestoreCounter(common.DefaultCounterName, "admin", time.Minute)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+	})
+	t.Run("a conditional reset should be restorable", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 5, "")
+		_, err := instance.CompareAndResetCounter(common.DefaultCounterName, 4, "admin")
+		assert.True(t, errors.Is(err, common.ErrCounterValueMismatch))
+		change, err := instance.CompareAndResetCounter(common.DefaultCounterName, 5, "admin")
+		require.Nil(t, err)
+		assert.Equal(t, common.CounterChange{Old: 5, New: 0, Seq: 2}, change)
+
+		events, _ := instance.GetCounterHistory(common.DefaultCounterName, common.CounterHistoryQuery{})
+		require.Len(t, events, 2)
+		assert.Equal(t, common.CounterOperationReset, events[1].Operation)
+		periods, _ := instance.GetCounterPeriods(common.DefaultCounterName, common.CounterHistoryQuery{})
+		assert.Len(t, periods, 1)
+
+		change, err = instance.RestoreCounter(common.DefaultCounterName, "admin", time.Minute)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(5), change.New)
+	})
+	t.Run("should be removed with the counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		_, _ = instance.AddToCounter("visits", 5, "")
+		_, _ = instance.ResetCounter("visits", "admin")
+		require.Nil(t, instance.DeleteCounter("visits"))
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+
+		_, err := instance.GetResetUndo("visits", time.Minute)
+		assert.Equal(t, common.ErrNothingToRestore, err)
+	})
+}
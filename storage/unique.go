@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const uniqueKeyPrefix = "unique:"
+
+// SetDailyUniqueVisitors sets if a unique visitors sketch is kept per counter and UTC day, besides the all
+// time one. The daily sketches give the day, week and month estimates. The tenant views created afterward share it
+func (s *store) SetDailyUniqueVisitors(enabled bool) {
+	s.dailyUnique = enabled
+}
+
+// GetUniqueCount returns the estimated number of distinct users and visitors that ever incremented the counter
+func (s *store) GetUniqueCount(name string) (uint64, error) {
+	err := s.checkCounterExists(name)
+	if err != nil {
+		return 0, err
+	}
+
+	sketch, err := s.readUniqueSketch(s.uniqueKey(name, common.PeriodAll))
+	if err != nil {
+		return 0, err
+	}
+
+	return sketch.Estimate(), nil
+}
+
+// GetUniqueVisitors returns the unique visitors estimates of the counter. With the daily sketches, the week
+// and month estimates of the periods containing the day merge the sketches of their days
+func (s *store) GetUniqueVisitors(name string, day time.Time) (*common.UniqueVisitors, error) {
+	all, err := s.GetUniqueCount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	visitors := &common.UniqueVisitors{
+		Counter: name,
+		All:     all,
+	}
+	if !s.dailyUnique {
+		return visitors, nil
+	}
+
+	visitors.Date = day.UTC().Format(time.DateOnly)
+	for _, period := range []string{common.PeriodDay, common.PeriodWeek, common.PeriodMonth} {
+		start, end, _ := common.PeriodDays(period, day)
+		sketch, err := s.mergeDailySketches(name, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		estimate := sketch.Estimate()
+		switch period {
+		case common.PeriodDay:
+			visitors.Day = &estimate
+		case common.PeriodWeek:
+			visitors.Week = &estimate
+		default:
+			visitors.Month = &estimate
+		}
+	}
+
+	return visitors, nil
+}
+
+// PurgeUniqueVisitors removes the daily sketches of the days that ended before the retention and returns how
+// many were removed. A retention of 0 keeps them forever
+func (s *store) PurgeUniqueVisitors(retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	prefix := s.key(uniqueKeyPrefix)
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		// the key ends with <counter>\x00day:<date> for the daily sketches
+		key := iter.Key()
+		separator := bytes.LastIndexByte(key, 0)
+		if separator < 0 {
+			continue
+		}
+		date, found := bytes.CutPrefix(key[separator+1:], []byte(common.PeriodDay+":"))
+		if !found {
+			continue
+		}
+
+		start, err := time.Parse(time.DateOnly, string(date))
+		if err == nil && start.AddDate(0, 0, 1).Before(cutoff) {
+			batch.Delete(append([]byte{}, key...))
+		}
+	}
+	err := iter.Error()
+	if err != nil || batch.Len() == 0 {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// stageUniqueVisitor adds the visitor to the all time sketch of the counter and, if kept, to the sketch of
+// the day. Only the sketches that changed are written. The caller must hold the lock
+func (s *store) stageUniqueVisitor(batch *leveldb.Batch, name string, visitor string, timestamp time.Time) error {
+	keys := [][]byte{s.uniqueKey(name, common.PeriodAll)}
+	if s.dailyUnique {
+		periodKey, _ := common.PeriodKey(common.PeriodDay, timestamp)
+		keys = append(keys, s.uniqueKey(name, periodKey))
+	}
+
+	for _, key := range keys {
+		sketch, err := s.readUniqueSketch(key)
+		if err != nil {
+			return err
+		}
+		if sketch.Add(visitor) {
+			batch.Put(key, sketch.Bytes())
+		}
+	}
+
+	return nil
+}
+
+// mergeDailySketches returns the union of the daily sketches of the days in [start, end)
+func (s *store) mergeDailySketches(name string, start time.Time, end time.Time) (*common.HyperLogLog, error) {
+	startKey, _ := common.PeriodKey(common.PeriodDay, start)
+	endKey, _ := common.PeriodKey(common.PeriodDay, end)
+	iter := s.db.NewIterator(&util.Range{
+		Start: s.uniqueKey(name, startKey),
+		Limit: s.uniqueKey(name, endKey),
+	}, nil)
+	defer iter.Release()
+
+	merged := common.NewHyperLogLog()
+	for iter.Next() {
+		sketch, err := common.DecodeHyperLogLog(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(sketch)
+	}
+
+	return merged, iter.Error()
+}
+
+// readUniqueSketch reads the sketch, including the one written by the queued increments. A missing sketch is empty
+func (s *store) readUniqueSketch(key []byte) (*common.HyperLogLog, error) {
+	data, err := s.get(key)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return common.NewHyperLogLog(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return common.DecodeHyperLogLog(data)
+}
+
+// deleteUniqueVisitors adds the removal of all the counter sketches to the batch
+func (s *store) deleteUniqueVisitors(batch *leveldb.Batch, name string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(uniqueKeyPrefix+name+"\x00")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+
+	return iter.Error()
+}
+
+// uniqueKey returns the key of the counter sketch of the period, see common.PeriodKey
+func (s *store) uniqueKey(name string, periodKey string) []byte {
+	return s.key(uniqueKeyPrefix + name + "\x00" + periodKey)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// stageVisitors writes the visitors to the sketches of the day
+func stageVisitors(t *testing.T, instance *store, name string, day time.Time, visitors ...string) {
+	batch := new(leveldb.Batch)
+	for _, visitor := range visitors {
+		require.Nil(t, instance.stageUniqueVisitor(batch, name, visitor, day))
+		require.Nil(t, instance.db.Write(batch, nil))
+		batch.Reset()
+	}
+}
+
+func TestStore_UniqueVisitors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should count the distinct users and visitors of the increments", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		for i := 0; i < 3; i++ {
+			_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+			_, _ = instance.AddToCounter(common.DefaultCounterName, 2, "Bob")
+			_, _ = instance.AddToCounterAsVisitor(common.DefaultCounterName, 1, "cookie-1")
+		}
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "bob")
+		// the decrements and the changes without a user or visitor are not counted
+		_, _ = instance.AddToCounter(common.DefaultCounterName, -1, "carol")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "")
+		_, _ = instance.AddToCounterAsVisitor(common.DefaultCounterName, 1, "")
+
+		unique, err := instance.GetUniqueCount(common.DefaultCounterName)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(3), unique)
+
+		visitors, err := instance.GetUniqueVisitors(common.DefaultCounterName, time.Now())
+		require.Nil(t, err)
+		assert.Equal(t, uint64(3), visitors.All)
+		assert.Equal(t, time.Now().UTC().Format(time.DateOnly), visitors.Date)
+		require.NotNil(t, visitors.Day)
+		assert.Equal(t, uint64(3), *visitors.Day)
+
+		_, err = instance.GetUniqueCount("missing")
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should merge the daily sketches into the week and the month", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		// Monday 2024-12-30 to Sunday 2025-01-05
+		stageVisitors(t, instance, common.DefaultCounterName, time.Date(2024, 12, 29, 12, 0, 0, 0, time.UTC), "user:alice", "user:zed")
+		stageVisitors(t, instance, common.DefaultCounterName, time.Date(2024, 12, 30, 12, 0, 0, 0, time.UTC), "user:alice", "user:bob")
+		stageVisitors(t, instance, common.DefaultCounterName, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), "user:bob", "user:carol")
+		stageVisitors(t, instance, common.DefaultCounterName, time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC), "user:dave")
+
+		visitors, err := instance.GetUniqueVisitors(common.DefaultCounterName, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC))
+		require.Nil(t, err)
+		assert.Equal(t, uint64(5), visitors.All)
+		assert.Equal(t, uint64(0), *visitors.Day)
+		assert.Equal(t, uint64(3), *visitors.Week)
+		assert.Equal(t, uint64(3), *visitors.Month)
+
+		visitors, err = instance.GetUniqueVisitors(common.DefaultCounterName, time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC))
+		require.Nil(t, err)
+		assert.Equal(t, uint64(1), *visitors.Week)
+		assert.Equal(t, uint64(3), *visitors.Month)
+	})
+	t.Run("should only keep the all time sketch when the daily ones are disabled", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		instance.SetDailyUniqueVisitors(false)
+
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+		visitors, err := instance.GetUniqueVisitors(common.DefaultCounterName, time.Now())
+		require.Nil(t, err)
+		assert.Equal(t, &common.UniqueVisitors{Counter: common.DefaultCounterName, All: 1}, visitors)
+	})
+	t.Run("should purge the old daily sketches and delete them with the counter", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		now := time.Now()
+		stageVisitors(t, instance, "visits", now.AddDate(0, 0, -10), "user:alice")
+		stageVisitors(t, instance, "visits", now, "user:bob")
+
+		removed, err := instance.PurgeUniqueVisitors(0)
+		require.Nil(t, err)
+		assert.Zero(t, removed)
+		removed, err = instance.PurgeUniqueVisitors(7 * 24 * time.Hour)
+		require.Nil(t, err)
+		assert.Equal(t, 1, removed)
+		unique, _ := instance.GetUniqueCount("visits")
+		assert.Equal(t, uint64(2), unique)
+
+		require.Nil(t, instance.DeleteCounter("visits"))
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+		unique, _ = instance.GetUniqueCount("visits")
+		assert.Zero(t, unique)
+	})
+	t.Run("should count the visitors of the queued increments", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		require.Nil(t, instance.EnableGroupCommit(GroupCommitConfig{Interval: time.Hour, Durability: DurabilityImmediate}))
+
+		for i := 0; i < 20; i++ {
+			_, err := instance.AddToCounter(common.DefaultCounterName, 1, fmt.Sprintf("user-%d", i%5))
+			require.Nil(t, err)
+		}
+
+		unique, err := instance.GetUniqueCount(common.DefaultCounterName)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(5), unique)
+	})
+}
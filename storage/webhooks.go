@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const webhookKeyPrefix = "webhook:"
+const webhookDeliverySeqKey = "webhookseq"
+const webhookDeliveryKeyPrefix = "webhookdelivery:"
+const webhookOutboxKeyPrefix = "webhookoutbox:"
+
+// webhookIndex keeps the webhook subscriptions of the tenants in memory, so the counter changes match them
+// without reading them from the database. A tenant is loaded on first use. It is guarded by the write lock
+type webhookIndex struct {
+	tenants map[string][]common.Webhook
+}
+
+// CreateWebhook validates and stores a new webhook subscription. The ID and the creation time are assigned here
+func (s *store) CreateWebhook(hook common.Webhook) (*common.Webhook, error) {
+	err := hook.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	buff := make([]byte, 8)
+	_, err = rand.Read(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	hook.ID = hex.EncodeToString(buff)
+	hook.CreatedAt = time.Now().UTC()
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.db.Put(s.webhookKey(hook.ID), data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks, loaded := s.webhooks.tenants[s.tenant]
+	if loaded {
+		// kept in the order of the keys, like when loaded
+		hooks = append(hooks, hook)
+		slices.SortFunc(hooks, func(a, b common.Webhook) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+		s.webhooks.tenants[s.tenant] = hooks
+	}
+
+	return &hook, nil
+}
+
+// GetWebhook retrieves the webhook subscription
+func (s *store) GetWebhook(id string) (*common.Webhook, error) {
+	data, err := s.db.Get(s.webhookKey(id), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, common.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hook common.Webhook
+	err = json.Unmarshal(data, &hook)
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// ListWebhooks returns all the webhook subscriptions
+func (s *store) ListWebhooks() ([]common.Webhook, error) {
+	hooks := make([]common.Webhook, 0)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(webhookKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var hook common.Webhook
+		err := json.Unmarshal(iter.Value(), &hook)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, iter.Error()
+}
+
+// DeleteWebhook removes the webhook subscription together with its delivery log and pending deliveries
+func (s *store) DeleteWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(s.webhookKey(id))
+
+	iter := s.db.NewIterator(util.BytesPrefix(s.webhookDeliveryPrefix(id)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var delivery common.WebhookDelivery
+		err = json.Unmarshal(iter.Value(), &delivery)
+		if err != nil {
+			return err
+		}
+		if delivery.NextAttempt != nil {
+			batch.Delete(s.webhookOutboxKey(*delivery.NextAttempt, id, delivery.ID))
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	err = iter.Error()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Write(batch, nil)
+	if err != nil {
+		return err
+	}
+
+	hooks, loaded := s.webhooks.tenants[s.tenant]
+	if loaded {
+		s.webhooks.tenants[s.tenant] = slices.DeleteFunc(hooks, func(hook common.Webhook) bool {
+			return hook.ID == id
+		})
+	}
+
+	return nil
+}
+
+// EnqueueWebhookEvent queues a delivery of the event for every matching webhook and returns how many were queued.
+// The counter changes are queued by the counter operations themselves, in the same batch as the change
+func (s *store) EnqueueWebhookEvent(event common.WebhookEvent) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	queued, err := s.stageWebhookDeliveries(batch, event)
+	if err != nil || queued == 0 {
+		return 0, err
+	}
+
+	return queued, s.db.Write(batch, nil)
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, oldest first. The cursor is the ID of the
+// last delivery returned
+func (s *store) GetWebhookDeliveries(id string, after string, limit int) ([]common.WebhookDelivery, error) {
+	_, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := s.webhookDeliveryPrefix(id)
+	if len(after) > 0 {
+		// the first key after the cursor
+		start = append(s.webhookDeliveryKey(id, after), 0)
+	}
+	iter := s.db.NewIterator(&util.Range{
+		Start: start,
+		Limit: util.BytesPrefix(s.webhookDeliveryPrefix(id)).Limit,
+	}, nil)
+	defer iter.Release()
+
+	deliveries := make([]common.WebhookDelivery, 0)
+	for iter.Next() {
+		var delivery common.WebhookDelivery
+		err = json.Unmarshal(iter.Value(), &delivery)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+		if limit > 0 && len(deliveries) >= limit {
+			break
+		}
+	}
+
+	return deliveries, iter.Error()
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next attempt is due at now, the oldest due first
+func (s *store) DueWebhookDeliveries(now time.Time, limit int) ([]common.WebhookDelivery, error) {
+	prefix := s.key(webhookOutboxKeyPrefix)
+	iter := s.db.NewIterator(&util.Range{
+		Start: prefix,
+		Limit: append(append([]byte{}, prefix...), encodeCounterValue(uint64(now.UnixNano())+1)...),
+	}, nil)
+	defer iter.Release()
+
+	deliveries := make([]common.WebhookDelivery, 0)
+	for iter.Next() {
+		hookID, deliveryID, err := parseWebhookOutboxKey(iter.Key()[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+
+		delivery, err := s.readWebhookDelivery(hookID, deliveryID)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, *delivery)
+		if limit > 0 && len(deliveries) >= limit {
+			break
+		}
+	}
+
+	return deliveries, iter.Error()
+}
+
+// CompleteWebhookAttempt records the delivery attempt. A successful attempt marks the delivery as delivered,
+// a failed one schedules the next attempt at retryAt or, if retryAt is zero, marks the delivery as failed
+func (s *store) CompleteWebhookAttempt(hookID string, deliveryID string, attempt common.WebhookAttempt, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, err := s.readWebhookDelivery(hookID, deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != common.WebhookDeliveryPending {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	if delivery.NextAttempt != nil {
+		batch.Delete(s.webhookOutboxKey(*delivery.NextAttempt, hookID, deliveryID))
+	}
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.NextAttempt = nil
+	switch {
+	case attempt.Succeeded():
+		delivery.Status = common.WebhookDeliveryDelivered
+	case retryAt.IsZero():
+		delivery.Status = common.WebhookDeliveryFailed
+	default:
+		retryAt = retryAt.UTC()
+		delivery.NextAttempt = &retryAt
+		batch.Put(s.webhookOutboxKey(retryAt, hookID, deliveryID), nil)
+	}
+
+	err = s.putWebhookDelivery(batch, delivery)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Write(batch, nil)
+}
+
+// PurgeWebhookDeliveries removes the delivered and failed deliveries older than the retention and returns how many were removed
+func (s *store) PurgeWebhookDeliveries(retention time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(webhookDeliveryKeyPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var delivery common.WebhookDelivery
+		err := json.Unmarshal(iter.Value(), &delivery)
+		if err != nil {
+			return 0, err
+		}
+		if delivery.Status != common.WebhookDeliveryPending && delivery.CreatedAt.Before(cutoff) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	err := iter.Error()
+	if err != nil || batch.Len() == 0 {
+		return 0, err
+	}
+
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// stageWebhookDeliveries adds to the batch a pending delivery, due immediately, of every event matching
+// a webhook and returns how many were added. The caller must hold the lock
+func (s *store) stageWebhookDeliveries(batch *leveldb.Batch, event common.WebhookEvent) (int, error) {
+	hooks, err := s.webhookSubscriptions()
+	if err != nil || len(hooks) == 0 {
+		return 0, err
+	}
+
+	seq, err := s.readWebhookDeliverySeq()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	now := time.Now().UTC()
+	for _, hook := range hooks {
+		for _, match := range hook.Match(event) {
+			seq++
+			nextAttempt := now
+			delivery := &common.WebhookDelivery{
+				// zero padded, the deliveries are listed in order
+				ID:          fmt.Sprintf("%016x", seq),
+				WebhookID:   hook.ID,
+				Event:       match,
+				Status:      common.WebhookDeliveryPending,
+				Attempts:    make([]common.WebhookAttempt, 0),
+				NextAttempt: &nextAttempt,
+				CreatedAt:   now,
+			}
+			err = s.putWebhookDelivery(batch, delivery)
+			if err != nil {
+				return 0, err
+			}
+			batch.Put(s.webhookOutboxKey(nextAttempt, hook.ID, delivery.ID), nil)
+			queued++
+		}
+	}
+	if queued > 0 {
+		batch.Put(s.key(webhookDeliverySeqKey), encodeCounterValue(seq))
+	}
+
+	return queued, nil
+}
+
+// webhookSubscriptions returns the webhooks of the tenant from the index, loading them on first use.
+// The caller must hold the lock
+func (s *store) webhookSubscriptions() ([]common.Webhook, error) {
+	hooks, loaded := s.webhooks.tenants[s.tenant]
+	if loaded {
+		return hooks, nil
+	}
+
+	hooks, err := s.ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	s.webhooks.tenants[s.tenant] = hooks
+
+	return hooks, nil
+}
+
+// stageCounterWebhooks adds to the batch the deliveries raised by the counter change event. The increments and
+// the resets are events on their own, all the changes may cross the thresholds. The caller must hold the lock
+func (s *store) stageCounterWebhooks(batch *leveldb.Batch, name string, event *common.CounterEvent) error {
+	webhookEvent := common.WebhookEvent{
+		Timestamp: event.Timestamp,
+		Counter:   name,
+		Username:  event.Username,
+		Change:    &common.CounterChange{Old: event.Old, New: event.New, Seq: event.Seq},
+	}
+	switch {
+	case event.Operation == common.CounterOperationReset:
+		webhookEvent.Type = common.WebhookEventCounterReset
+	case event.Operation == common.CounterOperationAdd && event.New > event.Old:
+		webhookEvent.Type = common.WebhookEventCounterIncremented
+	}
+
+	_, err := s.stageWebhookDeliveries(batch, webhookEvent)
+	return err
+}
+
+func (s *store) readWebhookDelivery(hookID string, deliveryID string) (*common.WebhookDelivery, error) {
+	data, err := s.db.Get(s.webhookDeliveryKey(hookID, deliveryID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery common.WebhookDelivery
+	err = json.Unmarshal(data, &delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *store) putWebhookDelivery(batch *leveldb.Batch, delivery *common.WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	batch.Put(s.webhookDeliveryKey(delivery.WebhookID, delivery.ID), data)
+
+	return nil
+}
+
+func (s *store) readWebhookDeliverySeq() (uint64, error) {
+	data, err := s.get(s.key(webhookDeliverySeqKey))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounterValue(data)
+}
+
+func (s *store) webhookKey(id string) []byte {
+	return s.key(webhookKeyPrefix + id)
+}
+
+func (s *store) webhookDeliveryPrefix(hookID string) []byte {
+	return s.key(webhookDeliveryKeyPrefix + hookID + "\x00")
+}
+
+func (s *store) webhookDeliveryKey(hookID string, deliveryID string) []byte {
+	return append(s.webhookDeliveryPrefix(hookID), deliveryID...)
+}
+
+// webhookOutboxKey returns the key of a pending delivery in the outbox. The due time comes first, big endian,
+// so the outbox is iterated in due order
+func (s *store) webhookOutboxKey(due time.Time, hookID string, deliveryID string) []byte {
+	key := append(s.key(webhookOutboxKeyPrefix), encodeCounterValue(uint64(due.UnixNano()))...)
+	return append(key, hookID+"\x00"+deliveryID...)
+}
+
+// parseWebhookOutboxKey returns the webhook and the delivery IDs from an outbox key without its prefix
+func parseWebhookOutboxKey(key []byte) (string, string, error) {
+	if len(key) < 8 {
+		return "", "", errors.New("invalid webhook outbox key")
+	}
+
+	ids := bytes.SplitN(key[8:], []byte{0}, 2)
+	if len(ids) != 2 {
+		return "", "", errors.New("invalid webhook outbox key")
+	}
+
+	return string(ids[0]), string(ids[1]), nil
+}
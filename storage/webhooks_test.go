@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Webhooks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should manage the subscriptions", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		_, err := instance.CreateWebhook(common.Webhook{URL: "not a url", Events: []string{common.WebhookEventUserRegistered}})
+		assert.True(t, errors.Is(err, common.ErrInvalidWebhook))
+
+		hook, err := instance.CreateWebhook(common.Webhook{URL: "http://localhost/hook", Events: []string{common.WebhookEventUserRegistered}, Secret: "s"})
+		require.Nil(t, err)
+		assert.NotEmpty(t, hook.ID)
+
+		stored, err := instance.GetWebhook(hook.ID)
+		require.Nil(t, err)
+		assert.Equal(t, hook, stored)
+
+		hooks, err := instance.ListWebhooks()
+		require.Nil(t, err)
+		assert.Len(t, hooks, 1)
+
+		assert.Nil(t, instance.DeleteWebhook(hook.ID))
+		assert.Equal(t, common.ErrWebhookNotFound, instance.DeleteWebhook(hook.ID))
+		_, err = instance.GetWebhookDeliveries(hook.ID, "", 0)
+		assert.Equal(t, common.ErrWebhookNotFound, err)
+	})
+	t.Run("should queue the counter events with the change", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		increments, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/a", Events: []string{common.WebhookEventCounterIncremented}, Counter: "visits"})
+		thresholds, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/b", Events: []string{common.WebhookEventCounterReset, common.WebhookEventCounterThreshold}, Thresholds: []uint64{10}})
+		_ = instance.CreateCounter(common.CounterInfo{Name: "visits"})
+
+		_, _ = instance.AddToCounter("visits", 6, "alice")
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+		_, _ = instance.AddToCounter("visits", 6, "alice")
+		_, _ = instance.ResetCounter("visits", "admin")
+
+		deliveries, err := instance.GetWebhookDeliveries(increments.ID, "", 0)
+		require.Nil(t, err)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, common.WebhookEventCounterIncremented, deliveries[0].Event.Type)
+		assert.Equal(t, "alice", deliveries[0].Event.Username)
+		assert.Equal(t, uint64(6), deliveries[0].Event.Change.New)
+		assert.Equal(t, common.WebhookDeliveryPending, deliveries[0].Status)
+
+		deliveries, err = instance.GetWebhookDeliveries(thresholds.ID, "", 0)
+		require.Nil(t, err)
+		require.Len(t, deliveries, 3)
+		assert.Equal(t, common.WebhookEventCounterThreshold, deliveries[0].Event.Type)
+		assert.Equal(t, common.ThresholdUp, deliveries[0].Event.Direction)
+		assert.Equal(t, common.WebhookEventCounterReset, deliveries[1].Event.Type)
+		assert.Equal(t, common.ThresholdDown, deliveries[2].Event.Direction)
+
+		page, err := instance.GetWebhookDeliveries(thresholds.ID, deliveries[0].ID, 1)
+		require.Nil(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, deliveries[1].ID, page[0].ID)
+
+		due, err := instance.DueWebhookDeliveries(time.Now(), 0)
+		require.Nil(t, err)
+		assert.Len(t, due, 5)
+		due, err = instance.DueWebhookDeliveries(time.Now(), 2)
+		require.Nil(t, err)
+		assert.Len(t, due, 2)
+	})
+	t.Run("should queue the user registration with the user", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		hook, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/a", Events: []string{common.WebhookEventUserRegistered}})
+		err := instance.RegisterUser("Bob", "pass", "user")
+		require.Nil(t, err)
+		err = instance.SaveUser("carol", "pass", "user")
+		require.Nil(t, err)
+
+		deliveries, _ := instance.GetWebhookDeliveries(hook.ID, "", 0)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, common.WebhookEventUserRegistered, deliveries[0].Event.Type)
+		assert.Equal(t, "Bob", deliveries[0].Event.Username)
+
+		// nothing is queued when the user already exists
+		err = instance.RegisterUser("bob", "pass", "user")
+		assert.Equal(t, ErrUserAlreadyExists, err)
+		deliveries, _ = instance.GetWebhookDeliveries(hook.ID, "", 0)
+		assert.Len(t, deliveries, 1)
+	})
+	t.Run("should keep the subscriptions index up to date", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		acme := instance.ForTenant("acme")
+
+		// the first change loads the empty index
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+
+		hook, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/a", Events: []string{common.WebhookEventCounterIncremented}})
+		other, _ := acme.CreateWebhook(common.Webhook{URL: "http://localhost/b", Events: []string{common.WebhookEventCounterIncremented}})
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+
+		deliveries, _ := instance.GetWebhookDeliveries(hook.ID, "", 0)
+		assert.Len(t, deliveries, 1)
+		deliveries, _ = acme.GetWebhookDeliveries(other.ID, "", 0)
+		assert.Len(t, deliveries, 0)
+
+		require.Nil(t, instance.DeleteWebhook(hook.ID))
+		_, _ = instance.AddToCounter(common.DefaultCounterName, 1, "alice")
+		_, _ = acme.AddToCounter(common.DefaultCounterName, 1, "alice")
+
+		due, err := instance.DueWebhookDeliveries(time.Now(), 0)
+		require.Nil(t, err)
+		assert.Len(t, due, 0)
+		deliveries, _ = acme.GetWebhookDeliveries(other.ID, "", 0)
+		assert.Len(t, deliveries, 1)
+	})
+	t.Run("should retry the failed attempts from the outbox", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		hook, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/a", Events: []string{common.WebhookEventUserRegistered}})
+		queued, err := instance.EnqueueWebhookEvent(common.WebhookEvent{Type: common.WebhookEventUserRegistered, Username: "bob"})
+		require.Nil(t, err)
+		assert.Equal(t, 1, queued)
+		queued, _ = instance.EnqueueWebhookEvent(common.WebhookEvent{Type: common.WebhookEventCounterReset})
+		assert.Zero(t, queued)
+
+		now := time.Now()
+		due, _ := instance.DueWebhookDeliveries(now, 0)
+		require.Len(t, due, 1)
+		delivery := due[0]
+
+		retryAt := now.Add(time.Minute)
+		err = instance.CompleteWebhookAttempt(hook.ID, delivery.ID, common.WebhookAttempt{Timestamp: now, StatusCode: 500}, retryAt)
+		require.Nil(t, err)
+		due, _ = instance.DueWebhookDeliveries(now, 0)
+		assert.Empty(t, due)
+		due, _ = instance.DueWebhookDeliveries(retryAt, 0)
+		require.Len(t, due, 1)
+		assert.Len(t, due[0].Attempts, 1)
+		assert.Equal(t, common.WebhookDeliveryPending, due[0].Status)
+
+		err = instance.CompleteWebhookAttempt(hook.ID, delivery.ID, common.WebhookAttempt{Timestamp: retryAt, StatusCode: 204}, time.Time{})
+		require.Nil(t, err)
+		due, _ = instance.DueWebhookDeliveries(retryAt.Add(time.Hour), 0)
+		assert.Empty(t, due)
+
+		deliveries, _ := instance.GetWebhookDeliveries(hook.ID, "", 0)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, common.WebhookDeliveryDelivered, deliveries[0].Status)
+		assert.Nil(t, deliveries[0].NextAttempt)
+		assert.Len(t, deliveries[0].Attempts, 2)
+
+		removed, err := instance.PurgeWebhookDeliveries(time.Hour)
+		require.Nil(t, err)
+		assert.Zero(t, removed)
+		removed, err = instance.PurgeWebhookDeliveries(0)
+		require.Nil(t, err)
+		assert.Equal(t, 1, removed)
+	})
+	t.Run("should give up when no retry is scheduled", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		hook, _ := instance.CreateWebhook(common.Webhook{URL: "http://localhost/a", Events: []string{common.WebhookEventUserRegistered}})
+		_, _ = instance.EnqueueWebhookEvent(common.WebhookEvent{Type: common.WebhookEventUserRegistered, Username: "bob"})
+		due, _ := instance.DueWebhookDeliveries(time.Now(), 0)
+		require.Len(t, due, 1)
+
+		err := instance.CompleteWebhookAttempt(hook.ID, due[0].ID, common.WebhookAttempt{Timestamp: time.Now(), Error: "connection refused"}, time.Time{})
+		require.Nil(t, err)
+		deliveries, _ := instance.GetWebhookDeliveries(hook.ID, "", 0)
+		assert.Equal(t, common.WebhookDeliveryFailed, deliveries[0].Status)
+
+		_, _ = instance.EnqueueWebhookEvent(common.WebhookEvent{Type: common.WebhookEventUserRegistered, Username: "carol"})
+		assert.Nil(t, instance.DeleteWebhook(hook.ID))
+		due, _ = instance.DueWebhookDeliveries(time.Now(), 0)
+		assert.Empty(t, due)
+	})
+}
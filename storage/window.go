@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const windowKeyPrefix = "window:"
+
+// GetCounterRate returns the increments of the sliding window counter over the window ending at now. The window
+// is rounded up to whole buckets and can not exceed the maximum window of the counter
+func (s *store) GetCounterRate(name string, window time.Duration, now time.Time) (*common.CounterRate, error) {
+	info, err := s.readCounterMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Window == nil {
+		return nil, fmt.Errorf("%w: %s is not a sliding window counter", common.ErrInvalidWindow, name)
+	}
+	resolution, maxWindow, err := info.Window.Durations()
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 || window > maxWindow {
+		return nil, fmt.Errorf("%w: the window must be positive and at most %s", common.ErrInvalidWindow, maxWindow)
+	}
+
+	buckets := int64((window + resolution - 1) / resolution)
+	current := now.Unix() / int64(resolution/time.Second)
+	rate := &common.CounterRate{
+		Counter: name,
+		Window:  (time.Duration(buckets) * resolution).String(),
+		From:    bucketTime(current-buckets+1, resolution),
+		To:      bucketTime(current+1, resolution),
+	}
+	for bucket := current - buckets + 1; bucket <= current; bucket++ {
+		increments, err := s.readWindowBucket(name, bucket, resolution, maxWindow)
+		if err != nil {
+			return nil, err
+		}
+		rate.Increments = addSaturated(rate.Increments, increments)
+	}
+
+	return rate, nil
+}
+
+// stageWindowIncrement adds the increment to the ring bucket of the timestamp. A slot still holding an older
+// bucket is reused from 0. The caller must hold the lock
+func (s *store) stageWindowIncrement(batch *leveldb.Batch, info *common.CounterInfo, timestamp time.Time, increment uint64) error {
+	resolution, maxWindow, err := info.Window.Durations()
+	if err != nil {
+		return err
+	}
+
+	bucket := timestamp.Unix() / int64(resolution/time.Second)
+	increments, err := s.readWindowBucket(info.Name, bucket, resolution, maxWindow)
+	if err != nil {
+		return err
+	}
+
+	value := append(encodeCounterValue(uint64(bucket)), encodeCounterValue(addSaturated(increments, increment))...)
+	batch.Put(s.windowSlotKey(info.Name, bucket, resolution, maxWindow), value)
+
+	return nil
+}
+
+// readWindowBucket returns the increments of the bucket, 0 if its ring slot was not written since the bucket started.
+// The slot holds the bucket number followed by its increments
+func (s *store) readWindowBucket(name string, bucket int64, resolution time.Duration, maxWindow time.Duration) (uint64, error) {
+	data, err := s.get(s.windowSlotKey(name, bucket, resolution, maxWindow))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 16 {
+		return 0, fmt.Errorf("invalid sliding window slot of counter %s", name)
+	}
+
+	slotBucket, _ := decodeCounterValue(data[:8])
+	if int64(slotBucket) != bucket {
+		return 0, nil
+	}
+
+	return decodeCounterValue(data[8:])
+}
+
+// deleteCounterWindow adds the removal of the ring slots of the counter to the batch
+func (s *store) deleteCounterWindow(batch *leveldb.Batch, name string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.key(windowKeyPrefix+name+"\x00")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+
+	return iter.Error()
+}
+
+// windowSlotKey returns the key of the ring slot holding the bucket
+func (s *store) windowSlotKey(name string, bucket int64, resolution time.Duration, maxWindow time.Duration) []byte {
+	slot := uint64(bucket) % uint64(maxWindow/resolution)
+	return append(s.key(windowKeyPrefix+name+"\x00"), encodeCounterValue(slot)...)
+}
+
+func bucketTime(bucket int64, resolution time.Duration) time.Time {
+	return time.Unix(bucket*int64(resolution/time.Second), 0).UTC()
+}
+
+func addSaturated(value uint64, increment uint64) uint64 {
+	if value > math.MaxUint64-increment {
+		return math.MaxUint64
+	}
+
+	return value + increment
+}
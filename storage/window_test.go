@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// stageIncrement writes the increment to the ring bucket of the timestamp
+func stageIncrement(t *testing.T, instance *store, name string, timestamp time.Time, increment uint64) {
+	info, err := instance.readCounterMeta(name)
+	require.Nil(t, err)
+
+	batch := new(leveldb.Batch)
+	require.Nil(t, instance.stageWindowIncrement(batch, info, timestamp, increment))
+	require.Nil(t, instance.db.Write(batch, nil))
+}
+
+func TestStore_SlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should validate the window", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+
+		for _, window := range []common.SlidingWindow{
+			{Resolution: "500ms", MaxWindow: "1m"},
+			{Resolution: "10s", MaxWindow: "15s"},
+			{Resolution: "1s", MaxWindow: "2h"},
+			{Resolution: "soon", MaxWindow: "1h"},
+		} {
+			err := instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &window})
+			assert.True(t, errors.Is(err, common.ErrInvalidWindow), "%+v", window)
+		}
+
+		require.Nil(t, instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &common.SlidingWindow{Resolution: "10s", MaxWindow: "1h"}}))
+		_, err := instance.GetCounterRate("rate", 2*time.Hour, time.Now())
+		assert.True(t, errors.Is(err, common.ErrInvalidWindow))
+		_, err = instance.GetCounterRate(common.DefaultCounterName, time.Minute, time.Now())
+		assert.True(t, errors.Is(err, common.ErrInvalidWindow))
+		_, err = instance.GetCounterRate("missing", time.Minute, time.Now())
+		assert.Equal(t, common.ErrCounterNotFound, err)
+	})
+	t.Run("should count the increments of the window", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		_ = instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &common.SlidingWindow{Resolution: "1m", MaxWindow: "1h"}})
+
+		_, _ = instance.AddToCounter("rate", 5, "alice")
+		_, _ = instance.AddToCounter("rate", -2, "alice")
+		_, _ = instance.IncrementCounter("rate", "")
+
+		// two buckets, in case the increments crossed into a new minute
+		rate, err := instance.GetCounterRate("rate", 2*time.Minute, time.Now())
+		require.Nil(t, err)
+		assert.Equal(t, uint64(6), rate.Increments)
+		assert.Equal(t, "2m0s", rate.Window)
+		assert.Equal(t, 2*time.Minute, rate.To.Sub(rate.From))
+	})
+	t.Run("should slide over the ring buckets", func(t *testing.T) {
+		instance, _ := NewStore(t.TempDir())
+		defer func() {
+			_ = instance.Close()
+		}()
+		_ = instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &common.SlidingWindow{Resolution: "10s", MaxWindow: "1m"}})
+
+		now := time.Date(2025, 3, 1, 12, 0, 35, 0, time.UTC)
+		stageIncrement(t, instance, "rate", now.Add(-2*time.Minute), 100)
+		stageIncrement(t, instance, "rate", now.Add(-50*time.Second), 1)
+		stageIncrement(t, instance, "rate", now.Add(-20*time.Second), 2)
+		stageIncrement(t, instance, "rate", now.Add(-20*time.Second), 3)
+		stageIncrement(t, instance, "rate", now, 4)
+
+		rate, err := instance.GetCounterRate("rate", 25*time.Second, now)
+		require.Nil(t, err)
+		// the window is rounded up to 3 buckets, from 12:00:10 to 12:00:40
+		assert.Equal(t, "30s", rate.Window)
+		assert.Equal(t, time.Date(2025, 3, 1, 12, 0, 10, 0, time.UTC), rate.From)
+		assert.Equal(t, time.Date(2025, 3, 1, 12, 0, 40, 0, time.UTC), rate.To)
+		assert.Equal(t, uint64(9), rate.Increments)
+
+		// the slot of the increment made 2 minutes ago was not reused, but it is too old
+		rate, _ = instance.GetCounterRate("rate", time.Minute, now)
+		assert.Equal(t, uint64(10), rate.Increments)
+
+		// the reused slot starts over
+		stageIncrement(t, instance, "rate", now.Add(time.Minute), 7)
+		rate, _ = instance.GetCounterRate("rate", time.Minute, now.Add(time.Minute))
+		assert.Equal(t, uint64(7), rate.Increments)
+	})
+	t.Run("should keep the buckets across restarts and delete them with the counter", func(t *testing.T) {
+		dir := t.TempDir()
+		instance, _ := NewStore(dir)
+		_ = instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &common.SlidingWindow{Resolution: "1m", MaxWindow: "1h"}})
+		_, _ = instance.AddToCounter("rate", 3, "")
+		require.Nil(t, instance.Close())
+
+		instance, _ = NewStore(dir)
+		defer func() {
+			_ = instance.Close()
+		}()
+		rate, err := instance.GetCounterRate("rate", time.Hour, time.Now())
+		require.Nil(t, err)
+		assert.Equal(t, uint64(3), rate.Increments)
+
+		require.Nil(t, instance.DeleteCounter("rate"))
+		_ = instance.CreateCounter(common.CounterInfo{Name: "rate", Window: &common.SlidingWindow{Resolution: "1m", MaxWindow: "1h"}})
+		rate, _ = instance.GetCounterRate("rate", time.Hour, time.Now())
+		assert.Zero(t, rate.Increments)
+	})
+}
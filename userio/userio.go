@@ -0,0 +1,245 @@
+package userio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"FullStackApp01/common"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// FormatCSV is the comma separated values format. The first row is the header
+	FormatCSV = "csv"
+	// FormatJSONLines is the JSON Lines format, one JSON object per line
+	FormatJSONLines = "jsonl"
+
+	maxPassLength = 72
+)
+
+var csvHeader = []string{"username", "role", "password", "hash"}
+
+// Record is a user entry of an import or export file. Exactly one of Password or Hash is expected on import
+type Record struct {
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	Password string `json:"password,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// FormatFromPath guesses the file format from the file extension
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONLines, nil
+	default:
+		return "", fmt.Errorf("can not guess the format of %s, please specify it", path)
+	}
+}
+
+// ReadRecords parses all the records from the reader
+func ReadRecords(r io.Reader, format string) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatJSONLines:
+		return readJSONLines(r)
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return make([]Record, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, ok := columns["username"]
+	if !ok {
+		return nil, errors.New("missing the username column in the CSV header")
+	}
+
+	field := func(row []string, name string) string {
+		idx, found := columns[name]
+		if !found || idx >= len(row) {
+			return ""
+		}
+		return row[idx]
+	}
+
+	records := make([]Record, 0)
+	for {
+		row, errRead := reader.Read()
+		if errors.Is(errRead, io.EOF) {
+			return records, nil
+		}
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		records = append(records, Record{
+			Username: field(row, "username"),
+			Role:     field(row, "role"),
+			Password: field(row, "password"),
+			Hash:     field(row, "hash"),
+		})
+	}
+}
+
+func readJSONLines(r io.Reader) ([]Record, error) {
+	scanner := bufio.NewScanner(r)
+	records := make([]Record, 0)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+
+		var record Record
+		err := json.Unmarshal([]byte(text), &record)
+		if err != nil {
+			return nil, fmt.Errorf("%w on line %d", err, line)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// WriteUsers writes the users in the requested format. The password hashes are only written if includeHashes is set
+func WriteUsers(w io.Writer, format string, users []common.User, includeHashes bool) error {
+	records := make([]Record, 0, len(users))
+	for _, user := range users {
+		record := Record{
+			Username: user.Username,
+			Role:     user.Role,
+		}
+		if includeHashes {
+			record.Hash = string(user.Hash)
+		}
+		records = append(records, record)
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, records)
+	case FormatJSONLines:
+		return writeJSONLines(w, records)
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func writeCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err = writer.Write([]string{record.Username, record.Role, record.Password, record.Hash})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func writeJSONLines(w io.Writer, records []Record) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToUsers validates the records and converts them to users, hashing the plaintext passwords.
+// The record line numbers in the errors are 1-based and do not account for headers
+func ToUsers(records []Record, rules common.UsernameRules, defaultRole string) ([]common.User, error) {
+	users := make([]common.User, 0, len(records))
+	seen := make(map[string]int)
+	for i, record := range records {
+		idx := i + 1
+		err := rules.Validate(record.Username)
+		if err != nil {
+			return nil, fmt.Errorf("record %d (%s): %w", idx, record.Username, err)
+		}
+
+		canonical := common.CanonicalUsername(record.Username)
+		previous, duplicated := seen[canonical]
+		if duplicated {
+			return nil, fmt.Errorf("record %d (%s): duplicates record %d", idx, record.Username, previous)
+		}
+		seen[canonical] = idx
+
+		hash, err := recordHash(record)
+		if err != nil {
+			return nil, fmt.Errorf("record %d (%s): %w", idx, record.Username, err)
+		}
+
+		role := record.Role
+		if len(role) == 0 {
+			role = defaultRole
+		}
+
+		users = append(users, common.User{
+			Username: common.DisplayUsername(record.Username),
+			Role:     role,
+			Hash:     hash,
+		})
+	}
+
+	return users, nil
+}
+
+func recordHash(record Record) ([]byte, error) {
+	hasPassword := len(record.Password) > 0
+	hasHash := len(record.Hash) > 0
+	if hasPassword == hasHash {
+		return nil, errors.New("exactly one of password or hash should be provided")
+	}
+
+	if hasHash {
+		_, err := bcrypt.Cost([]byte(record.Hash))
+		if err != nil {
+			return nil, fmt.Errorf("%w while checking the bcrypt hash", err)
+		}
+
+		return []byte(record.Hash), nil
+	}
+
+	if len(record.Password) > maxPassLength {
+		return nil, fmt.Errorf("password too long (max %d characters)", maxPassLength)
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(record.Password), bcrypt.DefaultCost)
+}
@@ -0,0 +1,146 @@
+package userio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"FullStackApp01/common"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	t.Parallel()
+
+	format, err := FormatFromPath("users.CSV")
+	assert.Nil(t, err)
+	assert.Equal(t, FormatCSV, format)
+
+	format, err = FormatFromPath("/tmp/users.jsonl")
+	assert.Nil(t, err)
+	assert.Equal(t, FormatJSONLines, format)
+
+	format, err = FormatFromPath("users.txt")
+	assert.NotNil(t, err)
+	assert.Empty(t, format)
+}
+
+func TestReadRecords(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown format should error", func(t *testing.T) {
+		records, err := ReadRecords(strings.NewReader(""), "xml")
+		assert.NotNil(t, err)
+		assert.Nil(t, records)
+	})
+	t.Run("CSV without username column should error", func(t *testing.T) {
+		records, err := ReadRecords(strings.NewReader("name,password\nalice,pass\n"), FormatCSV)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "missing the username column")
+		assert.Nil(t, records)
+	})
+	t.Run("should read CSV with columns in any order", func(t *testing.T) {
+		data := "password,username\npass1,alice\npass2,bob\n"
+		records, err := ReadRecords(strings.NewReader(data), FormatCSV)
+		assert.Nil(t, err)
+		assert.Equal(t, []Record{
+			{Username: "alice", Password: "pass1"},
+			{Username: "bob", Password: "pass2"},
+		}, records)
+	})
+	t.Run("invalid JSON line should error", func(t *testing.T) {
+		data := `{"username":"alice","password":"pass"}` + "\n\nnot json\n"
+		records, err := ReadRecords(strings.NewReader(data), FormatJSONLines)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "on line 3")
+		assert.Nil(t, records)
+	})
+	t.Run("should read JSON lines", func(t *testing.T) {
+		data := `{"username":"alice","password":"pass"}` + "\n\n" + `{"username":"bob","role":"admin","hash":"h"}` + "\n"
+		records, err := ReadRecords(strings.NewReader(data), FormatJSONLines)
+		assert.Nil(t, err)
+		assert.Equal(t, []Record{
+			{Username: "alice", Password: "pass"},
+			{Username: "bob", Role: "admin", Hash: "h"},
+		}, records)
+	})
+}
+
+func TestToUsers(t *testing.T) {
+	t.Parallel()
+
+	rules := common.DefaultUsernameRules()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	t.Run("invalid username should error", func(t *testing.T) {
+		users, err := ToUsers([]Record{{Username: "a b", Password: "pass"}}, rules, "user")
+		assert.ErrorIs(t, err, common.ErrInvalidUsername)
+		assert.Nil(t, users)
+	})
+	t.Run("duplicated usernames should error", func(t *testing.T) {
+		records := []Record{
+			{Username: "alice", Password: "pass"},
+			{Username: "ALICE", Password: "pass"},
+		}
+		users, err := ToUsers(records, rules, "user")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "record 2 (ALICE): duplicates record 1")
+		assert.Nil(t, users)
+	})
+	t.Run("both password and hash should error", func(t *testing.T) {
+		users, err := ToUsers([]Record{{Username: "alice", Password: "pass", Hash: string(hash)}}, rules, "user")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "exactly one of password or hash should be provided")
+		assert.Nil(t, users)
+	})
+	t.Run("invalid hash should error", func(t *testing.T) {
+		users, err := ToUsers([]Record{{Username: "alice", Hash: "not a hash"}}, rules, "user")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "while checking the bcrypt hash")
+		assert.Nil(t, users)
+	})
+	t.Run("should work", func(t *testing.T) {
+		records := []Record{
+			{Username: "Alice", Password: "pass"},
+			{Username: "bob", Role: "admin", Hash: string(hash)},
+		}
+		users, err := ToUsers(records, rules, "user")
+		assert.Nil(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, "Alice", users[0].Username)
+		assert.Equal(t, "user", users[0].Role)
+		assert.Nil(t, bcrypt.CompareHashAndPassword(users[0].Hash, []byte("pass")))
+		assert.Equal(t, "admin", users[1].Role)
+		assert.Equal(t, hash, users[1].Hash)
+	})
+}
+
+func TestWriteUsers(t *testing.T) {
+	t.Parallel()
+
+	users := []common.User{
+		{Username: "alice", Role: "user", Hash: []byte("hash1")},
+		{Username: "bob", Role: "admin", Hash: []byte("hash2")},
+	}
+
+	t.Run("should not export the hashes by default", func(t *testing.T) {
+		buff := bytes.NewBuffer(nil)
+		err := WriteUsers(buff, FormatJSONLines, users, false)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"username":"alice","role":"user"}`+"\n"+`{"username":"bob","role":"admin"}`+"\n", buff.String())
+	})
+	t.Run("CSV export should be importable", func(t *testing.T) {
+		buff := bytes.NewBuffer(nil)
+		err := WriteUsers(buff, FormatCSV, users, true)
+		assert.Nil(t, err)
+
+		records, err := ReadRecords(buff, FormatCSV)
+		assert.Nil(t, err)
+		assert.Equal(t, []Record{
+			{Username: "alice", Role: "user", Hash: "hash1"},
+			{Username: "bob", Role: "admin", Hash: "hash2"},
+		}, records)
+	})
+}